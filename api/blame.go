@@ -0,0 +1,150 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BlameLine is one line of a file, and the commit that last changed it.
+// Number counts the file's lines from 1; OrigNumber and OrigPath say where
+// the line was in the commit it came from, since lines move and files get
+// renamed. Only the first line of the commit's message is in its Desc.
+//
+type BlameLine struct {
+	Number     int
+	OrigNumber int
+	OrigPath   string
+	Commit     Commit
+	Content    string
+}
+
+// Blame is every line of a file as of some commit, in order.
+//
+type Blame []BlameLine
+
+// Blame says which commit last changed each line of the file at p (relative
+// to the repository) as of rev, which can be anything ResolveRevision
+// accepts.
+//
+func (repo *LocalGitRepo) Blame(rev, p string) (Blame, error) {
+	commit, err := repo.ResolveRevision(rev)
+	if err != nil {
+		return nil, err
+	}
+	p = strings.TrimLeft(p, "/")
+	if _, err := repo.runGit("rev-parse", "--verify", "--quiet", fmt.Sprintf("%s:%s", commit, p)); err != nil {
+		return nil, errorOfKind(ErrPathNotFound, "No file \"%s\" at revision %s", p, rev)
+	}
+	if repo.isDirectoryAt(commit.String(), p) {
+		return nil, errorOfKind(ErrPathIsDirectory, "\"%s\" is a directory at revision %s", p, rev)
+	}
+
+	out, err := repo.runGit("blame", "--line-porcelain", commit.String(), "--", p)
+	if err != nil {
+		return nil, err
+	}
+	return parseBlame(out.Bytes())
+}
+
+// parseBlame reads the output of `git blame --line-porcelain`, in which every
+// line of the file comes after a header describing its commit.
+//
+func parseBlame(output []byte) (Blame, error) {
+	result := Blame{}
+	var line *BlameLine
+	var authorMail, authorTZ string
+	var authorTime int64
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(nil, 1<<24)
+
+	for scanner.Scan() {
+		text := scanner.Text()
+		if line == nil {
+			fields := strings.Fields(text)
+			if len(fields) < 3 {
+				return nil, fmt.Errorf("Unexpected git blame output: \"%s\"", text)
+			}
+			hash, err := ParseHash(fields[0])
+			if err != nil {
+				return nil, fmt.Errorf("Unexpected git blame output: \"%s\"", text)
+			}
+			line = &BlameLine{Commit: Commit{Hash: hash}}
+			line.OrigNumber, _ = strconv.Atoi(fields[1])
+			line.Number, _ = strconv.Atoi(fields[2])
+			continue
+		}
+
+		if strings.HasPrefix(text, "\t") {
+			line.Content = text[1:]
+			line.Commit.Author = strings.TrimSpace(line.Commit.Author + " " + authorMail)
+			line.Commit.Date = blameTime(authorTime, authorTZ)
+			result = append(result, *line)
+			line = nil
+			continue
+		}
+		key, value := text, ""
+		if space := strings.IndexByte(text, ' '); space >= 0 {
+			key, value = text[:space], text[space+1:]
+		}
+		switch key {
+		case "author":
+			line.Commit.Author = value
+		case "author-mail":
+			authorMail = value
+		case "author-time":
+			authorTime, _ = strconv.ParseInt(value, 10, 64)
+		case "author-tz":
+			authorTZ = value
+		case "summary":
+			line.Commit.Desc = value
+		case "filename":
+			line.OrigPath = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if line != nil {
+		return nil, fmt.Errorf("git blame output ended partway through line %d", line.Number)
+	}
+	return result, nil
+}
+
+// blameTime is a commit's time in the time zone it was made in, as git blame
+// gives them: seconds since the epoch, and an offset like "-0500".
+//
+func blameTime(seconds int64, tz string) time.Time {
+	t := time.Unix(seconds, 0)
+	if offset, err := strconv.Atoi(tz); err == nil && len(tz) == 5 {
+		minutes := (offset/100)*60 + offset%100
+		t = t.In(time.FixedZone(tz, minutes*60))
+	}
+	return t
+}
+
+type blameLineForJSON struct {
+	Number     int           `json:"number"`
+	OrigNumber int           `json:"origNumber"`
+	OrigPath   string        `json:"origPath"`
+	Commit     commitForJSON `json:"commit"`
+	Content    string        `json:"content"`
+}
+
+func (b *Blame) ToJSON() ([]byte, error) {
+	facades := []blameLineForJSON{}
+	for _, line := range *b {
+		facades = append(facades, blameLineForJSON{
+			Number:     line.Number,
+			OrigNumber: line.OrigNumber,
+			OrigPath:   line.OrigPath,
+			Commit:     *line.Commit.forJSON(),
+			Content:    line.Content,
+		})
+	}
+	return json.Marshal(facades)
+}
@@ -0,0 +1,101 @@
+package api_test
+
+import (
+	"github.com/rbwinslow/morlock/api"
+	"github.com/rbwinslow/morlock/test_util"
+
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Blame", func() {
+	It("should say which commit last changed each line", func() {
+		test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+			// Given
+			tgr.MustAddFile("file.txt", "one\ntwo\nthree\n")
+			first := tgr.MustCommit("first\n\nwith a body")
+			tgr.MustAddFile("file.txt", "one\n2\nthree\n")
+			second := tgr.MustCommit("second")
+			repo, err := api.OpenLocalGitRepo(tgr.Path, nil)
+			Expect(err).To(BeNil())
+
+			// When
+			now, err1 := repo.Blame("HEAD", "file.txt")
+			before, err2 := repo.Blame(first.String(), "file.txt")
+
+			// Then
+			Expect(err1).To(BeNil())
+			Expect(err2).To(BeNil())
+			Expect(now).To(HaveLen(3))
+			Expect(now[0].Commit.Hash.Short()).To(Equal(first))
+			Expect(now[0].Commit.Desc).To(Equal("first"))
+			Expect(now[0].Commit.Author).To(ContainSubstring(tgr.UserName))
+			Expect(now[1].Commit.Hash.Short()).To(Equal(second))
+			Expect(now[1].Content).To(Equal("2"))
+			Expect(now[1].Number).To(Equal(2))
+			Expect(now[2].OrigNumber).To(Equal(3))
+			Expect(now[2].OrigPath).To(Equal("file.txt"))
+			Expect(before[1].Content).To(Equal("two"))
+		})
+	})
+
+	It("should say when there's no such file at the revision", func() {
+		test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+			tgr.MustAddFile("file.txt", "one\n")
+			tgr.MustCommit("first")
+			repo, err := api.OpenLocalGitRepo(tgr.Path, nil)
+			Expect(err).To(BeNil())
+
+			_, err = repo.Blame("HEAD", "other.txt")
+
+			Expect(errors.Is(err, api.ErrPathNotFound)).To(BeTrue())
+		})
+	})
+
+	It("should say when the path is a directory", func() {
+		test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+			tgr.MustAddFile("file.txt", "one\n")
+			tgr.MustCommit("first")
+			repo, err := api.OpenLocalGitRepo(tgr.Path, nil)
+			Expect(err).To(BeNil())
+
+			_, err = repo.Blame("HEAD", "")
+
+			Expect(errors.Is(err, api.ErrPathIsDirectory)).To(BeTrue())
+		})
+	})
+})
+
+var _ = Describe("Timelapse frames", func() {
+	It("should build the timelapse as of the last commit to touch the file", func() {
+		test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+			// Given
+			tgr.MustAddFile("file.txt", "a\nb\n")
+			tgr.MustCommit("first")
+			tgr.MustAddFile("file.txt", "a\n")
+			tgr.MustCommit("second")
+			tgr.MustAddFile("other.txt", "x\n")
+			unrelated := tgr.MustCommit("unrelated")
+			tgr.MustAddFile("file.txt", "a\nc\n")
+			tgr.MustCommit("third")
+			repo, err := api.OpenLocalGitRepo(tgr.Path, nil)
+			Expect(err).To(BeNil())
+
+			// When
+			frame, err := repo.TimelapseFrame(context.Background(), "file.txt", unrelated.String(), api.TimelapseOptions{})
+			_, missing := repo.TimelapseFrame(context.Background(), "other.txt", "HEAD~2", api.TimelapseOptions{})
+
+			// Then
+			Expect(err).To(BeNil())
+			Expect(frame.Commit.Desc).To(Equal("second"))
+			Expect(frame.Timelapse).To(Equal(api.Timelapse{
+				{api.PRESENT, []string{"a"}},
+				{api.DELETED, []string{"b"}},
+			}))
+			Expect(errors.Is(missing, api.ErrPathNotFound)).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,237 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Git decides a file is binary when it finds a NUL byte in its first 8000
+// bytes; we use the same rule so that we agree with its diffs.
+//
+const binarySniffLength = 8000
+
+// Blob is a file's contents as of a particular commit.
+//
+type Blob struct {
+	Commit      Hash
+	Object      Hash
+	Path        string
+	Contents    []byte
+	ContentType string
+	Binary      bool
+}
+
+// Blob reads the file at p (relative to the repository) as it was at rev,
+// which can be anything ResolveRevision accepts. It's all read into memory;
+// OpenBlob reads big files a piece at a time instead.
+//
+func (repo *LocalGitRepo) Blob(rev, p string) (*Blob, error) {
+	commit, object, err := repo.blobObject(rev, p)
+	if err != nil {
+		return nil, err
+	}
+	result := Blob{Commit: commit, Object: object, Path: p}
+
+	out, err := repo.runGit("cat-file", "blob", result.Object.String())
+	if err != nil {
+		return nil, err
+	}
+	result.Contents = out.Bytes()
+	result.Binary = IsBinary(result.Contents)
+	result.ContentType = detectContentType(p, result.Contents, result.Binary)
+
+	return &result, nil
+}
+
+// blobObject finds the object holding the file at p as of rev, and the
+// commit rev resolves to.
+//
+func (repo *LocalGitRepo) blobObject(rev, p string) (commit, object Hash, err error) {
+	if commit, err = repo.ResolveRevision(rev); err != nil {
+		return commit, object, err
+	}
+
+	objectName := fmt.Sprintf("%s:%s", commit, strings.TrimLeft(p, "/"))
+	out, err := repo.runGit("rev-parse", "--verify", "--quiet", objectName)
+	if err != nil {
+		return commit, object, errorOfKind(ErrPathNotFound, "No file \"%s\" at revision %s", p, rev)
+	}
+	if repo.isDirectoryAt(commit.String(), p) {
+		return commit, object, errorOfKind(ErrPathIsDirectory, "\"%s\" is a directory at revision %s", p, rev)
+	}
+	copy(object[:], strings.TrimSpace(out.String()))
+	return commit, object, nil
+}
+
+// BlobStream is a file's contents as of a particular commit, read from git as
+// they're asked for rather than all at once, so that serving a big file (or a
+// range of one) doesn't mean holding all of it in memory. It's an
+// io.ReadSeeker, as http.ServeContent wants. Git can only hand over a blob
+// from the start, so seeking backwards starts over, and seeking forwards
+// reads through, and drops, what's skipped. Close it when done.
+//
+type BlobStream struct {
+	Commit      Hash
+	Object      Hash
+	Path        string
+	Size        int64
+	ContentType string
+	Binary      bool
+
+	repo *LocalGitRepo
+	// head is the start of the contents, read to sniff them, and kept so
+	// that reading from the start doesn't need git again.
+	head []byte
+	// offset is where the next Read reads from; cat is where the running
+	// git is up to in the contents.
+	offset, cat int64
+	cmd         *exec.Cmd
+	stdout      io.ReadCloser
+	stderr      bytes.Buffer
+}
+
+// OpenBlob is Blob for a file that may be too big to read all at once.
+//
+func (repo *LocalGitRepo) OpenBlob(rev, p string) (*BlobStream, error) {
+	commit, object, err := repo.blobObject(rev, p)
+	if err != nil {
+		return nil, err
+	}
+	out, err := repo.runGit("cat-file", "-s", object.String())
+	if err != nil {
+		return nil, err
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(out.String()), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("git cat-file gave a bad size for \"%s\": %s", p, strings.TrimSpace(out.String()))
+	}
+
+	result := &BlobStream{Commit: commit, Object: object, Path: p, Size: size, repo: repo}
+	headLength := size
+	if headLength > binarySniffLength {
+		headLength = binarySniffLength
+	}
+	if err := result.start(); err != nil {
+		return nil, err
+	}
+	result.head = make([]byte, headLength)
+	if _, err := io.ReadFull(result.stdout, result.head); err != nil {
+		result.Close()
+		return nil, CookedErrorFromGitExec(nil, &result.stderr, err)
+	}
+	result.cat = headLength
+	result.Binary = IsBinary(result.head)
+	result.ContentType = detectContentType(p, result.head, result.Binary)
+	return result, nil
+}
+
+// start has git begin handing over the contents from the start, stopping
+// the git that was already at it, if any.
+//
+func (bs *BlobStream) start() error {
+	bs.Close()
+	bs.cmd = exec.Command("git", "cat-file", "blob", bs.Object.String())
+	bs.cmd.Dir = bs.repo.Path
+	bs.stderr.Reset()
+	bs.cmd.Stderr = &bs.stderr
+	stdout, err := bs.cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := bs.cmd.Start(); err != nil {
+		bs.cmd = nil
+		return CookedErrorFromGitExec(nil, &bs.stderr, err)
+	}
+	bs.stdout, bs.cat = stdout, 0
+	return nil
+}
+
+func (bs *BlobStream) Read(p []byte) (int, error) {
+	if bs.offset >= bs.Size {
+		return 0, io.EOF
+	}
+	if bs.offset < int64(len(bs.head)) {
+		n := copy(p, bs.head[bs.offset:])
+		bs.offset += int64(n)
+		return n, nil
+	}
+
+	if bs.cmd == nil || bs.cat > bs.offset {
+		if err := bs.start(); err != nil {
+			return 0, err
+		}
+	}
+	if bs.cat < bs.offset {
+		skipped, err := io.CopyN(ioutil.Discard, bs.stdout, bs.offset-bs.cat)
+		bs.cat += skipped
+		if err != nil {
+			return 0, CookedErrorFromGitExec(nil, &bs.stderr, err)
+		}
+	}
+	if remaining := bs.Size - bs.offset; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := bs.stdout.Read(p)
+	bs.offset += int64(n)
+	bs.cat += int64(n)
+	if err == io.EOF && bs.offset < bs.Size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (bs *BlobStream) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += bs.offset
+	case io.SeekEnd:
+		offset += bs.Size
+	}
+	if offset < 0 {
+		return bs.offset, fmt.Errorf("Can't seek to %d, before the start of \"%s\"", offset, bs.Path)
+	}
+	bs.offset = offset
+	return offset, nil
+}
+
+// Close stops git, which may be partway through the contents.
+//
+func (bs *BlobStream) Close() error {
+	if bs.cmd == nil {
+		return nil
+	}
+	bs.stdout.Close()
+	bs.cmd.Process.Kill()
+	bs.cmd.Wait()
+	bs.cmd, bs.stdout = nil, nil
+	return nil
+}
+
+func IsBinary(contents []byte) bool {
+	if len(contents) > binarySniffLength {
+		contents = contents[:binarySniffLength]
+	}
+	return bytes.IndexByte(contents, 0) >= 0
+}
+
+// detectContentType prefers what the file's extension says, and falls back
+// to sniffing. Text that the sniffer can't place is still text.
+//
+func detectContentType(p string, contents []byte, binary bool) string {
+	if byExtension := mime.TypeByExtension(path.Ext(p)); len(byExtension) > 0 {
+		return byExtension
+	}
+	sniffed := http.DetectContentType(contents)
+	if !binary && sniffed == "application/octet-stream" {
+		return "text/plain; charset=utf-8"
+	}
+	return sniffed
+}
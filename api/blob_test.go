@@ -0,0 +1,110 @@
+package api_test
+
+import (
+	"github.com/rbwinslow/morlock/api"
+	"github.com/rbwinslow/morlock/test_util"
+
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Blob", func() {
+	It("should read a file as of an older revision", func() {
+		// Given
+		test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+			tgr.MustAddFile("notes.md", "first draft\n")
+			first := tgr.MustCommit("first")
+			tgr.MustAddFile("notes.md", "second draft\n")
+			tgr.MustCommit("second")
+
+			// When
+			repo, err := api.OpenLocalGitRepo(tgr.Path, nil)
+			Expect(err).To(BeNil())
+			old, errOld := repo.Blob(first.String(), "notes.md")
+			head, errHead := repo.Blob("HEAD", "notes.md")
+
+			// Then
+			Expect(errOld).To(BeNil())
+			Expect(string(old.Contents)).To(Equal("first draft\n"))
+			Expect(old.Commit.Equals(first)).To(BeTrue())
+			Expect(old.Binary).To(BeFalse())
+			Expect(errHead).To(BeNil())
+			Expect(string(head.Contents)).To(Equal("second draft\n"))
+			Expect(head.Object).ToNot(Equal(old.Object))
+		})
+	})
+
+	It("should flag binary files", func() {
+		test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+			tgr.MustAddFile("data", "\x00\x01\x02")
+			tgr.MustCommit("binary")
+
+			repo, err := api.OpenLocalGitRepo(tgr.Path, nil)
+			Expect(err).To(BeNil())
+			blob, err := repo.Blob("HEAD", "data")
+
+			Expect(err).To(BeNil())
+			Expect(blob.Binary).To(BeTrue())
+			Expect(blob.ContentType).To(Equal("application/octet-stream"))
+		})
+	})
+
+	It("should fail for a file that isn't in the revision", func() {
+		test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+			tgr.MustAddFile("a.txt", "a")
+			tgr.MustCommit("a")
+
+			repo, err := api.OpenLocalGitRepo(tgr.Path, nil)
+			Expect(err).To(BeNil())
+			_, err = repo.Blob("HEAD", "b.txt")
+
+			Expect(err).ToNot(BeNil())
+		})
+	})
+
+	It("should stream a big file, seeking forwards and back", func() {
+		test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+			// Given
+			var b strings.Builder
+			for i := 0; b.Len() < 100000; i++ {
+				fmt.Fprintf(&b, "line %d\n", i)
+			}
+			contents := b.String()
+			tgr.MustAddFile("big.txt", contents)
+			tgr.MustCommit("big")
+			repo, err := api.OpenLocalGitRepo(tgr.Path, nil)
+			Expect(err).To(BeNil())
+
+			// When
+			blob, err := repo.OpenBlob("HEAD", "big.txt")
+			Expect(err).To(BeNil())
+			defer blob.Close()
+			read := func(offset, length int64) string {
+				_, err := blob.Seek(offset, io.SeekStart)
+				Expect(err).To(BeNil())
+				part, err := ioutil.ReadAll(io.LimitReader(blob, length))
+				Expect(err).To(BeNil())
+				return string(part)
+			}
+			middle := read(50000, 20)
+			start := read(0, 20)
+			pastHead := read(9000, 20)
+			end := read(blob.Size-20, 100)
+			all := read(0, blob.Size)
+
+			// Then
+			Expect(blob.Size).To(Equal(int64(len(contents))))
+			Expect(blob.Binary).To(BeFalse())
+			Expect(middle).To(Equal(contents[50000:50020]))
+			Expect(start).To(Equal(contents[:20]))
+			Expect(pastHead).To(Equal(contents[9000:9020]))
+			Expect(end).To(Equal(contents[len(contents)-20:]))
+			Expect(all).To(Equal(contents))
+		})
+	})
+})
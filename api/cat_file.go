@@ -0,0 +1,91 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// blobReader keeps one `git cat-file --batch` process running, so that many
+// objects can be read without paying for a process launch each time. Objects
+// are named any way git accepts: a hash, or "<rev>:<path>".
+//
+type blobReader struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	stderr bytes.Buffer
+}
+
+// errObjectMissing is what blobReader.read says when git has no such object,
+// which for "<rev>:<path>" means the file didn't exist at that revision.
+//
+var errObjectMissing = errors.New("No such object")
+
+func (repo *LocalGitRepo) newBlobReader() (*blobReader, error) {
+	br := &blobReader{cmd: exec.Command("git", "cat-file", "--batch")}
+	br.cmd.Dir = repo.Path
+	br.cmd.Stderr = &br.stderr
+
+	stdin, err := br.cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := br.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	br.stdin = stdin
+	br.stdout = bufio.NewReader(stdout)
+
+	if err := br.cmd.Start(); err != nil {
+		return nil, err
+	}
+	return br, nil
+}
+
+func (br *blobReader) read(object string) ([]byte, error) {
+	if _, err := fmt.Fprintln(br.stdin, object); err != nil {
+		return nil, CookedErrorFromGitExec(nil, &br.stderr, err)
+	}
+
+	header, err := br.stdout.ReadString('\n')
+	if err != nil {
+		return nil, CookedErrorFromGitExec(nil, &br.stderr, err)
+	}
+	fields := strings.Fields(header)
+	if len(fields) == 2 && fields[1] == "missing" {
+		return nil, errObjectMissing
+	}
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("git cat-file couldn't read \"%s\": %s", object, strings.TrimSpace(header))
+	}
+	size, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return nil, fmt.Errorf("git cat-file gave a bad object size for \"%s\": %s", object, fields[2])
+	}
+
+	contents := make([]byte, size+1)
+	if _, err := io.ReadFull(br.stdout, contents); err != nil {
+		return nil, err
+	}
+	return contents[:size], nil
+}
+
+func (br *blobReader) Close() error {
+	br.stdin.Close()
+	return br.cmd.Wait()
+}
+
+func countLines(contents []byte) int {
+	lines := bytes.Count(contents, []byte{'\n'})
+	if len(contents) > 0 && contents[len(contents)-1] != '\n' {
+		lines++
+	}
+	return lines
+}
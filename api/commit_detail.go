@@ -0,0 +1,100 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const commitDetailFormat = "--format=%H%x00%P%x00%an <%ae>%x00%aI%x00%cn <%ce>%x00%cI%x00%B"
+
+// CommitDetail is a Commit with everything else git knows about it, including
+// what it did to each file. For merges, Files describes the changes relative
+// to the first parent.
+//
+type CommitDetail struct {
+	Commit
+	Parents    []Hash
+	Committer  string
+	CommitDate time.Time
+	Files      []FileDiff
+}
+
+func (repo *LocalGitRepo) CommitDetail(rev string) (*CommitDetail, error) {
+	hash, err := repo.ResolveRevision(rev)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := repo.runGit("show", "-s", "--no-color", commitDetailFormat, hash.String())
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.SplitN(out.String(), "\x00", 7)
+	if len(fields) != 7 {
+		return nil, fmt.Errorf("Unexpected git show output for commit %s", hash)
+	}
+
+	detail := CommitDetail{Commit: Commit{Hash: hash, Author: fields[2], Desc: strings.TrimRight(fields[6], "\n")}}
+	for _, parent := range strings.Fields(fields[1]) {
+		var parentHash Hash
+		copy(parentHash[:], parent)
+		detail.Parents = append(detail.Parents, parentHash)
+	}
+	if detail.Date, err = time.Parse(time.RFC3339, fields[3]); err != nil {
+		return nil, err
+	}
+	detail.Committer = fields[4]
+	if detail.CommitDate, err = time.Parse(time.RFC3339, fields[5]); err != nil {
+		return nil, err
+	}
+
+	args := []string{"-c", "core.quotepath=off", "diff-tree", "-r", "-M", "--no-color", "--no-commit-id", "--raw", "--numstat", "-p"}
+	if len(detail.Parents) > 0 {
+		args = append(args, detail.Parents[0].String(), hash.String())
+	} else {
+		args = append(args, "--root", hash.String())
+	}
+	out, err = repo.runGit(args...)
+	if err != nil {
+		return nil, err
+	}
+	if detail.Files, err = parseFileDiffs(out.Bytes()); err != nil {
+		return nil, err
+	}
+	for _, file := range detail.Files {
+		detail.Changes = append(detail.Changes, file.FileChange)
+		detail.LinesAdded += file.Added
+		detail.LinesRemoved += file.Deleted
+		detail.Binary = detail.Binary || file.Binary
+	}
+
+	return &detail, nil
+}
+
+type commitDetailForJSON struct {
+	commitForJSON
+	Parents    []string          `json:"parents"`
+	Committer  string            `json:"committer"`
+	CommitDate time.Time         `json:"commitDate"`
+	Files      []fileDiffForJSON `json:"files"`
+}
+
+func (cd *CommitDetail) ToJSON() ([]byte, error) {
+	facade := commitDetailForJSON{
+		commitForJSON: *cd.Commit.forJSON(),
+		Parents:       []string{},
+		Committer:     cd.Committer,
+		CommitDate:    cd.CommitDate,
+		Files:         []fileDiffForJSON{},
+	}
+	facade.commitForJSON.Changes = nil
+	for _, parent := range cd.Parents {
+		facade.Parents = append(facade.Parents, parent.String())
+	}
+	for _, file := range cd.Files {
+		facade.Files = append(facade.Files, file.forJSON())
+	}
+	return json.Marshal(facade)
+}
@@ -0,0 +1,104 @@
+package api_test
+
+import (
+	"github.com/rbwinslow/morlock/api"
+	"github.com/rbwinslow/morlock/test_util"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/waigani/diffparser"
+)
+
+var _ = Describe("Commit detail", func() {
+	It("should describe a root commit", func() {
+		// Given
+		test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+			tgr.MustAddFile("a.txt", "one\ntwo\n")
+			hash := tgr.MustCommit("Subject\n\nBody")
+
+			// When
+			repo, err := api.OpenLocalGitRepo(tgr.Path, nil)
+			Expect(err).To(BeNil())
+			detail, err := repo.CommitDetail(hash.String())
+
+			// Then
+			Expect(err).To(BeNil())
+			Expect(detail.Hash.Equals(hash)).To(BeTrue())
+			Expect(detail.Parents).To(BeEmpty())
+			Expect(detail.Author).To(Equal(tgr.UserName + " <" + tgr.UserEmail + ">"))
+			Expect(detail.Committer).To(Equal(detail.Author))
+			Expect(detail.Desc).To(Equal("Subject\n\nBody"))
+			Expect(detail.Files).To(HaveLen(1))
+			Expect(detail.Files[0].Status).To(Equal(api.FILE_ADDED))
+			Expect(detail.Files[0].Added).To(Equal(2))
+			Expect(detail.Files[0].Hunks).To(HaveLen(1))
+			Expect(detail.Files[0].Hunks[0].Lines[1]).To(Equal(api.DiffLine{Mode: diffparser.ADDED, NewNumber: 2, Content: "two"}))
+		})
+	})
+
+	It("should list modified, renamed, deleted and mode-changed files", func() {
+		// Given
+		test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+			tgr.MustAddFile("edit.txt", "one\ntwo\nthree\n")
+			tgr.MustAddFile("move.txt", "moving right along\n")
+			tgr.MustAddFile("gone.txt", "bye\n")
+			tgr.MustAddFile("run.sh", "echo hi\n")
+			first := tgr.MustCommit("first")
+			tgr.MustAddFile("edit.txt", "one\n2\nthree\n")
+			tgr.MustRun("mv", "move.txt", "moved.txt")
+			tgr.MustRun("rm", "gone.txt")
+			tgr.MustRun("update-index", "--chmod=+x", "run.sh")
+			second := tgr.MustCommit("second")
+
+			// When
+			repo, err := api.OpenLocalGitRepo(tgr.Path, nil)
+			Expect(err).To(BeNil())
+			detail, err := repo.CommitDetail(second.String())
+
+			// Then
+			Expect(err).To(BeNil())
+			Expect(detail.Parents).To(HaveLen(1))
+			Expect(detail.Parents[0].Equals(first)).To(BeTrue())
+
+			byPath := map[string]api.FileDiff{}
+			for _, file := range detail.Files {
+				byPath[file.Path] = file
+			}
+			Expect(byPath).To(HaveLen(4))
+
+			edited := byPath["edit.txt"]
+			Expect(edited.Status).To(Equal(api.FILE_MODIFIED))
+			Expect(edited.Added).To(Equal(1))
+			Expect(edited.Deleted).To(Equal(1))
+			Expect(edited.Hunks).To(HaveLen(1))
+			Expect(edited.Hunks[0].Lines).To(Equal([]api.DiffLine{
+				{Mode: diffparser.UNCHANGED, OrigNumber: 1, NewNumber: 1, Content: "one"},
+				{Mode: diffparser.REMOVED, OrigNumber: 2, Content: "two"},
+				{Mode: diffparser.ADDED, NewNumber: 2, Content: "2"},
+				{Mode: diffparser.UNCHANGED, OrigNumber: 3, NewNumber: 3, Content: "three"},
+			}))
+
+			Expect(byPath["moved.txt"].Status).To(Equal(api.FILE_RENAMED))
+			Expect(byPath["moved.txt"].OldPath).To(Equal("move.txt"))
+			Expect(byPath["gone.txt"].Status).To(Equal(api.FILE_DELETED))
+			Expect(byPath["gone.txt"].Deleted).To(Equal(1))
+			Expect(byPath["run.sh"].Status).To(Equal(api.FILE_MODE_CHANGED))
+			Expect(byPath["run.sh"].OldMode).To(Equal("100644"))
+			Expect(byPath["run.sh"].NewMode).To(Equal("100755"))
+			Expect(byPath["run.sh"].Hunks).To(BeEmpty())
+		})
+	})
+
+	It("should refuse a revision that doesn't exist", func() {
+		test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+			tgr.MustAddFile("a.txt", "a")
+			tgr.MustCommit("a")
+
+			repo, err := api.OpenLocalGitRepo(tgr.Path, nil)
+			Expect(err).To(BeNil())
+			_, err = repo.CommitDetail("no-such-branch")
+
+			Expect(err).ToNot(BeNil())
+		})
+	})
+})
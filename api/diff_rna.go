@@ -5,173 +5,263 @@ import (
 	"github.com/waigani/diffparser"
 )
 
+// diffRNA transcribes one commit's diff of a file onto a Timelapse, moving
+// forward in time: removed lines stay where they were, but become DELETED, and
+// added lines are spliced in as PRESENT. Going in, the PRESENT lines of the
+// old timelapse have to be the file as it was before the commit.
+//
+// Rather than splicing the old timelapse in place, diffRNA reads it hunk by
+// hunk and builds the new one beside it. Lines the diff doesn't touch are
+// carried over as slices of the old hunks, so successive frames of a timelapse
+// share all of their unchanged lines, and the old timelapse never changes.
+//
 type diffRNA struct {
-	origLines, newLines                []*diffparser.DiffLine
-	positionCursor, lastPos            int
-	origCursor, newCursor              int
+	hunk                               DiffHunk
+	lineCursor                         int
+	old                                Timelapse
 	resultCursorHunk, resultCursorLine int
-	result                             *Timelapse
+	result                             Timelapse
+	presentLines                       int
+	tail                               rnaTail
+	lines                              lineInterner
 }
 
-func newDiffRNA(origLines, newLines []*diffparser.DiffLine, result *Timelapse) (*diffRNA, error) {
-	obj := diffRNA{
-		origLines:      origLines,
-		newLines:       newLines,
-		result:         result,
-		positionCursor: 1,
-	}
-	if result == nil {
-		return nil, fmt.Errorf("New diffRNA passed nil Timelapse pointer")
-	}
-
-	if origLines[len(origLines)-1].Position > newLines[len(newLines)-1].Position {
-		obj.lastPos = origLines[len(origLines)-1].Position
-	} else {
-		obj.lastPos = newLines[len(newLines)-1].Position
-	}
+// rnaTail says where the last hunk of the result came from, so that it can
+// grow rather than be followed by another hunk like it. A hunk carried over
+// from the old timelapse grows while its lines keep coming from the same old
+// hunk; a hunk of new lines belongs to the result, and grows by appending.
+// Which hunks grow depends only on the timelapse's hunks, never on how their
+// lines happen to be laid out in memory, so the same history always makes the
+// same hunks.
+//
+type rnaTail struct {
+	from       int
+	start, end int
+}
 
-	obj.resultCursorHunk, obj.resultCursorLine = mustSeekAddedLine(result, newLines[0].Number)
+const (
+	rnaTailNone = -2
+	rnaTailNew  = -1
+)
 
-	return &obj, nil
+func newDiffRNA(old Timelapse, lines lineInterner) *diffRNA {
+	return &diffRNA{
+		old:    old,
+		result: make(Timelapse, 0, len(old)+2),
+		tail:   rnaTail{from: rnaTailNone},
+		lines:  lines,
+	}
 }
 
-func (dn *diffRNA) advance() error {
-	if !dn.eof() {
-		dn.positionCursor++
-		if len(dn.origLines) > (dn.origCursor+1) && dn.origLines[dn.origCursor].Position <= dn.positionCursor-1 {
-			dn.origCursor++
+// seek carries the old timelapse over into the result up to where the
+// current diff hunk starts: just after the line before it, ahead of any
+// DELETED hunks that follow that line.
+//
+func (dn *diffRNA) seek() error {
+	// Everything above the hunk is already numbered the way the new version
+	// of the file numbers it. When the new side of the hunk is empty, its
+	// start is the line the hunk comes after.
+	before := dn.hunk.NewStart - 1
+	if dn.hunk.NewLength == 0 {
+		before++
+	}
+	if before < dn.presentLines {
+		return fmt.Errorf("Difference analysis error; hunk %q starts at line %d, but line %d has already gone by", dn.hunk.Header, before+1, dn.presentLines)
+	}
+
+	for n := before - dn.presentLines; n > 0; {
+		dn.skipDeleted()
+		if dn.eof() {
+			return fmt.Errorf("Difference analysis error; hunk %q starts past the end of the timelapse", dn.hunk.Header)
 		}
-		if len(dn.newLines) > (dn.newCursor+1) && dn.newLines[dn.newCursor].Position == dn.positionCursor-1 {
-			dn.newCursor++
-			if dn.newLines[dn.newCursor].Mode == diffparser.UNCHANGED {
-				if len((*dn.result)[dn.resultCursorHunk].Lines) > dn.resultCursorLine+1 {
-					dn.resultCursorLine++
-				} else if len(*dn.result) > dn.resultCursorHunk+1 {
-					dn.resultCursorHunk++
-					dn.resultCursorLine = 0
-				} else {
-					return fmt.Errorf("Difference analysis error; unchanged lines overran timelapse at diff line \"%s\"", dn.newLines[dn.newCursor])
-				}
-			}
+		take := len(dn.old[dn.resultCursorHunk].Lines) - dn.resultCursorLine
+		if take > n {
+			take = n
 		}
+		dn.carryOver(take)
+		n -= take
 	}
+	return nil
+}
 
+// advance carries one PRESENT line over into the result, along with any
+// DELETED hunks in front of it.
+//
+func (dn *diffRNA) advance(line DiffLine) error {
+	dn.skipDeleted()
+	if dn.eof() {
+		return fmt.Errorf("Difference analysis error; unchanged lines overran timelapse at diff line %q", line.Content)
+	}
+	if current := dn.old[dn.resultCursorHunk].Lines[dn.resultCursorLine]; current != line.Content {
+		return fmt.Errorf("Difference analysis error; diff keeps %q where the timelapse has %q", line.Content, current)
+	}
+	dn.carryOver(1)
 	return nil
 }
 
-func (dn *diffRNA) advanceOrigWhile(mode diffparser.DiffLineMode) (int, error) {
-	max := len(dn.origLines)
-	for dn.origCursor < max && dn.origLines[dn.origCursor+1].Mode == mode && dn.origLines[dn.origCursor+1].Position == dn.origLines[dn.origCursor].Position+1 {
-		if err := dn.advance(); err != nil {
-			return dn.origCursor, err
-		}
+// carryOver copies the next n lines of the current old hunk into the result.
+//
+func (dn *diffRNA) carryOver(n int) {
+	from := dn.old[dn.resultCursorHunk]
+	start, end := dn.resultCursorLine, dn.resultCursorLine+n
+	if dn.tail.from == dn.resultCursorHunk && dn.tail.end == start {
+		dn.result[len(dn.result)-1].Lines = from.Lines[dn.tail.start:end]
+		dn.tail.end = end
+	} else {
+		dn.result = append(dn.result, TimelapseHunk{from.Disposition, from.Lines[start:end]})
+		dn.tail = rnaTail{from: dn.resultCursorHunk, start: start, end: end}
+	}
+	if from.Disposition == PRESENT {
+		dn.presentLines += n
 	}
-	return dn.origCursor, nil
+	dn.skipOld(n)
 }
 
-func (dn *diffRNA) dump() string {
-	origLine := dn.origLines[dn.origCursor].Content
-	newLine := dn.newLines[dn.newCursor].Content
+// emit adds a line to the result that wasn't there before, as far as the
+// result's hunks are concerned.
+//
+func (dn *diffRNA) emit(disposition Disposition, line string) {
+	last := len(dn.result) - 1
+	if dn.tail.from == rnaTailNew && dn.result[last].Disposition == disposition {
+		dn.result[last].Lines = append(dn.result[last].Lines, line)
+	} else {
+		dn.result = append(dn.result, TimelapseHunk{disposition, []string{line}})
+		dn.tail = rnaTail{from: rnaTailNew}
+	}
+	if disposition == PRESENT {
+		dn.presentLines++
+	}
+}
 
-	truncOrig := 10
-	if truncOrig > len(origLine) {
-		truncOrig = len(origLine)
+func (dn *diffRNA) dump() string {
+	diffLine := "(none)"
+	if dn.lineCursor < len(dn.hunk.Lines) {
+		diffLine = dn.hunk.Lines[dn.lineCursor].Content
 	}
-	truncNew := 10
-	if truncNew > len(newLine) {
-		truncNew = len(newLine)
+	oldLine := "(none)"
+	if !dn.eof() {
+		oldLine = dn.old[dn.resultCursorHunk].Lines[dn.resultCursorLine]
 	}
 
-	format := "At position %d: orig line %d of %d (%s), new line %d of %d (%s), result hunk %d of %d, line %d of %d (%s); EOF %t"
-	hunkLines := (*dn.result)[dn.resultCursorHunk].Lines
-	lineAtCursor := hunkLines[dn.resultCursorLine]
-	return fmt.Sprintf(format, dn.positionCursor, dn.origCursor, len(dn.origLines), origLine[:truncOrig], dn.newCursor, len(dn.newLines), newLine[:truncNew], dn.resultCursorHunk, len(*dn.result), dn.resultCursorLine, len(hunkLines), lineAtCursor, dn.eof())
+	format := "At diff line %d of %d (%.10q) in hunk %q, old hunk %d of %d, line %d (%.10q); %d hunks and %d present lines transcribed; EOF %t"
+	return fmt.Sprintf(format, dn.lineCursor, len(dn.hunk.Lines), diffLine, dn.hunk.Header, dn.resultCursorHunk, len(dn.old), dn.resultCursorLine, oldLine, len(dn.result), dn.presentLines, dn.eof())
 }
 
 func (dn *diffRNA) eof() bool {
-	return dn.positionCursor >= dn.lastPos
+	return dn.resultCursorHunk >= len(dn.old)
 }
 
-func (dn *diffRNA) hasOrig() bool {
-	return dn.origLines[dn.origCursor].Position == dn.positionCursor
+// finish carries over whatever the diff didn't reach, and hands back the
+// result.
+//
+func (dn *diffRNA) finish() Timelapse {
+	for !dn.eof() {
+		dn.carryOver(len(dn.old[dn.resultCursorHunk].Lines) - dn.resultCursorLine)
+	}
+	return dn.result
 }
 
-func (dn *diffRNA) hasNew() bool {
-	return dn.newLines[dn.newCursor].Position == dn.positionCursor
+// remove turns the next PRESENT line of the old timelapse DELETED.
+//
+func (dn *diffRNA) remove(line DiffLine) error {
+	dn.skipDeleted()
+	if dn.eof() {
+		return fmt.Errorf("Difference analysis error; removed lines overran timelapse at diff line %q", line.Content)
+	}
+	current := dn.old[dn.resultCursorHunk].Lines[dn.resultCursorLine]
+	if current != line.Content {
+		return fmt.Errorf("Difference analysis error; diff removes %q where the timelapse has %q", line.Content, current)
+	}
+	dn.emit(DELETED, current)
+	dn.skipOld(1)
+	return nil
 }
 
-func (dn *diffRNA) orig() *diffparser.DiffLine {
-	return dn.origLines[dn.origCursor]
+// skipDeleted carries over the DELETED hunks at the cursor, if any.
+//
+func (dn *diffRNA) skipDeleted() {
+	for !dn.eof() && dn.old[dn.resultCursorHunk].Disposition == DELETED {
+		dn.carryOver(len(dn.old[dn.resultCursorHunk].Lines) - dn.resultCursorLine)
+	}
 }
 
-func (dn *diffRNA) spliceTimelapse(deleteHowMany int, newHunkCursor int, what ...TimelapseHunk) {
-	*dn.result = append(append((*dn.result)[:dn.resultCursorHunk], noNilHunks(what...)...), (*dn.result)[dn.resultCursorHunk + deleteHowMany:]...)
-	dn.resultCursorHunk = newHunkCursor
-	dn.resultCursorLine = 0
+func (dn *diffRNA) skipOld(n int) {
+	dn.resultCursorLine += n
+	if dn.resultCursorLine >= len(dn.old[dn.resultCursorHunk].Lines) {
+		dn.resultCursorHunk++
+		dn.resultCursorLine = 0
+	}
 }
 
-func (dn *diffRNA) transcribe() error {
-	for !dn.eof() {
-		if dn.hasOrig() && dn.orig().Mode == diffparser.REMOVED {
-			if dn.hasNew() {
-				return fmt.Errorf("Found deleted line with same position in diff hunk as new line!")
-			}
-			start := dn.origCursor
-			end, err := dn.advanceOrigWhile(diffparser.REMOVED)
-			if err != nil {
+func (dn *diffRNA) transcribe(hunk DiffHunk) error {
+	dn.hunk = hunk
+	dn.lineCursor = 0
+	if err := dn.seek(); err != nil {
+		return err
+	}
+
+	for ; dn.lineCursor < len(hunk.Lines); dn.lineCursor++ {
+		line := hunk.Lines[dn.lineCursor]
+		switch line.Mode {
+		case diffparser.UNCHANGED:
+			if err := dn.advance(line); err != nil {
 				return err
 			}
-			lines := make([]string, (end-start)+1)
-			for i := 0; i < (end-start)+1; i++ {
-				lines[i] = dn.origLines[start+i].Content
-			}
-			delhunk := TimelapseHunk{
-				DELETED,
-				lines,
+		case diffparser.REMOVED:
+			if err := dn.remove(line); err != nil {
+				return err
 			}
-			forehunk, afthunk := splitHunk((*dn.result)[dn.resultCursorHunk], dn.resultCursorLine)
-			dn.spliceTimelapse(1, dn.resultCursorHunk + 2, forehunk, delhunk, afthunk)
-		}
-		if err := dn.advance(); err != nil {
-			return err
+		case diffparser.ADDED:
+			dn.emit(PRESENT, dn.lines.intern(line.Content))
+		default:
+			return fmt.Errorf("Difference analysis error; unexpected mode %d at diff line %q", int(line.Mode), line.Content)
 		}
 	}
 
 	return nil
 }
 
-func mustSeekAddedLine(tl *Timelapse, lineNumber int) (hunkIndex, lineIndex int) {
-	for lineno := lineNumber; hunkIndex < len(*tl); hunkIndex++ {
-		thisHunk := &(*tl)[hunkIndex]
-		if (*thisHunk).Disposition == DELETED {
-			continue
-		}
-		if len((*thisHunk).Lines) < lineno {
-			lineno -= len((*thisHunk).Lines)
-		} else {
-			lineIndex = lineno - 1
-			return
-		}
+// transcribeHunks works one commit's diff of a file into a timelapse of it.
+// The timelapse passed in is left as it was. When something goes wrong, even
+// a panic, the error is a *TimelapseError saying where.
+//
+func transcribeHunks(tl Timelapse, hunks []DiffHunk, lines lineInterner) (result Timelapse, err error) {
+	if len(hunks) == 0 {
+		return tl, nil
 	}
-	panic(fmt.Sprintf("Seeking added line %d went past end of Timelapse with %s hunks", lineNumber, len(*tl)))
-}
+	nav := newDiffRNA(tl, lines)
+	hunkIndex := 0
+	fail := func(err error) error {
+		return &TimelapseError{Hunk: hunkIndex, HunkHeader: nav.hunk.Header, Line: nav.lineCursor, Diagnostic: nav.dump(), Err: err}
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = nil, fail(fmt.Errorf("Difference analysis error; %v", r))
+		}
+	}()
 
-func noNilHunks(hunks ...TimelapseHunk) []TimelapseHunk {
-	var result []TimelapseHunk
-	for _, h := range hunks {
-		if h.Lines != nil {
-			result = append(result, h)
+	for i, hunk := range hunks {
+		hunkIndex = i
+		if err := nav.transcribe(hunk); err != nil {
+			return nil, fail(err)
 		}
 	}
-	return result
+	return nav.finish(), nil
 }
 
-func splitHunk(h TimelapseHunk, line int) (before, after TimelapseHunk) {
-	if line > 0 {
-		before = TimelapseHunk{h.Disposition, h.Lines[:line]}
-	}
-	if line < len(h.Lines) {
-		after = TimelapseHunk{h.Disposition, h.Lines[line:]}
+// lineInterner keeps one copy of each distinct line it's shown. Generated
+// files and reverted changes bring the same lines back again and again, and
+// they all end up sharing a string. Interning also copies each line out of the
+// diff it came from, which would otherwise be kept alive, whole, for as long
+// as any of its lines were.
+//
+type lineInterner map[string]string
+
+func (li lineInterner) intern(line string) string {
+	if interned, ok := li[line]; ok {
+		return interned
 	}
-	return
+	line = string([]byte(line))
+	li[line] = line
+	return line
 }
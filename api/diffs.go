@@ -0,0 +1,409 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/waigani/diffparser"
+)
+
+var (
+	reRawDiff = regexp.MustCompile(`^:(\d{6}) (\d{6}) ([[:xdigit:]]+) ([[:xdigit:]]+) ([ACDMRTUX])\d*\t([^\t]+)(?:\t([^\t]+))?$`)
+	reNumstat = regexp.MustCompile(`^(\d+|-)\t(\d+|-)\t`)
+)
+
+// WhitespaceMode says how much whitespace a diff should ignore. The modes
+// correspond to git diff's --ignore-space-at-eol, -b and -w respectively.
+//
+type WhitespaceMode int
+
+const (
+	WHITESPACE_EXACT WhitespaceMode = iota
+	WHITESPACE_IGNORE_AT_EOL
+	WHITESPACE_IGNORE_CHANGE
+	WHITESPACE_IGNORE_ALL
+)
+
+var whitespaceModeNames = map[string]WhitespaceMode{
+	"":       WHITESPACE_EXACT,
+	"exact":  WHITESPACE_EXACT,
+	"eol":    WHITESPACE_IGNORE_AT_EOL,
+	"change": WHITESPACE_IGNORE_CHANGE,
+	"all":    WHITESPACE_IGNORE_ALL,
+}
+
+func ParseWhitespaceMode(s string) (WhitespaceMode, error) {
+	mode, ok := whitespaceModeNames[s]
+	if !ok {
+		return WHITESPACE_EXACT, fmt.Errorf("Unknown whitespace mode \"%s\" (expected exact, eol, change or all)", s)
+	}
+	return mode, nil
+}
+
+var diffAlgorithms = map[string]bool{"": true, "myers": true, "minimal": true, "patience": true, "histogram": true}
+
+// DiffOptions control how Diff compares two versions of a file. Algorithm is
+// one of git's diff algorithms (myers, minimal, patience or histogram), and
+// the empty string leaves the choice to git's configuration.
+//
+type DiffOptions struct {
+	Whitespace    WhitespaceMode
+	Algorithm     string
+	FollowRenames bool
+}
+
+func (opts *DiffOptions) Validate() error {
+	_, err := opts.gitArgs()
+	return err
+}
+
+func (opts *DiffOptions) gitArgs() ([]string, error) {
+	var args []string
+	switch opts.Whitespace {
+	case WHITESPACE_EXACT:
+	case WHITESPACE_IGNORE_AT_EOL:
+		args = append(args, "--ignore-space-at-eol")
+	case WHITESPACE_IGNORE_CHANGE:
+		args = append(args, "--ignore-space-change")
+	case WHITESPACE_IGNORE_ALL:
+		args = append(args, "--ignore-all-space")
+	default:
+		return nil, fmt.Errorf("Unexpected whitespace mode %d", int(opts.Whitespace))
+	}
+	if !diffAlgorithms[opts.Algorithm] {
+		return nil, fmt.Errorf("Unknown diff algorithm \"%s\"", opts.Algorithm)
+	}
+	if len(opts.Algorithm) > 0 {
+		args = append(args, "--diff-algorithm="+opts.Algorithm)
+	}
+	if opts.FollowRenames {
+		args = append(args, "-M")
+	} else {
+		args = append(args, "--no-renames")
+	}
+	return args, nil
+}
+
+// FileDiff is everything a diff has to say about one file: what happened to
+// it, how many lines changed, and the changes themselves.
+//
+type FileDiff struct {
+	FileChange
+	OldMode, NewMode string
+	Added, Deleted   int
+	Binary           bool
+	Hunks            []DiffHunk
+}
+
+// DiffHunk is one "@@" section of a unified diff. Header is whatever git
+// printed after the ranges, usually the enclosing function.
+//
+type DiffHunk struct {
+	Header                string
+	OrigStart, OrigLength int
+	NewStart, NewLength   int
+	Lines                 []DiffLine
+}
+
+// DiffLine is a line of a DiffHunk, with its line number in each version of
+// the file. A number is zero when the line doesn't exist in that version.
+//
+type DiffLine struct {
+	Mode                  diffparser.DiffLineMode
+	OrigNumber, NewNumber int
+	Content               string
+}
+
+func diffLineModeString(mode diffparser.DiffLineMode) string {
+	switch mode {
+	case diffparser.ADDED:
+		return "added"
+	case diffparser.REMOVED:
+		return "removed"
+	case diffparser.UNCHANGED:
+		return "unchanged"
+	default:
+		return fmt.Sprintf("unexpected line mode %d", int(mode))
+	}
+}
+
+func newDiffHunk(h *diffparser.DiffHunk) DiffHunk {
+	result := DiffHunk{
+		Header:     h.HunkHeader,
+		OrigStart:  h.OrigRange.Start,
+		OrigLength: h.OrigRange.Length,
+		NewStart:   h.NewRange.Start,
+		NewLength:  h.NewRange.Length,
+		Lines:      make([]DiffLine, 0, len(h.WholeRange.Lines)),
+	}
+
+	origNumber, newNumber := h.OrigRange.Start, h.NewRange.Start
+	for _, l := range h.WholeRange.Lines {
+		line := DiffLine{Mode: l.Mode, Content: l.Content}
+		if l.Mode != diffparser.ADDED {
+			line.OrigNumber = origNumber
+			origNumber++
+		}
+		if l.Mode != diffparser.REMOVED {
+			line.NewNumber = newNumber
+			newNumber++
+		}
+		result.Lines = append(result.Lines, line)
+	}
+	return result
+}
+
+// parseFileDiffs reads the output of a git diff command run with --raw,
+// --numstat and -p all at once. Git prints every file's raw line, then the
+// numstat lines, then the patches. Options like -w can leave a file out of the
+// latter two, so those are matched up with the raw lines by path.
+//
+func parseFileDiffs(output []byte) ([]FileDiff, error) {
+	var files []FileDiff
+	var patch bytes.Buffer
+	inPatch := false
+
+	for _, line := range strings.Split(string(output), "\n") {
+		if !inPatch && strings.HasPrefix(line, "diff ") {
+			inPatch = true
+		}
+		if inPatch {
+			patch.WriteString(line)
+			patch.WriteByte('\n')
+			continue
+		}
+
+		if match := reRawDiff.FindStringSubmatch(line); len(match) == 8 {
+			file := FileDiff{
+				FileChange: FileChange{Status: fileStatusFromLetter(match[5][0]), Path: match[6]},
+				OldMode:    match[1],
+				NewMode:    match[2],
+			}
+			if len(match[7]) > 0 {
+				file.OldPath, file.Path = match[6], match[7]
+			}
+			if file.Status == FILE_MODIFIED && match[3] == match[4] && file.OldMode != file.NewMode {
+				file.Status = FILE_MODE_CHANGED
+			}
+			if file.Status == FILE_ADDED {
+				file.OldMode = ""
+			} else if file.Status == FILE_DELETED {
+				file.NewMode = ""
+			}
+			files = append(files, file)
+		} else if match := reNumstat.FindStringSubmatch(line); len(match) == 3 {
+			file := findFileDiff(files, func(fd *FileDiff) bool { return fd.Path == numstatPath(line[len(match[0]):]) })
+			if file == nil {
+				return nil, fmt.Errorf("Diff has a numstat line for a file it didn't list: \"%s\"", line)
+			}
+			if match[1] == "-" {
+				file.Binary = true
+				continue
+			}
+			file.Added, _ = strconv.Atoi(match[1])
+			file.Deleted, _ = strconv.Atoi(match[2])
+		}
+	}
+
+	if patch.Len() > 0 {
+		parsed, err := diffparser.Parse(patch.String())
+		if err != nil {
+			return nil, err
+		}
+		for _, parsedFile := range parsed.Files {
+			header := strings.SplitN(parsedFile.DiffHeader, "\n", 2)[0]
+			file := findFileDiff(files, func(fd *FileDiff) bool { return header == fd.patchHeader() })
+			if file == nil {
+				return nil, fmt.Errorf("Diff has a patch for a file it didn't list: \"%s\"", header)
+			}
+			for _, hunk := range parsedFile.Hunks {
+				file.Hunks = append(file.Hunks, newDiffHunk(hunk))
+			}
+		}
+	}
+
+	return files, nil
+}
+
+func findFileDiff(files []FileDiff, predicate func(*FileDiff) bool) *FileDiff {
+	for i := range files {
+		if predicate(&files[i]) {
+			return &files[i]
+		}
+	}
+	return nil
+}
+
+func (fd *FileDiff) patchHeader() string {
+	oldPath := fd.OldPath
+	if len(oldPath) == 0 {
+		oldPath = fd.Path
+	}
+	return fmt.Sprintf("diff --git a/%s b/%s", oldPath, fd.Path)
+}
+
+// numstatPath picks the new name out of a numstat line's path, which for a
+// rename is written either "old => new" or "common/{old => new}/suffix".
+//
+func numstatPath(p string) string {
+	if open, arrow := strings.Index(p, "{"), strings.Index(p, " => "); open >= 0 && arrow > open {
+		if close := strings.Index(p[arrow:], "}"); close >= 0 {
+			result := p[:open] + p[arrow+4:arrow+close] + p[arrow+close+1:]
+			return strings.TrimPrefix(strings.Replace(result, "//", "/", -1), "/")
+		}
+	}
+	if arrow := strings.Index(p, " => "); arrow >= 0 {
+		return p[arrow+4:]
+	}
+	return p
+}
+
+// Diff compares the file at p (relative to the repository, and named as it is
+// at revision to) between revisions from and to. When opts.FollowRenames is
+// set and the file had a different name at from, that older file is what it
+// gets compared with.
+//
+func (repo *LocalGitRepo) Diff(from, to, p string, opts DiffOptions) (*FileDiff, error) {
+	optionArgs, err := opts.gitArgs()
+	if err != nil {
+		return nil, err
+	}
+	fromHash, err := repo.ResolveRevision(from)
+	if err != nil {
+		return nil, err
+	}
+	toHash, err := repo.ResolveRevision(to)
+	if err != nil {
+		return nil, err
+	}
+	if repo.isDirectoryAt(toHash.String(), p) || repo.isDirectoryAt(fromHash.String(), p) {
+		return nil, errorOfKind(ErrPathIsDirectory, "\"%s\" is a directory, so it has no diff of its own", p)
+	}
+
+	paths := []string{p}
+	if opts.FollowRenames {
+		oldPath, err := repo.nameBeforeRenames(fromHash, toHash, p)
+		if err != nil {
+			return nil, err
+		}
+		if oldPath != p {
+			paths = append(paths, oldPath)
+		}
+	}
+
+	// Porcelain diff goes by the user's diff.* config; these flags override
+	// whatever of it would change what parseFileDiffs reads.
+	args := []string{"-c", "core.quotepath=off", "diff", "--no-color", "--no-ext-diff", "--src-prefix=a/", "--dst-prefix=b/", "--raw", "--numstat", "-p"}
+	if opts.FollowRenames {
+		args = append(args, "-M")
+	} else {
+		args = append(args, "--no-renames")
+	}
+	args = append(append(append(args, optionArgs...), fromHash.String(), toHash.String(), "--"), paths...)
+	out, err := repo.runGit(args...)
+	if err != nil {
+		return nil, err
+	}
+	files, err := parseFileDiffs(out.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	file := findFileDiff(files, func(fd *FileDiff) bool { return fd.Path == p })
+	if file == nil {
+		return &FileDiff{FileChange: FileChange{Status: FILE_UNCHANGED, Path: p}}, nil
+	}
+	if file.Status == FILE_MODIFIED && len(file.Hunks) == 0 && !file.Binary {
+		// Whitespace options can hide every change git found.
+		file.Status = FILE_UNCHANGED
+	}
+	return file, nil
+}
+
+// nameBeforeRenames finds what the file called p at revision to was called
+// at revision from. If it doesn't exist at from under any name, the answer
+// is p itself.
+//
+func (repo *LocalGitRepo) nameBeforeRenames(from, to Hash, p string) (string, error) {
+	if _, err := repo.runGit("cat-file", "-e", fmt.Sprintf("%s:%s", from, p)); err == nil {
+		return p, nil
+	}
+
+	out, err := repo.runGit("-c", "core.quotepath=off", "diff", "--no-color", "--name-status", "-M", from.String(), to.String())
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(out.String(), "\n") {
+		match := reLogNameStatus.FindStringSubmatch(line)
+		if len(match) == 4 && match[1] == "R" && match[3] == p {
+			return match[2], nil
+		}
+	}
+	return p, nil
+}
+
+type diffLineForJSON struct {
+	Mode       string `json:"mode"`
+	OrigNumber int    `json:"origNumber,omitempty"`
+	NewNumber  int    `json:"newNumber,omitempty"`
+	Content    string `json:"content"`
+}
+
+type diffHunkForJSON struct {
+	Header     string            `json:"header"`
+	OrigStart  int               `json:"origStart"`
+	OrigLength int               `json:"origLength"`
+	NewStart   int               `json:"newStart"`
+	NewLength  int               `json:"newLength"`
+	Lines      []diffLineForJSON `json:"lines"`
+}
+
+type fileDiffForJSON struct {
+	fileChangeForJSON
+	OldMode string            `json:"oldMode,omitempty"`
+	NewMode string            `json:"newMode,omitempty"`
+	Added   int               `json:"added"`
+	Deleted int               `json:"deleted"`
+	Binary  bool              `json:"binary"`
+	Hunks   []diffHunkForJSON `json:"hunks"`
+}
+
+func (fd *FileDiff) ToJSON() ([]byte, error) {
+	return json.Marshal(fd.forJSON())
+}
+
+func (fd *FileDiff) forJSON() fileDiffForJSON {
+	facade := fileDiffForJSON{
+		fileChangeForJSON: fd.FileChange.forJSON(),
+		OldMode:           fd.OldMode,
+		NewMode:           fd.NewMode,
+		Added:             fd.Added,
+		Deleted:           fd.Deleted,
+		Binary:            fd.Binary,
+		Hunks:             []diffHunkForJSON{},
+	}
+	for _, hunk := range fd.Hunks {
+		hunkFacade := diffHunkForJSON{
+			Header:     hunk.Header,
+			OrigStart:  hunk.OrigStart,
+			OrigLength: hunk.OrigLength,
+			NewStart:   hunk.NewStart,
+			NewLength:  hunk.NewLength,
+			Lines:      make([]diffLineForJSON, 0, len(hunk.Lines)),
+		}
+		for _, line := range hunk.Lines {
+			hunkFacade.Lines = append(hunkFacade.Lines, diffLineForJSON{
+				Mode:       diffLineModeString(line.Mode),
+				OrigNumber: line.OrigNumber,
+				NewNumber:  line.NewNumber,
+				Content:    line.Content,
+			})
+		}
+		facade.Hunks = append(facade.Hunks, hunkFacade)
+	}
+	return facade
+}
@@ -0,0 +1,121 @@
+package api_test
+
+import (
+	"github.com/rbwinslow/morlock/api"
+	"github.com/rbwinslow/morlock/test_util"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/waigani/diffparser"
+)
+
+var _ = Describe("Two-revision diff", func() {
+	It("should compare revisions that aren't neighbors", func() {
+		// Given
+		test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+			tgr.MustAddFile("list.txt", "a\nb\nc\n")
+			first := tgr.MustCommit("first")
+			tgr.MustAddFile("list.txt", "a\nB\nc\n")
+			tgr.MustCommit("second")
+			tgr.MustAddFile("list.txt", "a\nB\nc\nd\n")
+			third := tgr.MustCommit("third")
+
+			// When
+			repo, err := api.OpenLocalGitRepo(tgr.Path, nil)
+			Expect(err).To(BeNil())
+			diff, err := repo.Diff(first.String(), third.String(), "list.txt", api.DiffOptions{})
+
+			// Then
+			Expect(err).To(BeNil())
+			Expect(diff.Status).To(Equal(api.FILE_MODIFIED))
+			Expect(diff.Added).To(Equal(2))
+			Expect(diff.Deleted).To(Equal(1))
+			Expect(diff.Hunks).To(HaveLen(1))
+			Expect(diff.Hunks[0].OrigStart).To(Equal(1))
+			Expect(diff.Hunks[0].NewLength).To(Equal(4))
+			Expect(diff.Hunks[0].Lines[len(diff.Hunks[0].Lines)-1]).To(Equal(api.DiffLine{Mode: diffparser.ADDED, NewNumber: 4, Content: "d"}))
+		})
+	})
+
+	It("should follow a rename when asked to", func() {
+		// Given
+		test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+			tgr.MustAddFile("before.txt", "one\ntwo\nthree\nfour\nfive\n")
+			first := tgr.MustCommit("first")
+			tgr.MustRun("mv", "before.txt", "after.txt")
+			tgr.MustAddFile("after.txt", "one\ntwo\nthree\nfour\nfive\nsix\n")
+			tgr.MustCommit("rename and append")
+
+			// When
+			repo, err := api.OpenLocalGitRepo(tgr.Path, nil)
+			Expect(err).To(BeNil())
+			followed, errFollowed := repo.Diff(first.String(), "HEAD", "after.txt", api.DiffOptions{FollowRenames: true})
+			unfollowed, errUnfollowed := repo.Diff(first.String(), "HEAD", "after.txt", api.DiffOptions{})
+
+			// Then
+			Expect(errFollowed).To(BeNil())
+			Expect(followed.Status).To(Equal(api.FILE_RENAMED))
+			Expect(followed.OldPath).To(Equal("before.txt"))
+			Expect(followed.Added).To(Equal(1))
+			Expect(followed.Deleted).To(BeZero())
+
+			Expect(errUnfollowed).To(BeNil())
+			Expect(unfollowed.Status).To(Equal(api.FILE_ADDED))
+			Expect(unfollowed.Added).To(Equal(6))
+		})
+	})
+
+	It("should read git's diffs the same whatever the user's diff config", func() {
+		// Given
+		test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+			tgr.MustAddFile("before.txt", "one\ntwo\nthree\nfour\nfive\n")
+			first := tgr.MustCommit("first")
+			tgr.MustRun("mv", "before.txt", "after.txt")
+			tgr.MustAddFile("after.txt", "one\ntwo\nthree\nfour\nfive\nsix\n")
+			tgr.MustCommit("rename and append")
+			tgr.MustRun("config", "diff.noprefix", "true")
+			tgr.MustRun("config", "diff.mnemonicPrefix", "true")
+			tgr.MustRun("config", "diff.renames", "false")
+
+			// When
+			repo, err := api.OpenLocalGitRepo(tgr.Path, nil)
+			Expect(err).To(BeNil())
+			diff, err := repo.Diff(first.String(), "HEAD", "after.txt", api.DiffOptions{FollowRenames: true})
+
+			// Then
+			Expect(err).To(BeNil())
+			Expect(diff.Status).To(Equal(api.FILE_RENAMED))
+			Expect(diff.OldPath).To(Equal("before.txt"))
+			Expect(diff.Hunks).To(HaveLen(1))
+			Expect(diff.Hunks[0].Lines[len(diff.Hunks[0].Lines)-1]).To(Equal(api.DiffLine{Mode: diffparser.ADDED, NewNumber: 6, Content: "six"}))
+		})
+	})
+
+	It("should ignore whitespace when asked to", func() {
+		// Given
+		test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+			tgr.MustAddFile("code.txt", "if x {\n\ty()\n}\n")
+			first := tgr.MustCommit("tabs")
+			tgr.MustAddFile("code.txt", "if x {\n    y()\n}\n")
+			second := tgr.MustCommit("spaces")
+
+			// When
+			repo, err := api.OpenLocalGitRepo(tgr.Path, nil)
+			Expect(err).To(BeNil())
+			exact, errExact := repo.Diff(first.String(), second.String(), "code.txt", api.DiffOptions{})
+			ignoring, errIgnoring := repo.Diff(first.String(), second.String(), "code.txt", api.DiffOptions{Whitespace: api.WHITESPACE_IGNORE_ALL, Algorithm: "histogram"})
+
+			// Then
+			Expect(errExact).To(BeNil())
+			Expect(exact.Added).To(Equal(1))
+			Expect(errIgnoring).To(BeNil())
+			Expect(ignoring.Status).To(Equal(api.FILE_UNCHANGED))
+			Expect(ignoring.Hunks).To(BeEmpty())
+		})
+	})
+
+	It("should reject an unknown algorithm", func() {
+		opts := api.DiffOptions{Algorithm: "telepathy"}
+		Expect(opts.Validate()).ToNot(BeNil())
+	})
+})
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The kinds of failure a caller might want to tell apart, with errors.Is. The
+// errors this package returns keep their own, more particular messages, and
+// wrap whichever of these they are a case of.
+//
+var (
+	ErrGitMissing      = errors.New("Git not installed")
+	ErrNotRepository   = errors.New("Not a git repository")
+	ErrPathNotFound    = errors.New("No such file")
+	ErrNotTracked      = errors.New("File not tracked")
+	ErrPathIsDirectory = errors.New("Path is a directory")
+	ErrBadRevision     = errors.New("Bad revision")
+	ErrBadCursor       = errors.New("Bad history cursor")
+)
+
+type kindedError struct {
+	kind    error
+	message string
+}
+
+func (ke *kindedError) Error() string {
+	return ke.message
+}
+
+func (ke *kindedError) Unwrap() error {
+	return ke.kind
+}
+
+// errorOfKind is an error with its own message that is still errors.Is kind.
+//
+func errorOfKind(kind error, format string, args ...interface{}) error {
+	return &kindedError{kind, fmt.Sprintf(format, args...)}
+}
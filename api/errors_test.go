@@ -0,0 +1,67 @@
+package api_test
+
+import (
+	"github.com/rbwinslow/morlock/api"
+	"github.com/rbwinslow/morlock/test_util"
+
+	"context"
+	"errors"
+	"os/exec"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Typed errors", func() {
+	It("should say when git isn't installed", func() {
+		// Given
+		mockFact := newCommandMockFactory()
+		mockFact.addExpectation(&exec.ExitError{}, "", "which", "git")
+
+		// When
+		_, err := api.OpenLocalGitRepo("/does/not/matter", mockFact.factoryFn())
+
+		// Then
+		Expect(errors.Is(err, api.ErrGitMissing)).To(BeTrue())
+	})
+
+	It("should say when a path isn't in a repository, without losing the path", func() {
+		_, err := api.OpenLocalGitRepo("/etc", nil)
+
+		Expect(errors.Is(err, api.ErrNotRepository)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("/etc"))
+	})
+
+	It("should tell bad revisions, bad cursors and missing files apart", func() {
+		test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+			// Given
+			tgr.MustAddFile("file.txt", "a\n")
+			tgr.MustCommit("first")
+			tgr.MustAddFile("gone.txt", "b\n")
+			tgr.MustCommit("second")
+			tgr.MustRun("rm", "-q", "gone.txt")
+			tgr.MustCommit("third")
+			repo, err := api.OpenLocalGitRepo(tgr.Path, nil)
+			Expect(err).To(BeNil())
+			ctx := context.Background()
+
+			// When
+			_, badRev := repo.ResolveRevision("no-such-branch")
+			_, badCursor := api.ParseHistoryCursor("nonsense")
+			_, missingBlob := repo.Blob("HEAD", "gone.txt")
+			_, _, missingHistory := repo.HistoryPage(ctx, "never.txt", api.HistoryOptions{}, "", 0)
+			_, missingTimelapse := repo.BuildTimelapse(ctx, "never.txt", api.TimelapseOptions{})
+			deleted, _, deletedErr := repo.HistoryPage(ctx, "gone.txt", api.HistoryOptions{}, "", 0)
+
+			// Then
+			Expect(errors.Is(badRev, api.ErrBadRevision)).To(BeTrue())
+			Expect(badRev.Error()).To(Equal(`Bad revision "no-such-branch"`))
+			Expect(errors.Is(badCursor, api.ErrBadCursor)).To(BeTrue())
+			Expect(errors.Is(missingBlob, api.ErrPathNotFound)).To(BeTrue())
+			Expect(errors.Is(missingHistory, api.ErrPathNotFound)).To(BeTrue())
+			Expect(errors.Is(missingTimelapse, api.ErrPathNotFound)).To(BeTrue())
+			Expect(deletedErr).To(BeNil())
+			Expect(deleted).To(HaveLen(2))
+		})
+	})
+})
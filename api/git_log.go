@@ -0,0 +1,169 @@
+package api
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	reLogCommit     = regexp.MustCompile(`^commit ([[:xdigit:]]{40})$`)
+	reLogAuthor     = regexp.MustCompile(`^Author:\s+(.+)$`)
+	reLogDate       = regexp.MustCompile(`^Date:\s+(\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(?:Z|[-+]\d{2}:\d{2}))$`)
+	reLogNameStatus = regexp.MustCompile(`^([ACDMRTU])\d*\t([^\t]+)(?:\t([^\t]+))?$`)
+)
+
+// FileStatus describes what a commit did to a single file, as reported by
+// git's --name-status output.
+//
+type FileStatus int
+
+const (
+	FILE_ADDED FileStatus = iota
+	FILE_MODIFIED
+	FILE_DELETED
+	FILE_RENAMED
+	FILE_COPIED
+	FILE_TYPE_CHANGED
+	FILE_UNMERGED
+	FILE_MODE_CHANGED
+	FILE_UNCHANGED
+)
+
+func (s FileStatus) String() string {
+	switch s {
+	case FILE_ADDED:
+		return "added"
+	case FILE_MODIFIED:
+		return "modified"
+	case FILE_DELETED:
+		return "deleted"
+	case FILE_RENAMED:
+		return "renamed"
+	case FILE_COPIED:
+		return "copied"
+	case FILE_TYPE_CHANGED:
+		return "type changed"
+	case FILE_UNMERGED:
+		return "unmerged"
+	case FILE_MODE_CHANGED:
+		return "mode changed"
+	case FILE_UNCHANGED:
+		return "unchanged"
+	default:
+		return fmt.Sprintf("unexpected file status %d", int(s))
+	}
+}
+
+func fileStatusFromLetter(letter byte) FileStatus {
+	switch letter {
+	case 'A':
+		return FILE_ADDED
+	case 'D':
+		return FILE_DELETED
+	case 'R':
+		return FILE_RENAMED
+	case 'C':
+		return FILE_COPIED
+	case 'T':
+		return FILE_TYPE_CHANGED
+	case 'U':
+		return FILE_UNMERGED
+	default:
+		return FILE_MODIFIED
+	}
+}
+
+// FileChange is one line of a commit's --name-status listing. OldPath is only
+// set for renames and copies, and Path is always the file's name after the
+// commit.
+//
+type FileChange struct {
+	Status  FileStatus
+	Path    string
+	OldPath string
+}
+
+func (fc *FileChange) forJSON() fileChangeForJSON {
+	return fileChangeForJSON{
+		Status:  fc.Status.String(),
+		Path:    fc.Path,
+		OldPath: fc.OldPath,
+	}
+}
+
+type fileChangeForJSON struct {
+	Status  string `json:"status"`
+	Path    string `json:"path"`
+	OldPath string `json:"oldPath,omitempty"`
+}
+
+// parseLog reads the output of `git log --date iso-strict` (optionally with
+// --name-status or --numstat) and calls emit once per commit, in the order git printed
+// them. The Commit passed to emit is not reused afterward.
+//
+func parseLog(r io.Reader, emit func(*Commit)) error {
+	var commit *Commit
+	var err error
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(line) == 0 {
+			continue
+		}
+		if match := reLogCommit.FindStringSubmatch(line); len(match) == 2 {
+			if commit != nil {
+				emit(commit)
+			}
+			commit = new(Commit)
+			copy(commit.Hash[:], []byte(match[1]))
+			continue
+		}
+		if commit == nil {
+			return fmt.Errorf("Unexpected git log output before first commit: \"%s\"", line)
+		}
+
+		if strings.HasPrefix(line, "    ") {
+			line = line[4:]
+			if len(commit.Desc) > 0 {
+				commit.Desc = fmt.Sprintf("%s\n%s", commit.Desc, line)
+			} else {
+				commit.Desc = line
+			}
+		} else if match := reLogAuthor.FindStringSubmatch(line); len(match) == 2 {
+			commit.Author = match[1]
+		} else if match := reLogDate.FindStringSubmatch(line); len(match) == 2 {
+			commit.Date, err = time.Parse(time.RFC3339, match[1])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "ERROR: Couldn't parse commit date %s\n", match[1])
+			}
+		} else if match := reLogNameStatus.FindStringSubmatch(line); len(match) == 4 {
+			change := FileChange{Status: fileStatusFromLetter(match[1][0]), Path: match[2]}
+			if len(match[3]) > 0 {
+				change.OldPath, change.Path = match[2], match[3]
+			}
+			commit.Changes = append(commit.Changes, change)
+		} else if match := reNumstat.FindStringSubmatch(line); len(match) == 3 {
+			if match[1] == "-" {
+				commit.Binary = true
+				continue
+			}
+			added, _ := strconv.Atoi(match[1])
+			removed, _ := strconv.Atoi(match[2])
+			commit.LinesAdded += added
+			commit.LinesRemoved += removed
+		}
+	}
+
+	if commit != nil {
+		emit(commit)
+	}
+
+	return scanner.Err()
+}
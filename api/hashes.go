@@ -26,13 +26,26 @@ func (h Hash) String() string {
 	return string(h[:])
 }
 
-func MustBeHash(s string) (result Hash) {
+// ParseHash reads a full 40-digit hash, surrounded by nothing but spaces.
+//
+func ParseHash(s string) (result Hash, err error) {
 	s = strings.Trim(s, " ")
-	if !HashRE.Match([]byte(s)) {
-		panic(fmt.Sprintf("MustBeHash wasn't: \"%s\" doesn't look like a git hash", s))
+	if len(s) != len(result) || !HashRE.MatchString(s) {
+		return result, fmt.Errorf("\"%s\" doesn't look like a git hash", s)
 	}
 	copy(result[:], []byte(s))
-	return
+	return result, nil
+}
+
+// MustBeHash is ParseHash for strings that can only be hashes, like the ones
+// git just printed; it panics when they aren't.
+//
+func MustBeHash(s string) Hash {
+	result, err := ParseHash(s)
+	if err != nil {
+		panic(fmt.Sprintf("MustBeHash wasn't: %s", err))
+	}
+	return result
 }
 
 type ShortHash [7]byte
@@ -0,0 +1,34 @@
+package api_test
+
+import (
+	"github.com/rbwinslow/morlock/api"
+
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Hashes", func() {
+	var full = "0123456789abcdef0123456789abcdef01234567"
+
+	It("should parse a full hash", func() {
+		hash, err := api.ParseHash(" " + full + " ")
+
+		Expect(err).To(BeNil())
+		Expect(hash.String()).To(Equal(full))
+	})
+
+	It("should refuse anything else", func() {
+		for _, bad := range []string{"", full[:39], full + "8", "z" + full[1:], "commit " + full} {
+			_, err := api.ParseHash(bad)
+
+			Expect(err).ToNot(BeNil(), bad)
+		}
+	})
+
+	It("should panic when a hash has to be a hash but isn't", func() {
+		Expect(func() { api.MustBeHash(strings.ToUpper("nope")) }).To(Panic())
+		Expect(api.MustBeHash(full).String()).To(Equal(full))
+	})
+})
@@ -1,19 +1,19 @@
 package api
 
 import (
-	"bufio"
 	"bytes"
+	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path"
-	"regexp"
 	"time"
 	"encoding/json"
 	"io/ioutil"
-	"github.com/waigani/diffparser"
+	"strconv"
 	"strings"
 )
 
@@ -89,14 +89,14 @@ func OpenLocalGitRepo(p string, cmdFn CommandFn) (*LocalGitRepo, error) {
 
 	gitpath, ok := findClosestRepoDir(p)
 	if !ok {
-		return nil, fmt.Errorf("Could not find git repository at [%s]", p)
+		return nil, errorOfKind(ErrNotRepository, "Could not find git repository at [%s]", p)
 	}
 
 	var stdout, stderr bytes.Buffer
 	cmd := cmdFn(nil, &stdout, &stderr, gitpath, "git", "status")
 
 	if err := cmd.Run(); err != nil {
-		return nil, CookedErrorFromGitExec(&stdout, &stderr, err)
+		return nil, errorOfKind(ErrNotRepository, "%s", CookedErrorFromGitExec(&stdout, &stderr, err))
 	}
 
 	return &LocalGitRepo{Path: gitpath}, nil
@@ -109,169 +109,646 @@ type LocalGitRepo struct {
 	Path string
 }
 
+// runGit runs a git command in the repository and hands back everything it
+// wrote to stdout.
+//
+func (repo *LocalGitRepo) runGit(args ...string) (*bytes.Buffer, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = repo.Path
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, CookedErrorFromGitExec(stdout, stderr, err)
+	}
+	return stdout, nil
+}
+
+// ResolveRevision turns anything git accepts as a revision (a branch, a tag,
+// an abbreviated hash, HEAD~3...) into the full hash of the commit it names.
+//
+func (repo *LocalGitRepo) ResolveRevision(rev string) (Hash, error) {
+	var result Hash
+	if len(rev) == 0 || strings.HasPrefix(rev, "-") {
+		return result, errorOfKind(ErrBadRevision, "Bad revision \"%s\"", rev)
+	}
+
+	out, err := repo.runGit("rev-parse", "--verify", "--quiet", rev+"^{commit}")
+	if err != nil {
+		return result, errorOfKind(ErrBadRevision, "Bad revision \"%s\"", rev)
+	}
+	copy(result[:], strings.TrimSpace(out.String()))
+	return result, nil
+}
+
+// DefaultBranch is the branch a clone of the repository would start out on:
+// the one origin's HEAD points at, when there's an origin that says, and
+// otherwise the one checked out. It's empty when HEAD is detached and there's
+// nothing else to go by.
+//
+func (repo *LocalGitRepo) DefaultBranch() string {
+	if out, err := repo.runGit("symbolic-ref", "--quiet", "--short", "refs/remotes/origin/HEAD"); err == nil {
+		return strings.TrimPrefix(strings.TrimSpace(out.String()), "origin/")
+	}
+	if out, err := repo.runGit("symbolic-ref", "--quiet", "--short", "HEAD"); err == nil {
+		return strings.TrimSpace(out.String())
+	}
+	return ""
+}
+
+// TrackedFiles lists the files under dir (relative to the repository; empty
+// for all of it) that are in the HEAD commit.
+//
+func (repo *LocalGitRepo) TrackedFiles(dir string) ([]string, error) {
+	if len(dir) == 0 {
+		dir = "."
+	}
+	out, err := repo.runGit("-c", "core.quotepath=off", "ls-tree", "-r", "-z", "--name-only", "HEAD", "--", dir)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	for _, name := range strings.Split(out.String(), "\x00") {
+		if len(name) > 0 {
+			files = append(files, name)
+		}
+	}
+	return files, nil
+}
+
 func (repo *LocalGitRepo) History(path string) (chan Commit, error) {
-	cmd := exec.Command("git", "log", "--follow", "--no-color", "--date", "iso-strict", "--", path)
+	walk, err := repo.WalkHistory(context.Background(), path, HistoryOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return walk.Commits, nil
+}
+
+// HistoryOptions narrow down which of a file's commits WalkHistory produces.
+// Zero values don't restrict anything. Author and Message are extended
+// regular expressions, which git matches against the author's name and email
+// and against the commit message. Start is the revision to walk back from, and
+// defaults to HEAD. Skip and Limit are applied after all of the other filters.
+//
+type HistoryOptions struct {
+	Since, Until time.Time
+	Author       string
+	Message      string
+	Start        string
+	Skip, Limit  int
+}
+
+func (opts *HistoryOptions) gitArgs() []string {
+	var args []string
+	if !opts.Since.IsZero() {
+		args = append(args, "--since="+opts.Since.Format(time.RFC3339))
+	}
+	if !opts.Until.IsZero() {
+		args = append(args, "--until="+opts.Until.Format(time.RFC3339))
+	}
+	if len(opts.Author) > 0 {
+		args = append(args, "--author="+opts.Author)
+	}
+	if len(opts.Message) > 0 {
+		args = append(args, "--grep="+opts.Message)
+	}
+	if len(opts.Author) > 0 || len(opts.Message) > 0 {
+		args = append(args, "--extended-regexp")
+	}
+	return args
+}
+
+// A HistoryWalk streams commits from a running `git log`. Read Commits until
+// it's closed, then check Err. To stop early, cancel the context the walk was
+// started with; otherwise the walk waits for Commits to be drained.
+//
+type HistoryWalk struct {
+	Commits chan Commit
+	err     error
+	done    chan struct{}
+}
+
+func (hw *HistoryWalk) Err() error {
+	<-hw.done
+	return hw.err
+}
+
+// WalkHistory starts streaming the commits that touched path, newest first,
+// following it across renames.
+//
+func (repo *LocalGitRepo) WalkHistory(ctx context.Context, path string, opts HistoryOptions) (*HistoryWalk, error) {
+	if strings.HasPrefix(opts.Start, "-") {
+		return nil, errorOfKind(ErrBadRevision, "Bad revision \"%s\"", opts.Start)
+	}
+	start := opts.Start
+	if len(start) == 0 {
+		start = "HEAD"
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	args := append([]string{"log", "--follow", "--no-color", "--date", "iso-strict", "--numstat"}, opts.gitArgs()...)
+	cmd := exec.CommandContext(ctx, "git", append(args, start, "--", pathspec(path))...)
 	cmd.Dir = repo.Path
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
 
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		cancel()
 		return nil, err
 	}
 
-	out := make(chan Commit)
-	done := make(chan struct{})
-	scanner := bufio.NewScanner(stdout)
+	walk := &HistoryWalk{Commits: make(chan Commit), done: make(chan struct{})}
 
 	go func() {
-		reCommit := regexp.MustCompile(`^commit ([[:xdigit:]]{40})$`)
-		reAuthor := regexp.MustCompile(`^Author:\s+(.+)$`)
-		reDate := regexp.MustCompile(`^Date:\s+(\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}-\d{2}:\d{2})$`)
-		var commit *Commit
-
-		defer close(out)
-		defer func() {
-			done <- struct{}{}
-		}()
-
-		for scanner.Scan() {
-			line := scanner.Text()
-			if len(line) == 0 {
-				continue
+		defer close(walk.done)
+		defer close(walk.Commits)
+		defer cancel()
+
+		seen, sent := 0, 0
+		reachedLimit := false
+		parseErr := parseLog(stdout, func(commit *Commit) {
+			seen++
+			if seen <= opts.Skip || reachedLimit {
+				return
 			}
-			match := reCommit.FindStringSubmatch(line)
-			if len(match) == 2 {
-				if commit != nil {
-					out <- *commit
-				}
-				commit = new(Commit)
-				copy(commit.Hash[:], []byte(match[1]))
-			} else {
-				match = reAuthor.FindStringSubmatch(line)
-				if len(match) == 2 {
-					commit.Author = match[1]
-				} else {
-					match = reDate.FindStringSubmatch(line)
-					if len(match) == 2 {
-						commit.Date, err = time.Parse(time.RFC3339, match[1])
-						if err != nil {
-							fmt.Fprintf(os.Stdout, "ERROR: Couldn't parse commit date %s\n", match[1])
-						}
-					} else {
-						if line[:4] == "    " {
-							line = line[4:]
-						}
-						if len(commit.Desc) > 0 {
-							commit.Desc = fmt.Sprintf("%s\n%s", commit.Desc, line)
-						} else {
-							commit.Desc = line
-						}
-					}
-				}
+			select {
+			case walk.Commits <- *commit:
+				sent++
+			case <-ctx.Done():
+			}
+			if opts.Limit > 0 && sent >= opts.Limit {
+				reachedLimit = true
+				cancel()
 			}
+		})
+
+		waitErr := cmd.Wait()
+		switch {
+		case reachedLimit:
+		case ctx.Err() != nil:
+			walk.err = ctx.Err()
+		case waitErr != nil:
+			walk.err = CookedErrorFromGitExec(nil, stderr, waitErr)
+		default:
+			walk.err = parseErr
 		}
+	}()
 
-		if commit != nil {
-			out <- *commit
-		}
+	return walk, nil
+}
 
-		if err := scanner.Err(); err != nil {
-			fmt.Fprintf(os.Stderr, "ERROR reading git command's stdout: %v\n", err)
+type historyStreamEndForJSON struct {
+	Done  bool   `json:"done"`
+	Count int    `json:"count"`
+	Error string `json:"error,omitempty"`
+}
+
+// WriteNDJSON streams the walk's commits to w as newline-delimited JSON, one
+// commit per line, calling flush (when it isn't nil) after each one. The last
+// line is always a record with "done" set to true, the number of commits
+// written, and "error" if the walk failed partway. The returned error is only
+// about writing to w.
+//
+func (hw *HistoryWalk) WriteNDJSON(w io.Writer, flush func()) error {
+	encoder := json.NewEncoder(w)
+	count := 0
+	var writeErr error
+	for c := range hw.Commits {
+		if writeErr != nil {
+			continue
 		}
-	}()
+		if writeErr = encoder.Encode(c.forJSON()); writeErr != nil {
+			continue
+		}
+		count++
+		if flush != nil {
+			flush()
+		}
+	}
+	if writeErr != nil {
+		return writeErr
+	}
 
-	go func() {
-		defer stdout.Close()
-		err := cmd.Start()
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "Error starting command", err)
-			return
+	end := historyStreamEndForJSON{Done: true, Count: count}
+	if err := hw.Err(); err != nil {
+		end.Error = err.Error()
+	}
+	if err := encoder.Encode(end); err != nil {
+		return err
+	}
+	if flush != nil {
+		flush()
+	}
+	return nil
+}
+
+// HistoryPage returns up to limit commits from a file's history, beginning
+// where a previous page's cursor left off (or at the newest commit when the
+// cursor is empty). The returned cursor fetches the next page, and is empty
+// once there are no more commits. Cursors pin the walk to the commit the first
+// page started from, so new commits don't shift later pages. A path that
+// isn't on disk and never was in the history is ErrPathNotFound, and one that
+// is on disk but was never committed is ErrNotTracked.
+//
+func (repo *LocalGitRepo) HistoryPage(ctx context.Context, path string, opts HistoryOptions, cursor string, limit int) (CommitList, string, error) {
+	var position HistoryCursor
+	var err error
+	if len(cursor) > 0 {
+		if position, err = ParseHistoryCursor(cursor); err != nil {
+			return nil, "", err
 		}
+	} else {
+		start := opts.Start
+		if len(start) == 0 {
+			start = "HEAD"
+		}
+		if position.Anchor, err = repo.ResolveRevision(start); err != nil {
+			return nil, "", err
+		}
+	}
 
-		<-done
+	opts.Start = position.Anchor.String()
+	opts.Skip = position.Offset
+	if limit > 0 {
+		opts.Limit = limit + 1
+	}
+	walk, err := repo.WalkHistory(ctx, path, opts)
+	if err != nil {
+		return nil, "", err
+	}
 
-		err = cmd.Wait()
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "Error waiting for command completion:", err)
+	commits := CommitList{}
+	for c := range walk.Commits {
+		commits = append(commits, c)
+	}
+	if err := walk.Err(); err != nil {
+		return nil, "", err
+	}
+	if len(commits) == 0 && len(cursor) == 0 {
+		if err := repo.CheckTracked(path); err != nil {
+			return nil, "", err
 		}
-	}()
+	}
+
+	if limit > 0 && len(commits) > limit {
+		commits = commits[:limit]
+		next := HistoryCursor{Anchor: position.Anchor, Offset: position.Offset + limit}
+		return commits, next.String(), nil
+	}
+	return commits, "", nil
+}
+
+// CheckTracked says why p has no history to show, if it has none: it's
+// ErrNotTracked when p is on disk but was never committed, and
+// ErrPathNotFound when it isn't there either.
+//
+func (repo *LocalGitRepo) CheckTracked(p string) error {
+	if _, found, err := repo.TimelapseAnchor(p); err != nil {
+		return err
+	} else if !found {
+		return repo.untrackedError(p)
+	}
+	return nil
+}
+
+// untrackedError is why p, which has no history, can't be shown:
+// ErrNotTracked when it's on disk all the same, and ErrPathNotFound when it
+// isn't.
+//
+func (repo *LocalGitRepo) untrackedError(p string) error {
+	if _, err := os.Stat(path.Join(repo.Path, p)); err == nil {
+		return errorOfKind(ErrNotTracked, "\"%s\" has never been committed", p)
+	}
+	return errorOfKind(ErrPathNotFound, "No file \"%s\" in the repository or its history", p)
+}
+
+// HistoryCursor marks a place in a paginated history walk.
+//
+type HistoryCursor struct {
+	Anchor Hash
+	Offset int
+}
 
-	return out, nil
+func (hc HistoryCursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%d", hc.Anchor, hc.Offset)))
+}
+
+func ParseHistoryCursor(s string) (HistoryCursor, error) {
+	var result HistoryCursor
+	decoded, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return result, errorOfKind(ErrBadCursor, "Bad history cursor \"%s\"", s)
+	}
+	parts := strings.SplitN(string(decoded), ":", 2)
+	if len(parts) != 2 {
+		return result, errorOfKind(ErrBadCursor, "Bad history cursor \"%s\"", s)
+	}
+	if result.Anchor, err = ParseHash(parts[0]); err != nil {
+		return result, errorOfKind(ErrBadCursor, "Bad history cursor \"%s\"", s)
+	}
+	if result.Offset, err = strconv.Atoi(parts[1]); err != nil || result.Offset < 0 {
+		return result, errorOfKind(ErrBadCursor, "Bad history cursor \"%s\"", s)
+	}
+	return result, nil
 }
 
 func (repo *LocalGitRepo) Timelapse(p string) (Timelapse, error) {
-	var result Timelapse = Timelapse{}
+	return repo.BuildTimelapse(context.Background(), p, TimelapseOptions{})
+}
+
+// TimelapseProgress reports how far a timelapse has gotten. Commit is the
+// commit that was just worked into the timelapse, and Processed counts it;
+// Partial is the timelapse as it stood at Commit. Partial shares its lines
+// with the frames that come after it, so it mustn't be modified.
+//
+type TimelapseProgress struct {
+	Commit
+	Processed, Total int
+	Partial          Timelapse
+}
+
+// TimelapseOptions tune BuildTimelapse. When Progress isn't nil, it's called
+// after each commit is worked into the timelapse. Concurrency is how many
+// diffs may be fetched from git at once; zero means one at a time, since
+// fetching more hasn't been measured to help (see the README). Neither
+// changes the timelapse that comes out.
+//
+type TimelapseOptions struct {
+	Progress    func(TimelapseProgress)
+	Concurrency int
+}
 
-	contents, err := ioutil.ReadFile(path.Join(repo.Path, p))
+func (opts TimelapseOptions) concurrency() int {
+	if opts.Concurrency > 0 {
+		return opts.Concurrency
+	}
+	return 1
+}
+
+// BuildTimelapse works forward through a file's history, from the commit that
+// created it up to the newest commit that touched it, recording every line
+// that was ever deleted. A file that has never been committed is taken as it
+// is on disk. It gives up with the context's error when ctx is cancelled.
+//
+func (repo *LocalGitRepo) BuildTimelapse(ctx context.Context, p string, opts TimelapseOptions) (Timelapse, error) {
+	anchor, found, err := repo.TimelapseAnchor(p)
 	if err != nil {
 		return nil, err
 	}
-	result = append(result, TimelapseHunk{PRESENT, strings.Split(string(contents), "\n")})
+	if !found {
+		return repo.buildTimelapseAt(ctx, p, nil, opts)
+	}
+	return repo.buildTimelapseAt(ctx, p, &anchor, opts)
+}
+
+// TimelapseAnchor finds the newest commit that touched p. A file's timelapse
+// can't change until its anchor does, which makes the anchor a good thing to
+// remember a timelapse by. found is false when p has no history at all.
+//
+func (repo *LocalGitRepo) TimelapseAnchor(p string) (anchor Hash, found bool, err error) {
+	return repo.timelapseAnchorAt(p, "HEAD")
+}
 
-	hist, err := repo.History(p)
+// timelapseAnchorAt is TimelapseAnchor as of rev, which must be safe to pass
+// to git as a revision.
+//
+func (repo *LocalGitRepo) timelapseAnchorAt(p, rev string) (anchor Hash, found bool, err error) {
+	out, err := repo.runGit("log", "-1", "--format=%H", rev, "--", pathspec(p))
 	if err != nil {
-		return nil, err
+		return anchor, false, err
 	}
+	hash := strings.TrimSpace(out.String())
+	if len(hash) == 0 {
+		return anchor, false, nil
+	}
+	if anchor, err = ParseHash(hash); err != nil {
+		return anchor, false, err
+	}
+	return anchor, true, nil
+}
 
-	newerCommit := ""
-	for c := range hist {
-		hash := c.Hash.String()
-		if len(newerCommit) == 0 {
-			newerCommit = hash
-			continue
-		}
+// pathspec is how to name p, relative to the top of the repository, to git,
+// which won't take an empty path for the top itself.
+//
+func pathspec(p string) string {
+	if len(p) == 0 {
+		return "."
+	}
+	return p
+}
 
-		cmd := exec.Command("git", "diff", hash, newerCommit, "--", p)
-		cmd.Dir = repo.Path
-		obuf := bytes.Buffer{}
-		ebuf := bytes.Buffer{}
-		cmd.Stdout = &obuf
-		cmd.Stderr = &ebuf
+// isDirectoryAt says whether p is a directory as of rev, which must be safe
+// to pass to git as a revision. A path that isn't there at all isn't one.
+//
+func (repo *LocalGitRepo) isDirectoryAt(rev, p string) bool {
+	if len(p) == 0 || p == "." {
+		return true
+	}
+	out, err := repo.runGit("cat-file", "-t", fmt.Sprintf("%s:%s", rev, p))
+	return err == nil && strings.TrimSpace(out.String()) == "tree"
+}
 
-		err = cmd.Run()
-		if err != nil {
+// ExtendTimelapse brings forward tl, a timelapse of p as of the commit from,
+// so that it's as of the commit to instead. Only the commits in between are
+// worked in, and the result is the same as building the timelapse from
+// scratch. tl itself is left alone. from must be an ancestor of to.
+//
+func (repo *LocalGitRepo) ExtendTimelapse(ctx context.Context, p string, tl Timelapse, from, to Hash, opts TimelapseOptions) (Timelapse, error) {
+	ancestor, err := repo.isAncestor(from, to)
+	if err != nil {
+		return nil, err
+	}
+	if !ancestor {
+		return nil, fmt.Errorf("Can't extend a timelapse from %s to %s, which doesn't descend from it", from, to)
+	}
+	return repo.extendTimelapse(ctx, p, tl, &from, to, opts)
+}
+
+func (repo *LocalGitRepo) buildTimelapseAt(ctx context.Context, p string, anchor *Hash, opts TimelapseOptions) (Timelapse, error) {
+	if anchor == nil {
+		if info, err := os.Stat(path.Join(repo.Path, p)); err == nil && info.IsDir() {
+			return nil, errorOfKind(ErrPathIsDirectory, "\"%s\" is a directory, which has no timelapse of its own", p)
+		}
+		contents, err := ioutil.ReadFile(path.Join(repo.Path, p))
+		if os.IsNotExist(err) {
+			return nil, errorOfKind(ErrPathNotFound, "No file \"%s\" in the repository or its history", p)
+		} else if err != nil {
 			return nil, err
 		}
+		lines := splitLines(string(contents))
+		if len(lines) == 0 {
+			return Timelapse{}, nil
+		}
+		return Timelapse{TimelapseHunk{PRESENT, lines}}, nil
+	}
+	if repo.isDirectoryAt(anchor.String(), p) {
+		return nil, errorOfKind(ErrPathIsDirectory, "\"%s\" is a directory, which has no timelapse of its own", p)
+	}
+	return repo.extendTimelapse(ctx, p, Timelapse{}, nil, *anchor, opts)
+}
 
-		parsed, err := diffparser.Parse(obuf.String())
+// extendTimelapse works every commit that touched p after from (or since the
+// beginning, when from is nil) up to and including to into tl.
+//
+func (repo *LocalGitRepo) extendTimelapse(ctx context.Context, p string, tl Timelapse, from *Hash, to Hash, opts TimelapseOptions) (Timelapse, error) {
+	walkOpts := HistoryOptions{Start: to.String()}
+	older := ""
+	if from != nil {
+		walkOpts.Start = fmt.Sprintf("%s..%s", from, to)
+		older = from.String()
+	} else {
+		emptyTree, err := repo.runGit("hash-object", "-t", "tree", os.DevNull)
 		if err != nil {
 			return nil, err
 		}
+		older = strings.TrimSpace(emptyTree.String())
+	}
 
-		if len(parsed.Files) == 0 {
-			fmt.Println("WTF? No files!")
-			continue
+	walk, err := repo.WalkHistory(ctx, p, walkOpts)
+	if err != nil {
+		return nil, err
+	}
+	var commits CommitList
+	for c := range walk.Commits {
+		commits = append(commits, c)
+	}
+	if err := walk.Err(); err != nil {
+		return nil, err
+	}
+
+	revs := []string{older}
+	for i := len(commits) - 1; i >= 0; i-- {
+		revs = append(revs, commits[i].Hash.String())
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	lines := lineInterner{}
+	diffs, release := repo.fetchTimelapseDiffs(ctx, p, revs, opts.concurrency())
+	for i, diff := range diffs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
 		}
-		for _, hunk := range parsed.Files[0].Hunks {
-			nav, err := newDiffRNA(hunk.OrigRange.Lines, hunk.NewRange.Lines, &result)
-			if err != nil {
-				return nil, err
-			}
-			err = nav.transcribe()
-			if err != nil {
-				return nil, err
+		var result timelapseDiffResult
+		select {
+		case result = <-diff:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		release()
+		if result.err != nil {
+			return nil, result.err
+		}
+		commit := commits[len(commits)-1-i]
+		if tl, err = transcribeHunks(tl, result.hunks, lines); err != nil {
+			if te, ok := err.(*TimelapseError); ok {
+				te.Path, te.Commit = p, commit.Hash
 			}
+			return nil, err
 		}
+		reportTimelapseProgress(opts, commit, i+1, len(commits), tl)
+	}
 
-		newerCommit = hash
+	return tl, nil
+}
+
+// isAncestor asks git whether ancestor is reachable from descendant. A commit
+// counts as its own ancestor.
+//
+func (repo *LocalGitRepo) isAncestor(ancestor, descendant Hash) (bool, error) {
+	cmd := exec.Command("git", "merge-base", "--is-ancestor", ancestor.String(), descendant.String())
+	cmd.Dir = repo.Path
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+
+	err := cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+		return false, nil
+	}
+	if err != nil {
+		return false, CookedErrorFromGitExec(nil, stderr, err)
 	}
+	return true, nil
+}
 
-	return result, nil
+// splitLines breaks text into lines the way diffs count them, so that a final
+// newline doesn't make an empty last line.
+//
+func splitLines(text string) []string {
+	if len(text) == 0 {
+		return []string{}
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+type timelapseProgressForJSON struct {
+	Processed int           `json:"processed"`
+	Total     int           `json:"total"`
+	Commit    commitForJSON `json:"commit"`
+}
+
+// ToJSON describes how far along the timelapse is, without the partial
+// timelapse itself.
+//
+func (tp *TimelapseProgress) ToJSON() ([]byte, error) {
+	return json.Marshal(timelapseProgressForJSON{tp.Processed, tp.Total, *tp.Commit.forJSON()})
 }
 
+func reportTimelapseProgress(opts TimelapseOptions, c Commit, processed, total int, partial Timelapse) {
+	if opts.Progress != nil {
+		opts.Progress(TimelapseProgress{Commit: c, Processed: processed, Total: total, Partial: partial})
+	}
+}
+
+// Commit is one entry in a file's history. LinesAdded and LinesRemoved count
+// what the commit did to the file; when git considered the change binary they
+// stay zero and Binary is set instead, and the JSON leaves them out.
+//
 type Commit struct {
 	Hash
-	Author string
-	Date   time.Time
-	Desc   string
+	Author       string
+	Date         time.Time
+	Desc         string
+	LinesAdded   int
+	LinesRemoved int
+	Binary       bool
+	Changes      []FileChange
+}
+
+// Subject is the first line of the commit's message.
+//
+func (c *Commit) Subject() string {
+	if i := strings.IndexByte(c.Desc, '\n'); i >= 0 {
+		return c.Desc[:i]
+	}
+	return c.Desc
 }
 
 func (c *Commit) forJSON() *commitForJSON {
-	return &commitForJSON{
+	var changes []fileChangeForJSON
+	for _, change := range c.Changes {
+		changes = append(changes, change.forJSON())
+	}
+	facade := &commitForJSON{
 		Hash: c.Hash.String(),
 		Author: c.Author,
 		Date: c.Date,
 		Desc: c.Desc,
+		Binary: c.Binary,
+		Changes: changes,
+	}
+	if !c.Binary {
+		added, removed := c.LinesAdded, c.LinesRemoved
+		facade.LinesAdded, facade.LinesRemoved = &added, &removed
 	}
+	return facade
 }
 
 type TimelapseHunk struct {
@@ -292,19 +769,49 @@ func (h TimelapseHunk) String() string {
 	return fmt.Sprintf("%s: \"%s\"", disp, strings.Join(h.Lines, "\\n"))
 }
 
+// Timelapse is every line a file has ever had, in order, each marked PRESENT
+// or DELETED. Neighboring hunks can share a disposition: a hunk is a run of
+// lines that has stayed together since it arrived, so the edits a file went
+// through show in where its hunks break.
+//
 type Timelapse []TimelapseHunk
 
+type timelapseHunkForJSON struct {
+	Disposition string	`json:"disposition"`
+	Lines []string		`json:"lines"`
+}
+
+func (tl *Timelapse) ToJSON() ([]byte, error) {
+	return json.Marshal(tl.forJSON())
+}
+
+func (tl *Timelapse) forJSON() []timelapseHunkForJSON {
+	facades := []timelapseHunkForJSON{}
+	for _, hunk := range *tl {
+		disp := "present"
+		if hunk.Disposition == DELETED {
+			disp = "deleted"
+		}
+		facades = append(facades, timelapseHunkForJSON{disp, hunk.Lines})
+	}
+	return facades
+}
+
 type commitForJSON struct {
 	Hash string		`json:"hash"`
 	Author string	`json:"author"`
 	Date time.Time	`json:"date"`
 	Desc string		`json:"desc"`
+	LinesAdded *int	`json:"linesAdded,omitempty"`
+	LinesRemoved *int	`json:"linesRemoved,omitempty"`
+	Binary bool		`json:"binary"`
+	Changes []fileChangeForJSON	`json:"changes,omitempty"`
 }
 
 type CommitList []Commit
 
 func (c *CommitList) ToJSON() ([]byte, error) {
-	var facades []commitForJSON
+	facades := []commitForJSON{}
 	for _, commit := range *c {
 		facades = append(facades, *commit.forJSON())
 	}
@@ -317,7 +824,7 @@ func checkForGit(cmdFn CommandFn) error {
 	err := cmd.Run()
 
 	if err != nil && stdout.String() == "" {
-		return errors.New("Git not installed")
+		return ErrGitMissing
 	}
 
 	return nil
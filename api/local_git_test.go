@@ -5,6 +5,8 @@ import (
 	"github.com/rbwinslow/morlock/test_util"
 
 	"bytes"
+	"context"
+	"encoding/json"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"io"
@@ -234,6 +236,150 @@ var _ = Describe("Local Git repository", func() {
 				Expect(err).To(BeNil())
 			})
 		})
+		It("should count the lines each commit added and removed", func() {
+			// Given
+			filePath := "counted.txt"
+			test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+				tgr.MustAddFile(filePath, "one\ntwo\nthree\n")
+				tgr.MustCommit("three lines")
+				tgr.MustAddFile(filePath, "one\n2\n3\nfour\n")
+				tgr.MustCommit("two changed, one added")
+				tgr.MustAddFile(filePath, "binary\x00now\n")
+				tgr.MustCommit("binary")
+
+				// When
+				repo, err := api.OpenLocalGitRepo(tgr.Path, nil)
+				var commits []api.Commit
+				if err == nil {
+					var historyChannel chan api.Commit
+					historyChannel, err = repo.History(filePath)
+					if err == nil {
+						for commit := range historyChannel {
+							commits = append(commits, commit)
+						}
+					}
+				}
+
+				// Then
+				Expect(err).To(BeNil())
+				Expect(len(commits)).To(Equal(3))
+				Expect(commits[0].Binary).To(BeTrue())
+				Expect(commits[0].LinesAdded).To(BeZero())
+				Expect(commits[1].Binary).To(BeFalse())
+				Expect(commits[1].LinesAdded).To(Equal(3))
+				Expect(commits[1].LinesRemoved).To(Equal(2))
+				Expect(commits[2].LinesAdded).To(Equal(3))
+				Expect(commits[2].LinesRemoved).To(BeZero())
+				list := api.CommitList(commits)
+				js, err := list.ToJSON()
+				Expect(err).To(BeNil())
+				var records []map[string]interface{}
+				Expect(json.Unmarshal(js, &records)).To(Succeed())
+				Expect(records[0]).NotTo(HaveKey("linesAdded"))
+				Expect(records[0]).NotTo(HaveKey("linesRemoved"))
+				Expect(records[0]["binary"]).To(BeTrue())
+				Expect(records[2]["linesRemoved"]).To(BeZero())
+			})
+		})
+	})
+
+	Describe("history filtering and pagination", func() {
+		var makeHistory = func(tgr *test_util.TemporaryGitRepo) {
+			for i := 1; i <= 5; i++ {
+				tgr.MustAddFile("paged.txt", strings.Repeat("line\n", i))
+				if i%2 == 0 {
+					tgr.MustRun("commit", "-m", fmt.Sprintf("even %d", i), "--author=Someone Else <else@test.com>")
+				} else {
+					tgr.MustCommit(fmt.Sprintf("odd %d", i))
+				}
+			}
+		}
+
+		var descs = func(commits api.CommitList) []string {
+			result := []string{}
+			for _, c := range commits {
+				result = append(result, c.Desc)
+			}
+			return result
+		}
+
+		It("should page through history with cursors", func() {
+			test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+				// Given
+				makeHistory(tgr)
+				repo, err := api.OpenLocalGitRepo(tgr.Path, nil)
+				Expect(err).To(BeNil())
+
+				// When
+				page1, cursor1, err1 := repo.HistoryPage(context.Background(), "paged.txt", api.HistoryOptions{}, "", 2)
+				tgr.MustAddFile("paged.txt", "a commit after the first page")
+				tgr.MustCommit("newer")
+				page2, cursor2, err2 := repo.HistoryPage(context.Background(), "paged.txt", api.HistoryOptions{}, cursor1, 2)
+				page3, cursor3, err3 := repo.HistoryPage(context.Background(), "paged.txt", api.HistoryOptions{}, cursor2, 2)
+
+				// Then
+				Expect(err1).To(BeNil())
+				Expect(descs(page1)).To(Equal([]string{"odd 5", "even 4"}))
+				Expect(cursor1).ToNot(BeEmpty())
+				Expect(err2).To(BeNil())
+				Expect(descs(page2)).To(Equal([]string{"odd 3", "even 2"}))
+				Expect(err3).To(BeNil())
+				Expect(descs(page3)).To(Equal([]string{"odd 1"}))
+				Expect(cursor3).To(BeEmpty())
+			})
+		})
+
+		It("should filter by author and message inside the walk", func() {
+			test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+				// Given
+				makeHistory(tgr)
+				repo, err := api.OpenLocalGitRepo(tgr.Path, nil)
+				Expect(err).To(BeNil())
+
+				// When
+				byAuthor, _, errAuthor := repo.HistoryPage(context.Background(), "paged.txt", api.HistoryOptions{Author: "^Someone"}, "", 0)
+				byMessage, next, errMessage := repo.HistoryPage(context.Background(), "paged.txt", api.HistoryOptions{Message: "^odd [13]$"}, "", 1)
+				future, _, errFuture := repo.HistoryPage(context.Background(), "paged.txt", api.HistoryOptions{Since: time.Now().Add(time.Hour)}, "", 0)
+				past, _, errPast := repo.HistoryPage(context.Background(), "paged.txt", api.HistoryOptions{Until: time.Now().Add(-24 * time.Hour)}, "", 0)
+
+				// Then
+				Expect(errAuthor).To(BeNil())
+				Expect(descs(byAuthor)).To(Equal([]string{"even 4", "even 2"}))
+				Expect(errMessage).To(BeNil())
+				Expect(descs(byMessage)).To(Equal([]string{"odd 3"}))
+				Expect(next).ToNot(BeEmpty())
+				Expect(errFuture).To(BeNil())
+				Expect(future).To(BeEmpty())
+				Expect(errPast).To(BeNil())
+				Expect(past).To(BeEmpty())
+			})
+		})
+
+		It("should reject a cursor it didn't make", func() {
+			_, err := api.ParseHistoryCursor("not-a-cursor")
+			Expect(err).ToNot(BeNil())
+		})
+
+		It("should stop git when the walk is cancelled", func() {
+			test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+				// Given
+				makeHistory(tgr)
+				repo, err := api.OpenLocalGitRepo(tgr.Path, nil)
+				Expect(err).To(BeNil())
+				ctx, cancel := context.WithCancel(context.Background())
+
+				// When
+				walk, err := repo.WalkHistory(ctx, "paged.txt", api.HistoryOptions{})
+				Expect(err).To(BeNil())
+				<-walk.Commits
+				cancel()
+				for range walk.Commits {
+				}
+
+				// Then
+				Expect(walk.Err()).To(Equal(context.Canceled))
+			})
+		})
 	})
 
 	Describe("Timelapse", func() {
@@ -281,5 +427,66 @@ var _ = Describe("Local Git repository", func() {
 				Expect(err).To(BeNil())
 			})
 		})
+
+		It("should report progress for each commit", func() {
+			// Given
+			filePath := "progress.txt"
+			test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+				tgr.MustAddFile(filePath, "one\ntwo\nthree\n")
+				tgr.MustCommit("first")
+				tgr.MustAddFile(filePath, "one\nthree\n")
+				tgr.MustCommit("second")
+				tgr.MustAddFile(filePath, "one\nthree\nfour\n")
+				tgr.MustCommit("third")
+
+				var reports []api.TimelapseProgress
+				var partialLengths []int
+				opts := api.TimelapseOptions{Progress: func(progress api.TimelapseProgress) {
+					reports = append(reports, progress)
+					partialLengths = append(partialLengths, len(progress.Partial))
+				}}
+
+				// When
+				repo, err := api.OpenLocalGitRepo(tgr.Path, nil)
+				Expect(err).To(BeNil())
+				tl, err := repo.BuildTimelapse(context.Background(), filePath, opts)
+
+				// Then
+				Expect(err).To(BeNil())
+				Expect(len(reports)).To(Equal(3))
+				for i, report := range reports {
+					Expect(report.Processed).To(Equal(i + 1))
+					Expect(report.Total).To(Equal(3))
+				}
+				Expect(reports[0].Desc).To(Equal("first"))
+				Expect(reports[2].Desc).To(Equal("third"))
+				Expect(partialLengths[0]).To(Equal(1))
+				Expect(partialLengths[2]).To(Equal(len(tl)))
+			})
+		})
+
+		It("should give up when its context is cancelled", func() {
+			// Given
+			filePath := "cancelled.txt"
+			test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+				tgr.MustAddFile(filePath, "a\nb")
+				tgr.MustCommit("first")
+				tgr.MustAddFile(filePath, "a")
+				tgr.MustCommit("second")
+
+				ctx, cancel := context.WithCancel(context.Background())
+				opts := api.TimelapseOptions{Progress: func(progress api.TimelapseProgress) {
+					cancel()
+				}}
+
+				// When
+				repo, err := api.OpenLocalGitRepo(tgr.Path, nil)
+				Expect(err).To(BeNil())
+				_, err = repo.BuildTimelapse(ctx, filePath, opts)
+
+				// Then
+				Expect(err).To(Equal(context.Canceled))
+			})
+		})
 	})
 })
@@ -0,0 +1,91 @@
+package api_test
+
+import (
+	"github.com/rbwinslow/morlock/api"
+	"github.com/rbwinslow/morlock/test_util"
+
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// BenchmarkTimelapse builds the timelapse of a file with a long, synthetic
+// history, fetching different numbers of diffs from git at once. Run it with
+//
+//     go test ./api -run NONE -bench Timelapse
+//
+func BenchmarkTimelapse(b *testing.B) {
+	test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+		for i, contents := range scramble(11, 400) {
+			tgr.MustAddFile("long.go", contents)
+			tgr.MustCommit(fmt.Sprintf("version %d", i))
+		}
+		repo, err := api.OpenLocalGitRepo(tgr.Path, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		for _, concurrency := range []int{1, 2, 4, 8} {
+			b.Run(fmt.Sprintf("concurrency=%d", concurrency), func(b *testing.B) {
+				opts := api.TimelapseOptions{Concurrency: concurrency}
+				for n := 0; n < b.N; n++ {
+					if _, err := repo.BuildTimelapse(context.Background(), "long.go", opts); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	})
+}
+
+// generated makes the kind of file a code generator would: version v of it
+// is mostly the same as version v-1, with a few scattered entries renumbered.
+//
+func generated(lines, version int) string {
+	var b strings.Builder
+	for i := 0; i < lines; i++ {
+		stamp := 0
+		if i%97 == version%97 {
+			stamp = version
+		}
+		fmt.Fprintf(&b, "\tEntry%05d = %d // generated\n", i, stamp)
+	}
+	return b.String()
+}
+
+// BenchmarkTimelapseLargeFile builds the timelapse of a 50,000-line generated
+// file with 30 commits of history, and reports allocations along with how
+// much of the heap the finished timelapse holds on to.
+//
+func BenchmarkTimelapseLargeFile(b *testing.B) {
+	test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+		for v := 0; v < 30; v++ {
+			tgr.MustAddFile("generated.go", generated(50000, v))
+			tgr.MustCommit(fmt.Sprintf("regenerate %d", v))
+		}
+		repo, err := api.OpenLocalGitRepo(tgr.Path, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		var retained uint64
+		for n := 0; n < b.N; n++ {
+			var before, after runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&before)
+			tl, err := repo.BuildTimelapse(context.Background(), "generated.go", api.TimelapseOptions{})
+			if err != nil {
+				b.Fatal(err)
+			}
+			runtime.GC()
+			runtime.ReadMemStats(&after)
+			retained += after.HeapAlloc - before.HeapAlloc
+			runtime.KeepAlive(tl)
+		}
+		b.ReportMetric(float64(retained)/float64(b.N), "retained-B/op")
+	})
+}
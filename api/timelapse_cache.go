@@ -0,0 +1,389 @@
+package api
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Bump this whenever BuildTimelapse starts producing something different for
+// the same history, so that timelapses stored on disk by an older morlock are
+// ignored rather than served.
+//
+const timelapseCacheVersion = 2
+
+// TimelapseCacheKey identifies one timelapse. Because Anchor is the newest
+// commit that touched Path, a new commit to the file makes a new key, and the
+// old entry simply ages out.
+//
+type TimelapseCacheKey struct {
+	Repo    string
+	Path    string
+	Anchor  Hash
+	Options string
+}
+
+func (key TimelapseCacheKey) String() string {
+	return fmt.Sprintf("%s\x00%s\x00%s\x00%s", key.Repo, key.Path, key.Anchor, key.Options)
+}
+
+// lineage is everything in the key but the anchor: timelapses with the same
+// lineage are the same file at different points in its history.
+//
+func (key TimelapseCacheKey) lineage() string {
+	return fmt.Sprintf("%s\x00%s\x00%s", key.Repo, key.Path, key.Options)
+}
+
+// fingerprint describes the options that change what BuildTimelapse produces.
+// Progress doesn't, so for now that's only the cache version.
+//
+func (opts TimelapseOptions) fingerprint() string {
+	return fmt.Sprintf("v%d", timelapseCacheVersion)
+}
+
+// TimelapseCacheConfig limits a TimelapseCache. Zero means no limit. When Dir
+// isn't empty, timelapses are also written there, so that they survive a
+// restart; MaxDiskBytes bounds that directory by removing the least recently
+// used files first.
+//
+type TimelapseCacheConfig struct {
+	MaxEntries   int
+	MaxBytes     int64
+	Dir          string
+	MaxDiskBytes int64
+}
+
+// TimelapseCacheStats is a snapshot of what a TimelapseCache holds and how
+// well it's doing. DiskHits are counted among Hits as well. Extensions are
+// misses that were answered by bringing an older timelapse forward.
+//
+type TimelapseCacheStats struct {
+	Entries      int
+	Bytes        int64
+	MaxEntries   int
+	MaxBytes     int64
+	Hits         int64
+	DiskHits     int64
+	Misses       int64
+	Extensions   int64
+	Evictions    int64
+	DiskFailures int64
+}
+
+// TimelapseCache remembers timelapses in memory, least recently used first
+// out, and optionally on disk. It's safe for concurrent use. A nil
+// *TimelapseCache is valid, and just builds every timelapse it's asked for.
+//
+type TimelapseCache struct {
+	config  TimelapseCacheConfig
+	mutex   sync.Mutex
+	lru     *list.List
+	entries map[TimelapseCacheKey]*list.Element
+	latest  map[string]TimelapseCacheKey
+	stats   TimelapseCacheStats
+}
+
+type timelapseCacheEntry struct {
+	key       TimelapseCacheKey
+	timelapse Timelapse
+	size      int64
+}
+
+// What we keep on disk carries its own key, so that a file whose name
+// collided with another key's can be told apart from a hit.
+//
+type timelapseCacheFile struct {
+	Key       TimelapseCacheKey
+	Timelapse Timelapse
+}
+
+func NewTimelapseCache(config TimelapseCacheConfig) (*TimelapseCache, error) {
+	if len(config.Dir) > 0 {
+		if err := os.MkdirAll(config.Dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	return &TimelapseCache{
+		config:  config,
+		lru:     list.New(),
+		entries: map[TimelapseCacheKey]*list.Element{},
+		latest:  map[string]TimelapseCacheKey{},
+	}, nil
+}
+
+// Timelapse hands back p's timelapse from the cache when it can, and builds
+// (and remembers) it otherwise. When the cache holds a timelapse of p as of an
+// earlier commit, only the commits since then are worked in. Progress is only
+// reported for those commits that have to be worked in. A file with no
+// history is ErrNotTracked, or ErrPathNotFound when it isn't on disk either.
+//
+func (cache *TimelapseCache) Timelapse(ctx context.Context, repo *LocalGitRepo, p string, opts TimelapseOptions) (Timelapse, error) {
+	anchor, found, err := repo.TimelapseAnchor(p)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, repo.untrackedError(p)
+	}
+	if cache == nil {
+		return repo.buildTimelapseAt(ctx, p, &anchor, opts)
+	}
+
+	key := TimelapseCacheKey{Repo: repo.Path, Path: p, Anchor: anchor, Options: opts.fingerprint()}
+	if tl, ok := cache.Get(key); ok {
+		return tl, nil
+	}
+
+	var tl Timelapse
+	if previous, ok := cache.previous(key); ok {
+		ancestor, err := repo.isAncestor(previous.key.Anchor, anchor)
+		if err != nil {
+			return nil, err
+		}
+		if ancestor {
+			tl, err = repo.extendTimelapse(ctx, p, previous.timelapse, &previous.key.Anchor, anchor, opts)
+			if err != nil {
+				return nil, err
+			}
+			cache.mutex.Lock()
+			cache.stats.Extensions++
+			cache.mutex.Unlock()
+		}
+	}
+	if tl == nil {
+		if tl, err = repo.buildTimelapseAt(ctx, p, &anchor, opts); err != nil {
+			return nil, err
+		}
+	}
+	cache.Put(key, tl)
+	return tl, nil
+}
+
+// previous finds the timelapse most recently remembered with the same lineage
+// as key, if it's still in memory.
+//
+func (cache *TimelapseCache) previous(key TimelapseCacheKey) (*timelapseCacheEntry, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	latest, ok := cache.latest[key.lineage()]
+	if !ok {
+		return nil, false
+	}
+	elem, ok := cache.entries[latest]
+	if !ok {
+		return nil, false
+	}
+	return elem.Value.(*timelapseCacheEntry), true
+}
+
+// Get looks for key in memory, then on disk. Callers mustn't modify what
+// they get back; it's shared with everyone else who asks for the same key.
+//
+func (cache *TimelapseCache) Get(key TimelapseCacheKey) (Timelapse, bool) {
+	cache.mutex.Lock()
+	if elem, ok := cache.entries[key]; ok {
+		cache.lru.MoveToFront(elem)
+		cache.stats.Hits++
+		cache.mutex.Unlock()
+		return elem.Value.(*timelapseCacheEntry).timelapse, true
+	}
+	cache.mutex.Unlock()
+
+	if tl, ok := cache.readDisk(key); ok {
+		cache.mutex.Lock()
+		cache.stats.Hits++
+		cache.stats.DiskHits++
+		cache.remember(key, tl)
+		cache.mutex.Unlock()
+		return tl, true
+	}
+
+	cache.mutex.Lock()
+	cache.stats.Misses++
+	cache.mutex.Unlock()
+	return nil, false
+}
+
+func (cache *TimelapseCache) Put(key TimelapseCacheKey, tl Timelapse) {
+	cache.mutex.Lock()
+	cache.remember(key, tl)
+	cache.mutex.Unlock()
+	cache.writeDisk(key, tl)
+}
+
+// Stats of a nil cache are all zero.
+//
+func (cache *TimelapseCache) Stats() TimelapseCacheStats {
+	if cache == nil {
+		return TimelapseCacheStats{}
+	}
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	stats := cache.stats
+	stats.Entries = cache.lru.Len()
+	stats.MaxEntries = cache.config.MaxEntries
+	stats.MaxBytes = cache.config.MaxBytes
+	return stats
+}
+
+// remember must be called with the mutex held.
+//
+func (cache *TimelapseCache) remember(key TimelapseCacheKey, tl Timelapse) {
+	if elem, ok := cache.entries[key]; ok {
+		cache.stats.Bytes -= elem.Value.(*timelapseCacheEntry).size
+		cache.lru.Remove(elem)
+		delete(cache.entries, key)
+	}
+
+	entry := &timelapseCacheEntry{key: key, timelapse: tl, size: timelapseSize(key, tl)}
+	if cache.config.MaxBytes > 0 && entry.size > cache.config.MaxBytes {
+		return
+	}
+	cache.entries[key] = cache.lru.PushFront(entry)
+	cache.latest[key.lineage()] = key
+	cache.stats.Bytes += entry.size
+
+	for cache.overLimit() {
+		oldest := cache.lru.Back()
+		evicted := oldest.Value.(*timelapseCacheEntry)
+		cache.lru.Remove(oldest)
+		delete(cache.entries, evicted.key)
+		if cache.latest[evicted.key.lineage()] == evicted.key {
+			delete(cache.latest, evicted.key.lineage())
+		}
+		cache.stats.Bytes -= evicted.size
+		cache.stats.Evictions++
+	}
+}
+
+func (cache *TimelapseCache) overLimit() bool {
+	if cache.config.MaxEntries > 0 && cache.lru.Len() > cache.config.MaxEntries {
+		return true
+	}
+	return cache.config.MaxBytes > 0 && cache.stats.Bytes > cache.config.MaxBytes
+}
+
+// timelapseSize is roughly how much memory a cached timelapse holds on to:
+// its text, plus the slice and string headers that point at it.
+//
+func timelapseSize(key TimelapseCacheKey, tl Timelapse) int64 {
+	size := int64(len(key.String()))
+	for _, hunk := range tl {
+		size += 32
+		for _, line := range hunk.Lines {
+			size += int64(len(line)) + 16
+		}
+	}
+	return size
+}
+
+func (cache *TimelapseCache) diskPath(key TimelapseCacheKey) string {
+	sum := sha256.Sum256([]byte(key.String()))
+	return filepath.Join(cache.config.Dir, hex.EncodeToString(sum[:])+".gob")
+}
+
+func (cache *TimelapseCache) readDisk(key TimelapseCacheKey) (Timelapse, bool) {
+	if len(cache.config.Dir) == 0 {
+		return nil, false
+	}
+	f, err := os.Open(cache.diskPath(key))
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+
+	var stored timelapseCacheFile
+	if err := gob.NewDecoder(f).Decode(&stored); err != nil || stored.Key != key {
+		return nil, false
+	}
+	now := time.Now()
+	os.Chtimes(f.Name(), now, now)
+	return stored.Timelapse, true
+}
+
+// writeDisk stores the timelapse under a temporary name and renames it into
+// place, so that a reader never sees half a file. Failing to write is only
+// counted; the cache still works from memory.
+//
+func (cache *TimelapseCache) writeDisk(key TimelapseCacheKey, tl Timelapse) {
+	if len(cache.config.Dir) == 0 {
+		return
+	}
+	err := func() error {
+		f, err := ioutil.TempFile(cache.config.Dir, "incoming-")
+		if err != nil {
+			return err
+		}
+		if err := gob.NewEncoder(f).Encode(timelapseCacheFile{key, tl}); err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return err
+		}
+		if err := f.Close(); err != nil {
+			os.Remove(f.Name())
+			return err
+		}
+		return os.Rename(f.Name(), cache.diskPath(key))
+	}()
+	if err == nil {
+		err = cache.pruneDisk()
+	}
+	if err != nil {
+		cache.mutex.Lock()
+		cache.stats.DiskFailures++
+		cache.mutex.Unlock()
+	}
+}
+
+func (cache *TimelapseCache) pruneDisk() error {
+	if cache.config.MaxDiskBytes <= 0 {
+		return nil
+	}
+	files, err := ioutil.ReadDir(cache.config.Dir)
+	if err != nil {
+		return err
+	}
+	var total int64
+	var stored []os.FileInfo
+	for _, info := range files {
+		if filepath.Ext(info.Name()) == ".gob" {
+			total += info.Size()
+			stored = append(stored, info)
+		}
+	}
+	sort.Slice(stored, func(i, j int) bool { return stored[i].ModTime().Before(stored[j].ModTime()) })
+	for i := 0; total > cache.config.MaxDiskBytes && i < len(stored); i++ {
+		if err := os.Remove(filepath.Join(cache.config.Dir, stored[i].Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		total -= stored[i].Size()
+	}
+	return nil
+}
+
+type timelapseCacheStatsForJSON struct {
+	Entries      int   `json:"entries"`
+	Bytes        int64 `json:"bytes"`
+	MaxEntries   int   `json:"maxEntries"`
+	MaxBytes     int64 `json:"maxBytes"`
+	Hits         int64 `json:"hits"`
+	DiskHits     int64 `json:"diskHits"`
+	Misses       int64 `json:"misses"`
+	Extensions   int64 `json:"extensions"`
+	Evictions    int64 `json:"evictions"`
+	DiskFailures int64 `json:"diskFailures"`
+}
+
+func (stats *TimelapseCacheStats) ToJSON() ([]byte, error) {
+	return json.Marshal(timelapseCacheStatsForJSON(*stats))
+}
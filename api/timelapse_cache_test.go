@@ -0,0 +1,204 @@
+package api_test
+
+import (
+	"github.com/rbwinslow/morlock/api"
+	"github.com/rbwinslow/morlock/test_util"
+
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Timelapse cache", func() {
+	var withHistory = func(fn func(tgr *test_util.TemporaryGitRepo, repo *api.LocalGitRepo)) {
+		test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+			tgr.MustAddFile("a.txt", "one\ntwo\nthree\n")
+			tgr.MustAddFile("b.txt", "uno\ndos\n")
+			tgr.MustCommit("first")
+			tgr.MustAddFile("a.txt", "one\nthree\n")
+			tgr.MustCommit("second")
+			repo, err := api.OpenLocalGitRepo(tgr.Path, nil)
+			Expect(err).To(BeNil())
+			fn(tgr, repo)
+		})
+	}
+
+	It("should build a timelapse once and then remember it", func() {
+		withHistory(func(tgr *test_util.TemporaryGitRepo, repo *api.LocalGitRepo) {
+			// Given
+			cache, err := api.NewTimelapseCache(api.TimelapseCacheConfig{})
+			Expect(err).To(BeNil())
+			built := 0
+			opts := api.TimelapseOptions{Progress: func(api.TimelapseProgress) { built++ }}
+
+			// When
+			first, err1 := cache.Timelapse(context.Background(), repo, "a.txt", opts)
+			second, err2 := cache.Timelapse(context.Background(), repo, "a.txt", opts)
+
+			// Then
+			Expect(err1).To(BeNil())
+			Expect(err2).To(BeNil())
+			Expect(second).To(Equal(first))
+			Expect(built).To(Equal(2))
+			stats := cache.Stats()
+			Expect(stats.Entries).To(Equal(1))
+			Expect(stats.Hits).To(Equal(int64(1)))
+			Expect(stats.Misses).To(Equal(int64(1)))
+			Expect(stats.Bytes).To(BeNumerically(">", 0))
+		})
+	})
+
+	It("should bring a timelapse forward once the file gets a new commit", func() {
+		withHistory(func(tgr *test_util.TemporaryGitRepo, repo *api.LocalGitRepo) {
+			// Given
+			cache, err := api.NewTimelapseCache(api.TimelapseCacheConfig{})
+			Expect(err).To(BeNil())
+			_, err = cache.Timelapse(context.Background(), repo, "a.txt", api.TimelapseOptions{})
+			Expect(err).To(BeNil())
+
+			// When
+			tgr.MustAddFile("a.txt", "one\nthree\nfour\n")
+			tgr.MustCommit("third")
+			tl, err := cache.Timelapse(context.Background(), repo, "a.txt", api.TimelapseOptions{})
+
+			// Then
+			Expect(err).To(BeNil())
+			Expect(presentText(tl)).To(Equal("one\nthree\nfour"))
+			Expect(cache.Stats().Misses).To(Equal(int64(2)))
+			Expect(cache.Stats().Extensions).To(Equal(int64(1)))
+			Expect(cache.Stats().Entries).To(Equal(2))
+		})
+	})
+
+	It("should ignore uncommitted changes", func() {
+		withHistory(func(tgr *test_util.TemporaryGitRepo, repo *api.LocalGitRepo) {
+			// Given
+			err := ioutil.WriteFile(path.Join(tgr.Path, "a.txt"), []byte("scribbled over\n"), 0644)
+			Expect(err).To(BeNil())
+
+			// When
+			tl, err := repo.Timelapse("a.txt")
+
+			// Then
+			Expect(err).To(BeNil())
+			Expect(tl[0].Lines).To(Equal([]string{"one"}))
+		})
+	})
+
+	It("should evict the least recently used timelapse", func() {
+		withHistory(func(tgr *test_util.TemporaryGitRepo, repo *api.LocalGitRepo) {
+			// Given
+			cache, err := api.NewTimelapseCache(api.TimelapseCacheConfig{MaxEntries: 1})
+			Expect(err).To(BeNil())
+
+			// When
+			_, err1 := cache.Timelapse(context.Background(), repo, "a.txt", api.TimelapseOptions{})
+			_, err2 := cache.Timelapse(context.Background(), repo, "b.txt", api.TimelapseOptions{})
+			_, err3 := cache.Timelapse(context.Background(), repo, "a.txt", api.TimelapseOptions{})
+
+			// Then
+			Expect(err1).To(BeNil())
+			Expect(err2).To(BeNil())
+			Expect(err3).To(BeNil())
+			stats := cache.Stats()
+			Expect(stats.Entries).To(Equal(1))
+			Expect(stats.Evictions).To(Equal(int64(2)))
+			Expect(stats.Misses).To(Equal(int64(3)))
+		})
+	})
+
+	It("should not keep a timelapse bigger than its byte limit", func() {
+		withHistory(func(tgr *test_util.TemporaryGitRepo, repo *api.LocalGitRepo) {
+			cache, err := api.NewTimelapseCache(api.TimelapseCacheConfig{MaxBytes: 8})
+			Expect(err).To(BeNil())
+
+			tl, err := cache.Timelapse(context.Background(), repo, "a.txt", api.TimelapseOptions{})
+
+			Expect(err).To(BeNil())
+			Expect(tl).ToNot(BeEmpty())
+			Expect(cache.Stats().Entries).To(Equal(0))
+			Expect(cache.Stats().Bytes).To(Equal(int64(0)))
+		})
+	})
+
+	It("should find timelapses stored on disk by an earlier cache", func() {
+		withHistory(func(tgr *test_util.TemporaryGitRepo, repo *api.LocalGitRepo) {
+			// Given
+			dir, err := ioutil.TempDir("", "morlock-cache")
+			Expect(err).To(BeNil())
+			defer os.RemoveAll(dir)
+			earlier, err := api.NewTimelapseCache(api.TimelapseCacheConfig{Dir: dir})
+			Expect(err).To(BeNil())
+			expected, err := earlier.Timelapse(context.Background(), repo, "a.txt", api.TimelapseOptions{})
+			Expect(err).To(BeNil())
+
+			// When
+			later, err := api.NewTimelapseCache(api.TimelapseCacheConfig{Dir: dir})
+			Expect(err).To(BeNil())
+			built := false
+			tl, err := later.Timelapse(context.Background(), repo, "a.txt", api.TimelapseOptions{Progress: func(api.TimelapseProgress) { built = true }})
+
+			// Then
+			Expect(err).To(BeNil())
+			Expect(built).To(BeFalse())
+			Expect(tl).To(Equal(expected))
+			Expect(later.Stats().DiskHits).To(Equal(int64(1)))
+			Expect(later.Stats().Entries).To(Equal(1))
+		})
+	})
+
+	It("should bring forward a timelapse it found on disk", func() {
+		withHistory(func(tgr *test_util.TemporaryGitRepo, repo *api.LocalGitRepo) {
+			// Given
+			dir, err := ioutil.TempDir("", "morlock-cache")
+			Expect(err).To(BeNil())
+			defer os.RemoveAll(dir)
+			earlier, err := api.NewTimelapseCache(api.TimelapseCacheConfig{Dir: dir})
+			Expect(err).To(BeNil())
+			_, err = earlier.Timelapse(context.Background(), repo, "a.txt", api.TimelapseOptions{})
+			Expect(err).To(BeNil())
+			later, err := api.NewTimelapseCache(api.TimelapseCacheConfig{Dir: dir})
+			Expect(err).To(BeNil())
+			_, err = later.Timelapse(context.Background(), repo, "a.txt", api.TimelapseOptions{})
+			Expect(err).To(BeNil())
+
+			// When
+			tgr.MustAddFile("a.txt", "zero\none\nthree\nfour\n")
+			tgr.MustCommit("third")
+			tl, err := later.Timelapse(context.Background(), repo, "a.txt", api.TimelapseOptions{})
+
+			// Then
+			Expect(err).To(BeNil())
+			Expect(later.Stats().DiskHits).To(Equal(int64(1)))
+			Expect(later.Stats().Extensions).To(Equal(int64(1)))
+			rebuilt, err := repo.Timelapse("a.txt")
+			Expect(err).To(BeNil())
+			Expect(tl).To(Equal(rebuilt))
+		})
+	})
+
+	It("should keep its directory under the disk limit", func() {
+		withHistory(func(tgr *test_util.TemporaryGitRepo, repo *api.LocalGitRepo) {
+			// Given
+			dir, err := ioutil.TempDir("", "morlock-cache")
+			Expect(err).To(BeNil())
+			defer os.RemoveAll(dir)
+			cache, err := api.NewTimelapseCache(api.TimelapseCacheConfig{Dir: dir, MaxDiskBytes: 1})
+			Expect(err).To(BeNil())
+
+			// When
+			_, err = cache.Timelapse(context.Background(), repo, "a.txt", api.TimelapseOptions{})
+
+			// Then
+			Expect(err).To(BeNil())
+			files, err := ioutil.ReadDir(dir)
+			Expect(err).To(BeNil())
+			Expect(files).To(BeEmpty())
+			Expect(cache.Stats().Entries).To(Equal(1))
+		})
+	})
+})
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+
+	"github.com/waigani/diffparser"
+)
+
+type timelapseDiffResult struct {
+	hunks []DiffHunk
+	err   error
+}
+
+// fetchTimelapseDiffs fetches and parses the diffs of p between each pair of
+// consecutive revisions in revs, on up to concurrency goroutines at once. The
+// diffs come back on one channel apiece, in order. To keep memory bounded, no
+// more than twice concurrency diffs are fetched ahead of the caller, who says
+// it's done with each diff by calling release. Cancelling ctx stops the
+// workers; a diff that was never fetched then never arrives.
+//
+func (repo *LocalGitRepo) fetchTimelapseDiffs(ctx context.Context, p string, revs []string, concurrency int) (diffs []chan timelapseDiffResult, release func()) {
+	if len(revs) < 2 {
+		return nil, func() {}
+	}
+	diffs = make([]chan timelapseDiffResult, len(revs)-1)
+	for i := range diffs {
+		diffs[i] = make(chan timelapseDiffResult, 1)
+	}
+
+	window := make(chan struct{}, 2*concurrency)
+	jobs := make(chan int)
+	go func() {
+		defer close(jobs)
+		for i := range diffs {
+			select {
+			case window <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for w := 0; w < concurrency; w++ {
+		go func() {
+			for i := range jobs {
+				hunks, err := repo.timelapseDiff(ctx, revs[i], revs[i+1], p)
+				diffs[i] <- timelapseDiffResult{hunks, err}
+			}
+		}()
+	}
+
+	return diffs, func() { <-window }
+}
+
+// timelapseDiff fetches what happened to p between two commits.
+//
+func (repo *LocalGitRepo) timelapseDiff(ctx context.Context, older, newer, p string) ([]DiffHunk, error) {
+	cmd := exec.CommandContext(ctx, "git", "diff", "--no-color", "--no-ext-diff", older, newer, "--", p)
+	cmd.Dir = repo.Path
+	obuf := bytes.Buffer{}
+	ebuf := bytes.Buffer{}
+	cmd.Stdout = &obuf
+	cmd.Stderr = &ebuf
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, CookedErrorFromGitExec(&obuf, &ebuf, err)
+	}
+
+	parsed, err := diffparser.Parse(obuf.String())
+	if err != nil {
+		return nil, err
+	}
+	var hunks []DiffHunk
+	for _, file := range parsed.Files {
+		for _, hunk := range file.Hunks {
+			hunks = append(hunks, newDiffHunk(hunk))
+		}
+	}
+	return hunks, nil
+}
+
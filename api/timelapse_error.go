@@ -0,0 +1,29 @@
+package api
+
+import (
+	"fmt"
+)
+
+// TimelapseError is what went wrong working a commit's diff of a file into its
+// timelapse. Hunk counts the diff's hunks from zero, and HunkHeader is what git
+// printed for it; Line counts that hunk's lines from zero. Diagnostic is the
+// state of the transcription when it went wrong, for bug reports.
+//
+type TimelapseError struct {
+	Path       string
+	Commit     Hash
+	Hunk       int
+	HunkHeader string
+	Line       int
+	Diagnostic string
+	Err        error
+}
+
+func (te *TimelapseError) Error() string {
+	format := "Couldn't work commit %s into the timelapse of %s, at line %d of hunk %d (%q): %s\n%s"
+	return fmt.Sprintf(format, te.Commit.Short(), te.Path, te.Line+1, te.Hunk+1, te.HunkHeader, te.Err, te.Diagnostic)
+}
+
+func (te *TimelapseError) Unwrap() error {
+	return te.Err
+}
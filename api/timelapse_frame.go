@@ -0,0 +1,91 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// TimelapseFrame is a file's timelapse as it stood at one commit: the latest
+// commit, at or before the one asked for, that touched the file.
+//
+type TimelapseFrame struct {
+	Commit    Commit
+	Timelapse Timelapse
+}
+
+// TimelapseFrame builds p's timelapse as of rev, which can be anything
+// ResolveRevision accepts. It's ErrPathNotFound when no commit up to rev
+// touched p.
+//
+func (repo *LocalGitRepo) TimelapseFrame(ctx context.Context, p, rev string, opts TimelapseOptions) (*TimelapseFrame, error) {
+	commit, err := repo.ResolveRevision(rev)
+	if err != nil {
+		return nil, err
+	}
+	anchor, found, err := repo.timelapseAnchorAt(p, commit.String())
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errorOfKind(ErrPathNotFound, "No history for \"%s\" as of revision %s", p, rev)
+	}
+
+	var result TimelapseFrame
+	progress := opts.Progress
+	opts.Progress = func(tp TimelapseProgress) {
+		result.Commit = tp.Commit
+		if progress != nil {
+			progress(tp)
+		}
+	}
+	if result.Timelapse, err = repo.buildTimelapseAt(ctx, p, &anchor, opts); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+type timelapseFrameForJSON struct {
+	Commit    commitForJSON          `json:"commit"`
+	Timelapse []timelapseHunkForJSON `json:"timelapse"`
+}
+
+func (tf *TimelapseFrame) ToJSON() ([]byte, error) {
+	return json.Marshal(timelapseFrameForJSON{*tf.Commit.forJSON(), tf.Timelapse.forJSON()})
+}
+
+type LineChange int
+
+const (
+	LINE_KEPT LineChange = iota
+	LINE_ADDED
+	LINE_DELETED
+)
+
+// ChangesSince says, for each of tl's lines in order, whether it arrived or
+// was deleted since prev. prev has to be an earlier frame of the same build,
+// like the Partial of an earlier TimelapseProgress: lines are recognized by
+// being shared between the frames, not by their contents, so twins of a line
+// never get mistaken for it.
+//
+func (tl Timelapse) ChangesSince(prev Timelapse) []LineChange {
+	carried := map[*string]bool{}
+	for _, hunk := range prev {
+		for i := range hunk.Lines {
+			carried[&hunk.Lines[i]] = true
+		}
+	}
+	var changes []LineChange
+	for _, hunk := range tl {
+		for i := range hunk.Lines {
+			switch {
+			case carried[&hunk.Lines[i]]:
+				changes = append(changes, LINE_KEPT)
+			case hunk.Disposition == DELETED:
+				changes = append(changes, LINE_DELETED)
+			default:
+				changes = append(changes, LINE_ADDED)
+			}
+		}
+	}
+	return changes
+}
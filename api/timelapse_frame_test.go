@@ -0,0 +1,43 @@
+package api_test
+
+import (
+	"github.com/rbwinslow/morlock/api"
+	"github.com/rbwinslow/morlock/test_util"
+
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Changes between frames", func() {
+	It("should tell arrivals and deletions from their twins", func() {
+		test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+			// Given
+			tgr.MustAddFile("file.txt", "a\n}\nb\n")
+			tgr.MustCommit("first")
+			tgr.MustAddFile("file.txt", "a\n}\n}\nc\n")
+			tgr.MustCommit("second")
+			repo, err := api.OpenLocalGitRepo(tgr.Path, nil)
+			Expect(err).To(BeNil())
+			var frames []api.Timelapse
+			opts := api.TimelapseOptions{Progress: func(tp api.TimelapseProgress) {
+				frames = append(frames, tp.Partial)
+			}}
+
+			// When
+			_, err = repo.BuildTimelapse(context.Background(), "file.txt", opts)
+
+			// Then
+			Expect(err).To(BeNil())
+			Expect(frames).To(HaveLen(2))
+			Expect(frames[0].ChangesSince(nil)).To(Equal([]api.LineChange{api.LINE_ADDED, api.LINE_ADDED, api.LINE_ADDED}))
+			Expect(frames[1].ChangesSince(frames[0])).To(Equal([]api.LineChange{
+				api.LINE_KEPT, api.LINE_KEPT, api.LINE_DELETED, api.LINE_ADDED, api.LINE_ADDED,
+			}))
+			Expect(frames[1].ChangesSince(frames[1])).To(Equal([]api.LineChange{
+				api.LINE_KEPT, api.LINE_KEPT, api.LINE_KEPT, api.LINE_KEPT, api.LINE_KEPT,
+			}))
+		})
+	})
+})
@@ -0,0 +1,281 @@
+package api_test
+
+import (
+	"github.com/rbwinslow/morlock/api"
+	"github.com/rbwinslow/morlock/test_util"
+
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// presentText is the file a timelapse says is there now.
+//
+func presentText(tl api.Timelapse) string {
+	var lines []string
+	for _, hunk := range tl {
+		if hunk.Disposition == api.PRESENT {
+			lines = append(lines, hunk.Lines...)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// scramble makes a pseudo-random history for a file, by deleting, inserting
+// and rewriting lines of the previous version. Every version is different
+// from the one before it.
+//
+func scramble(seed int64, commits int) []string {
+	rng := rand.New(rand.NewSource(seed))
+	lines := []string{"package scrambled", "", "func main() {", "}"}
+	var versions []string
+	for c := 0; c < commits; c++ {
+		for edits := rng.Intn(4) + 1; edits > 0; edits-- {
+			at := rng.Intn(len(lines) + 1)
+			switch rng.Intn(3) {
+			case 0:
+				if at < len(lines) {
+					lines = append(lines[:at:at], lines[at+1:]...)
+				}
+			case 1:
+				line := fmt.Sprintf("\tcall%d()", rng.Intn(20))
+				lines = append(lines[:at:at], append([]string{line}, lines[at:]...)...)
+			case 2:
+				if at < len(lines) {
+					lines[at] = fmt.Sprintf("\tx := %d", rng.Intn(20))
+				}
+			}
+		}
+		version := strings.Join(lines, "\n") + "\n"
+		if len(versions) > 0 && version == versions[len(versions)-1] {
+			lines = append(lines, "}")
+			version = strings.Join(lines, "\n") + "\n"
+		}
+		versions = append(versions, version)
+	}
+	return versions
+}
+
+var _ = Describe("Timelapse engine", func() {
+	var histories = map[string][]string{
+		"growing":        {"one\n", "one\ntwo\n", "zero\none\ntwo\n", "zero\none\ntwo\nthree\n"},
+		"shrinking":      {"a\nb\nc\nd\ne\n", "a\nc\nd\ne\n", "a\nc\ne\n", "c\n"},
+		"rewritten":      {"a\nb\nc\n", "x\ny\nz\n", "x\nb\nz\n", "a\nb\nc\n"},
+		"no end newline": {"a\nb", "a\nb\nc", "a\nc", "c"},
+		"emptied":        {"a\nb\n", "", "b\nc\n"},
+		"scrambled":      scramble(7, 25),
+	}
+
+	var withHistory = func(versions []string, fn func(repo *api.LocalGitRepo, commits []api.Hash)) {
+		test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+			repo, err := api.OpenLocalGitRepo(tgr.Path, nil)
+			Expect(err).To(BeNil())
+			var commits []api.Hash
+			for i, contents := range versions {
+				tgr.MustAddFile("file.txt", contents)
+				tgr.MustAddFile("other.txt", fmt.Sprintf("%d", i))
+				hash, err := repo.ResolveRevision(tgr.MustCommit(fmt.Sprintf("version %d", i)).String())
+				Expect(err).To(BeNil())
+				commits = append(commits, hash)
+			}
+			fn(repo, commits)
+		})
+	}
+
+	for name, versions := range histories {
+		name, versions := name, versions
+
+		It(fmt.Sprintf("should keep every frame of the %s history in step with git", name), func() {
+			withHistory(versions, func(repo *api.LocalGitRepo, commits []api.Hash) {
+				// Given
+				var frames []string
+				opts := api.TimelapseOptions{Progress: func(progress api.TimelapseProgress) {
+					frames = append(frames, presentText(progress.Partial))
+				}}
+
+				// When
+				_, err := repo.BuildTimelapse(context.Background(), "file.txt", opts)
+
+				// Then
+				Expect(err).To(BeNil())
+				Expect(frames).To(HaveLen(len(versions)))
+				for i, frame := range frames {
+					Expect(frame).To(Equal(strings.TrimSuffix(versions[i], "\n")), fmt.Sprintf("frame %d", i))
+				}
+			})
+		})
+
+		It(fmt.Sprintf("should extend a timelapse of the %s history to match a full rebuild", name), func() {
+			withHistory(versions, func(repo *api.LocalGitRepo, commits []api.Hash) {
+				// Given
+				last := commits[len(commits)-1]
+				full, err := repo.BuildTimelapse(context.Background(), "file.txt", api.TimelapseOptions{})
+				Expect(err).To(BeNil())
+
+				for i, from := range commits {
+					partial := timelapseAt(repo, from)
+					before := fmt.Sprint(partial)
+
+					// When
+					extended, err := repo.ExtendTimelapse(context.Background(), "file.txt", partial, from, last, api.TimelapseOptions{})
+
+					// Then
+					Expect(err).To(BeNil())
+					Expect(extended).To(Equal(full), fmt.Sprintf("extending from version %d", i))
+					Expect(fmt.Sprint(partial)).To(Equal(before), "the timelapse being extended changed")
+				}
+			})
+		})
+	}
+
+	It("should leave earlier frames as they were", func() {
+		withHistory(histories["scrambled"], func(repo *api.LocalGitRepo, commits []api.Hash) {
+			// Given
+			var frames []api.Timelapse
+			opts := api.TimelapseOptions{Progress: func(progress api.TimelapseProgress) {
+				frames = append(frames, progress.Partial)
+			}}
+
+			// When
+			_, err := repo.BuildTimelapse(context.Background(), "file.txt", opts)
+
+			// Then
+			Expect(err).To(BeNil())
+			versions := histories["scrambled"]
+			Expect(frames).To(HaveLen(len(versions)))
+			for i, frame := range frames {
+				Expect(presentText(frame)).To(Equal(strings.TrimSuffix(versions[i], "\n")), fmt.Sprintf("frame %d", i))
+			}
+		})
+	})
+
+	It("should build the same timelapse however many diffs it fetches at once", func() {
+		withHistory(histories["scrambled"], func(repo *api.LocalGitRepo, commits []api.Hash) {
+			// Given
+			sequential, err := repo.BuildTimelapse(context.Background(), "file.txt", api.TimelapseOptions{Concurrency: 1})
+			Expect(err).To(BeNil())
+
+			for _, concurrency := range []int{2, 3, 8, 64} {
+				// When
+				var processed []int
+				opts := api.TimelapseOptions{Concurrency: concurrency, Progress: func(progress api.TimelapseProgress) {
+					processed = append(processed, progress.Processed)
+				}}
+				parallel, err := repo.BuildTimelapse(context.Background(), "file.txt", opts)
+
+				// Then
+				Expect(err).To(BeNil())
+				Expect(parallel).To(Equal(sequential), fmt.Sprintf("concurrency %d", concurrency))
+				for i, n := range processed {
+					Expect(n).To(Equal(i + 1))
+				}
+			}
+		})
+	})
+
+	It("should stop its workers when cancelled partway", func() {
+		withHistory(histories["scrambled"], func(repo *api.LocalGitRepo, commits []api.Hash) {
+			// Given
+			ctx, cancel := context.WithCancel(context.Background())
+			processed := 0
+			opts := api.TimelapseOptions{Concurrency: 4, Progress: func(progress api.TimelapseProgress) {
+				processed = progress.Processed
+				if processed == 3 {
+					cancel()
+				}
+			}}
+
+			// When
+			_, err := repo.BuildTimelapse(ctx, "file.txt", opts)
+
+			// Then
+			Expect(err).To(Equal(context.Canceled))
+			Expect(processed).To(Equal(3))
+		})
+	})
+
+	It("should only work in the commits after the old anchor", func() {
+		withHistory(histories["growing"], func(repo *api.LocalGitRepo, commits []api.Hash) {
+			// Given
+			old := timelapseAt(repo, commits[1])
+			var worked []string
+			opts := api.TimelapseOptions{Progress: func(progress api.TimelapseProgress) {
+				worked = append(worked, progress.Desc)
+			}}
+
+			// When
+			_, err := repo.ExtendTimelapse(context.Background(), "file.txt", old, commits[1], commits[3], opts)
+
+			// Then
+			Expect(err).To(BeNil())
+			Expect(worked).To(Equal([]string{"version 2", "version 3"}))
+		})
+	})
+
+	It("should say where a diff stopped making sense", func() {
+		withHistory(histories["shrinking"], func(repo *api.LocalGitRepo, commits []api.Hash) {
+			// Given a timelapse that isn't of the commit it claims to be
+			wrong := api.Timelapse{{api.PRESENT, []string{"a", "x", "c", "d", "e"}}}
+
+			// When
+			_, err := repo.ExtendTimelapse(context.Background(), "file.txt", wrong, commits[0], commits[1], api.TimelapseOptions{})
+
+			// Then
+			Expect(err).ToNot(BeNil())
+			te, ok := err.(*api.TimelapseError)
+			Expect(ok).To(BeTrue(), err.Error())
+			Expect(te.Path).To(Equal("file.txt"))
+			Expect(te.Commit).To(Equal(commits[1]))
+			Expect(te.Hunk).To(Equal(0))
+			Expect(te.Line).To(Equal(1))
+			Expect(te.Err.Error()).To(ContainSubstring(`diff removes "b" where the timelapse has "x"`))
+			Expect(te.Diagnostic).To(ContainSubstring("At diff line 1"))
+		})
+	})
+
+	It("should refuse to extend a timelapse across diverging branches", func() {
+		test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+			// Given
+			tgr.MustAddFile("file.txt", "a\n")
+			tgr.MustCommit("base")
+			tgr.MustRun("checkout", "-q", "-b", "left")
+			tgr.MustAddFile("file.txt", "a\nleft\n")
+			left := tgr.MustCommit("left")
+			tgr.MustRun("checkout", "-q", "-")
+			tgr.MustAddFile("file.txt", "a\nright\n")
+			right := tgr.MustCommit("right")
+
+			repo, err := api.OpenLocalGitRepo(tgr.Path, nil)
+			Expect(err).To(BeNil())
+			leftHash, err := repo.ResolveRevision(left.String())
+			Expect(err).To(BeNil())
+			rightHash, err := repo.ResolveRevision(right.String())
+			Expect(err).To(BeNil())
+
+			// When
+			_, err = repo.ExtendTimelapse(context.Background(), "file.txt", api.Timelapse{}, leftHash, rightHash, api.TimelapseOptions{})
+
+			// Then
+			Expect(err).ToNot(BeNil())
+		})
+	})
+})
+
+// timelapseAt is the timelapse of file.txt as it stood at commit, taken from
+// the progress reports of a full build.
+//
+func timelapseAt(repo *api.LocalGitRepo, commit api.Hash) api.Timelapse {
+	var result api.Timelapse
+	opts := api.TimelapseOptions{Progress: func(progress api.TimelapseProgress) {
+		if progress.Hash == commit {
+			result = append(api.Timelapse{}, progress.Partial...)
+		}
+	}}
+	_, err := repo.BuildTimelapse(context.Background(), "file.txt", opts)
+	Expect(err).To(BeNil())
+	return result
+}
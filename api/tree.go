@@ -0,0 +1,219 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TreeEntry is one thing in a directory: a file ("blob"), a subdirectory
+// ("tree"), or a submodule ("commit"), as git types them. Mode is git's, like
+// "100644" or "040000"; Size is only known for blobs, and is zero for the
+// rest. LastCommit is the newest commit that touched the entry.
+//
+type TreeEntry struct {
+	Name       string
+	Path       string
+	Type       string
+	Mode       string
+	Size       int64
+	Object     Hash
+	LastCommit *Commit
+}
+
+// TreeListing is what was in a directory (relative to the repository; empty
+// for the top of it) at a commit, subdirectories first and then by name.
+//
+type TreeListing struct {
+	Commit  Hash
+	Dir     string
+	Entries []TreeEntry
+}
+
+// ListTree lists dir as of rev, which can be anything ResolveRevision
+// accepts, along with the last commit to touch each entry. Those come from a
+// single walk back through the directory's history, which stops as soon as
+// every entry has been accounted for.
+//
+func (repo *LocalGitRepo) ListTree(ctx context.Context, rev, dir string) (*TreeListing, error) {
+	commit, err := repo.ResolveRevision(rev)
+	if err != nil {
+		return nil, err
+	}
+	dir = strings.Trim(dir, "/")
+
+	output, err := repo.runGit("-c", "core.quotepath=off", "ls-tree", "-l", "-z", fmt.Sprintf("%s:%s", commit, dir))
+	if err != nil {
+		return nil, errorOfKind(ErrPathNotFound, "No directory \"%s\" at revision %s", dir, rev)
+	}
+	result := TreeListing{Commit: commit, Dir: dir, Entries: []TreeEntry{}}
+	for _, record := range bytes.Split(output.Bytes(), []byte{0}) {
+		if len(record) == 0 {
+			continue
+		}
+		entry, err := parseTreeEntry(record, dir)
+		if err != nil {
+			return nil, err
+		}
+		result.Entries = append(result.Entries, entry)
+	}
+	sort.SliceStable(result.Entries, func(i, j int) bool {
+		a, b := result.Entries[i], result.Entries[j]
+		if (a.Type == "tree") != (b.Type == "tree") {
+			return a.Type == "tree"
+		}
+		return a.Name < b.Name
+	})
+
+	if err := repo.findLastCommits(ctx, commit, dir, result.Entries); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// parseTreeEntry reads one record of `git ls-tree -l -z` output.
+//
+func parseTreeEntry(record []byte, dir string) (TreeEntry, error) {
+	var entry TreeEntry
+	tab := bytes.IndexByte(record, '\t')
+	if tab < 0 {
+		return entry, fmt.Errorf("Unexpected git ls-tree output: \"%s\"", record)
+	}
+	fields := strings.Fields(string(record[:tab]))
+	if len(fields) != 4 {
+		return entry, fmt.Errorf("Unexpected git ls-tree output: \"%s\"", record)
+	}
+	entry.Mode, entry.Type = fields[0], fields[1]
+	entry.Name = string(record[tab+1:])
+	entry.Path = entry.Name
+	if len(dir) > 0 {
+		entry.Path = dir + "/" + entry.Name
+	}
+	copy(entry.Object[:], fields[2])
+	if fields[3] != "-" {
+		size, err := strconv.ParseInt(fields[3], 10, 64)
+		if err != nil {
+			return entry, fmt.Errorf("Unexpected size in git ls-tree output: \"%s\"", record)
+		}
+		entry.Size = size
+	}
+	return entry, nil
+}
+
+// findLastCommits walks back from commit through the history of dir, giving
+// each entry the first commit it sees change anything at or under it.
+//
+func (repo *LocalGitRepo) findLastCommits(ctx context.Context, commit Hash, dir string, entries []TreeEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	pending := make(map[string]*TreeEntry, len(entries))
+	for i := range entries {
+		pending[entries[i].Name] = &entries[i]
+	}
+	prefix := ""
+	pathspec := "."
+	if len(dir) > 0 {
+		prefix, pathspec = dir+"/", dir
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "git", "-c", "core.quotepath=off", "log", "--no-color", "--date", "iso-strict",
+		"--name-status", "--no-renames", commit.String(), "--", pathspec)
+	cmd.Dir = repo.Path
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	parseErr := parseLog(stdout, func(c *Commit) {
+		for _, change := range c.Changes {
+			name := strings.TrimPrefix(change.Path, prefix)
+			if i := strings.IndexByte(name, '/'); i >= 0 {
+				name = name[:i]
+			}
+			if entry, ok := pending[name]; ok {
+				entry.LastCommit = c
+				delete(pending, name)
+			}
+		}
+		if len(pending) == 0 {
+			cancel()
+		}
+	})
+	if parseErr != nil {
+		cancel()
+	}
+
+	waitErr := cmd.Wait()
+	switch {
+	case len(pending) == 0:
+		return nil
+	case parseErr != nil:
+		return parseErr
+	case ctx.Err() != nil:
+		return ctx.Err()
+	case waitErr != nil:
+		return CookedErrorFromGitExec(nil, stderr, waitErr)
+	}
+	return nil
+}
+
+// lastCommitForJSON is an entry's last commit without what it changed, which
+// is everything the commit did under the directory, and without line counts,
+// which the walk for last commits doesn't ask git for.
+//
+type lastCommitForJSON struct {
+	Hash   string    `json:"hash"`
+	Author string    `json:"author"`
+	Date   time.Time `json:"date"`
+	Desc   string    `json:"desc"`
+}
+
+type treeEntryForJSON struct {
+	Name       string             `json:"name"`
+	Path       string             `json:"path"`
+	Type       string             `json:"type"`
+	Mode       string             `json:"mode"`
+	Size       int64              `json:"size"`
+	Object     string             `json:"object"`
+	LastCommit *lastCommitForJSON `json:"lastCommit"`
+}
+
+type treeListingForJSON struct {
+	Commit  string             `json:"commit"`
+	Dir     string             `json:"dir"`
+	Entries []treeEntryForJSON `json:"entries"`
+}
+
+func (tl *TreeListing) ToJSON() ([]byte, error) {
+	facade := treeListingForJSON{Commit: tl.Commit.String(), Dir: tl.Dir, Entries: []treeEntryForJSON{}}
+	for _, entry := range tl.Entries {
+		entryFacade := treeEntryForJSON{
+			Name:   entry.Name,
+			Path:   entry.Path,
+			Type:   entry.Type,
+			Mode:   entry.Mode,
+			Size:   entry.Size,
+			Object: entry.Object.String(),
+		}
+		if entry.LastCommit != nil {
+			c := entry.LastCommit
+			entryFacade.LastCommit = &lastCommitForJSON{Hash: c.Hash.String(), Author: c.Author, Date: c.Date, Desc: c.Desc}
+		}
+		facade.Entries = append(facade.Entries, entryFacade)
+	}
+	return json.Marshal(facade)
+}
@@ -0,0 +1,125 @@
+package api_test
+
+import (
+	"github.com/rbwinslow/morlock/api"
+	"github.com/rbwinslow/morlock/test_util"
+
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Tree listings", func() {
+	type summary struct {
+		Name, Type, Mode string
+		Size             int64
+		Last             api.ShortHash
+	}
+	var summarize = func(listing *api.TreeListing) []summary {
+		var result []summary
+		for _, entry := range listing.Entries {
+			Expect(entry.LastCommit).ToNot(BeNil(), entry.Name)
+			result = append(result, summary{entry.Name, entry.Type, entry.Mode, entry.Size, entry.LastCommit.Hash.Short()})
+		}
+		return result
+	}
+
+	It("should list a directory with the last commit to touch each entry", func() {
+		test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+			// Given
+			tgr.MustAddFile("a.txt", "one\n")
+			first := tgr.MustCommit("first")
+			if err := os.Mkdir(path.Join(tgr.Path, "sub"), 0777); err != nil {
+				panic(err)
+			}
+			tgr.MustAddFile("sub/b.txt", "b\n")
+			second := tgr.MustCommit("second")
+			tgr.MustAddFile("a.txt", "one\ntwo\n")
+			third := tgr.MustCommit("third")
+			tgr.MustAddFile("sub/c.txt", "c\n")
+			fourth := tgr.MustCommit("fourth")
+			repo, err := api.OpenLocalGitRepo(tgr.Path, nil)
+			Expect(err).To(BeNil())
+			ctx := context.Background()
+
+			// When
+			top, err1 := repo.ListTree(ctx, "HEAD", "")
+			earlier, err2 := repo.ListTree(ctx, second.String(), "")
+			sub, err3 := repo.ListTree(ctx, "HEAD", "sub/")
+
+			// Then
+			Expect(err1).To(BeNil())
+			Expect(err2).To(BeNil())
+			Expect(err3).To(BeNil())
+			Expect(summarize(top)).To(Equal([]summary{
+				{"sub", "tree", "040000", 0, fourth},
+				{"a.txt", "blob", "100644", 8, third},
+			}))
+			Expect(summarize(earlier)).To(Equal([]summary{
+				{"sub", "tree", "040000", 0, second},
+				{"a.txt", "blob", "100644", 4, first},
+			}))
+			Expect(summarize(sub)).To(Equal([]summary{
+				{"b.txt", "blob", "100644", 2, second},
+				{"c.txt", "blob", "100644", 2, fourth},
+			}))
+			Expect(sub.Dir).To(Equal("sub"))
+			Expect(sub.Entries[0].Path).To(Equal("sub/b.txt"))
+		})
+	})
+
+	It("should give each entry's last commit in JSON without what the commit changed", func() {
+		test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+			// Given
+			tgr.MustAddFile("a.txt", "one\n")
+			tgr.MustAddFile("b.txt", "two\n")
+			first := tgr.MustCommit("first")
+			repo, err := api.OpenLocalGitRepo(tgr.Path, nil)
+			Expect(err).To(BeNil())
+			listing, err := repo.ListTree(context.Background(), "HEAD", "")
+			Expect(err).To(BeNil())
+
+			// When
+			js, err := listing.ToJSON()
+
+			// Then
+			Expect(err).To(BeNil())
+			var result struct {
+				Entries []struct {
+					LastCommit map[string]interface{}
+				}
+			}
+			Expect(json.Unmarshal(js, &result)).To(Succeed())
+			Expect(result.Entries).To(HaveLen(2))
+			for _, entry := range result.Entries {
+				Expect(entry.LastCommit).To(HaveLen(4))
+				Expect(entry.LastCommit).To(HaveKeyWithValue("desc", "first"))
+				Expect(entry.LastCommit["hash"]).To(HavePrefix(first.String()))
+				Expect(entry.LastCommit).NotTo(HaveKey("changes"))
+			}
+		})
+	})
+
+	It("should say when there's no such directory", func() {
+		test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+			// Given
+			tgr.MustAddFile("a.txt", "one\n")
+			tgr.MustCommit("first")
+			repo, err := api.OpenLocalGitRepo(tgr.Path, nil)
+			Expect(err).To(BeNil())
+
+			// When
+			_, missing := repo.ListTree(context.Background(), "HEAD", "nope")
+			_, file := repo.ListTree(context.Background(), "HEAD", "a.txt")
+
+			// Then
+			Expect(errors.Is(missing, api.ErrPathNotFound)).To(BeTrue())
+			Expect(errors.Is(file, api.ErrPathNotFound)).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,184 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// TreeFile is one file in a directory as of a particular commit.
+//
+type TreeFile struct {
+	Path  string
+	Size  int64
+	Lines int
+	Blob  Hash
+}
+
+// TreeChange is something a commit did to a file in the directory. Renamed
+// files report how their size changed relative to their old name.
+//
+type TreeChange struct {
+	FileChange
+	SizeDelta  int64
+	LinesDelta int
+}
+
+// A TreeFrame is the state of a directory right after one of the commits that
+// touched it.
+//
+type TreeFrame struct {
+	Commit
+	Files   []TreeFile
+	Changes []TreeChange
+}
+
+// TreeTimelapse is a directory's frames from its first commit to its latest.
+//
+type TreeTimelapse []TreeFrame
+
+// TreeTimelapse lists the commits that touched dir, oldest first, and
+// describes the directory's contents as of each one. Paths in the result are
+// relative to the repository, like dir itself; an empty dir means the whole
+// repository.
+//
+func (repo *LocalGitRepo) TreeTimelapse(dir string) (TreeTimelapse, error) {
+	dir = strings.Trim(dir, "/")
+	if len(dir) == 0 {
+		dir = "."
+	}
+
+	logOutput, err := repo.runGit("log", "--reverse", "--no-color", "--date", "iso-strict", "--name-status", "-M", "--", dir)
+	if err != nil {
+		return nil, err
+	}
+	var commits []*Commit
+	if err := parseLog(logOutput, func(c *Commit) { commits = append(commits, c) }); err != nil {
+		return nil, err
+	}
+
+	blobs, err := repo.newBlobReader()
+	if err != nil {
+		return nil, err
+	}
+	defer blobs.Close()
+
+	lineCounts := map[Hash]int{}
+	result := make(TreeTimelapse, 0, len(commits))
+	previous := map[string]TreeFile{}
+
+	for _, commit := range commits {
+		files, err := repo.listTree(commit.Hash, dir)
+		if err != nil {
+			return nil, err
+		}
+
+		current := make(map[string]TreeFile, len(files))
+		for i := range files {
+			lines, ok := lineCounts[files[i].Blob]
+			if !ok {
+				contents, err := blobs.read(files[i].Blob.String())
+				if err != nil {
+					return nil, err
+				}
+				lines = countLines(contents)
+				lineCounts[files[i].Blob] = lines
+			}
+			files[i].Lines = lines
+			current[files[i].Path] = files[i]
+		}
+
+		frame := TreeFrame{Commit: *commit, Files: files}
+		for _, change := range commit.Changes {
+			before := previous[change.Path]
+			if len(change.OldPath) > 0 {
+				before = previous[change.OldPath]
+			}
+			after := current[change.Path]
+			frame.Changes = append(frame.Changes, TreeChange{
+				FileChange: change,
+				SizeDelta:  after.Size - before.Size,
+				LinesDelta: after.Lines - before.Lines,
+			})
+		}
+
+		result = append(result, frame)
+		previous = current
+	}
+
+	return result, nil
+}
+
+// listTree describes the blobs under dir as of a commit, without line counts.
+//
+func (repo *LocalGitRepo) listTree(rev Hash, dir string) ([]TreeFile, error) {
+	output, err := repo.runGit("ls-tree", "-r", "-l", "-z", rev.String(), "--", dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []TreeFile
+	for _, record := range bytes.Split(output.Bytes(), []byte{0}) {
+		if len(record) == 0 {
+			continue
+		}
+		tab := bytes.IndexByte(record, '\t')
+		if tab < 0 {
+			return nil, fmt.Errorf("Unexpected git ls-tree output: \"%s\"", record)
+		}
+		fields := strings.Fields(string(record[:tab]))
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("Unexpected git ls-tree output: \"%s\"", record)
+		}
+		if fields[1] != "blob" {
+			continue
+		}
+		size, err := strconv.ParseInt(fields[3], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Unexpected size in git ls-tree output: \"%s\"", record)
+		}
+		file := TreeFile{Path: string(record[tab+1:]), Size: size}
+		copy(file.Blob[:], fields[2])
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+type treeFileForJSON struct {
+	Path  string `json:"path"`
+	Size  int64  `json:"size"`
+	Lines int    `json:"lines"`
+}
+
+type treeChangeForJSON struct {
+	fileChangeForJSON
+	SizeDelta  int64 `json:"sizeDelta"`
+	LinesDelta int   `json:"linesDelta"`
+}
+
+type treeFrameForJSON struct {
+	commitForJSON
+	Files   []treeFileForJSON   `json:"files"`
+	Changes []treeChangeForJSON `json:"changes"`
+}
+
+func (tt *TreeTimelapse) ToJSON() ([]byte, error) {
+	facades := []treeFrameForJSON{}
+	for _, frame := range *tt {
+		facade := treeFrameForJSON{
+			commitForJSON: *frame.Commit.forJSON(),
+			Files:         []treeFileForJSON{},
+			Changes:       []treeChangeForJSON{},
+		}
+		for _, file := range frame.Files {
+			facade.Files = append(facade.Files, treeFileForJSON{file.Path, file.Size, file.Lines})
+		}
+		for _, change := range frame.Changes {
+			facade.Changes = append(facade.Changes, treeChangeForJSON{change.FileChange.forJSON(), change.SizeDelta, change.LinesDelta})
+		}
+		facades = append(facades, facade)
+	}
+	return json.Marshal(facades)
+}
@@ -0,0 +1,83 @@
+package api_test
+
+import (
+	"github.com/rbwinslow/morlock/api"
+	"github.com/rbwinslow/morlock/test_util"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"os"
+	"path"
+)
+
+var _ = Describe("Tree timelapse", func() {
+	It("should describe a directory's files and changes at each commit", func() {
+		// Given
+		test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+			if err := os.MkdirAll(path.Join(tgr.Path, "pkg"), 0777); err != nil {
+				panic(err)
+			}
+			tgr.MustAddFile("pkg/a.txt", "one\ntwo\n")
+			tgr.MustAddFile("outside.txt", "not in the directory")
+			tgr.MustCommit("first")
+			tgr.MustAddFile("outside.txt", "still not in the directory")
+			tgr.MustCommit("doesn't touch pkg")
+			tgr.MustAddFile("pkg/a.txt", "one\ntwo\nthree\n")
+			tgr.MustAddFile("pkg/b.txt", "bee")
+			tgr.MustCommit("second")
+
+			// When
+			repo, err := api.OpenLocalGitRepo(tgr.Path, nil)
+			Expect(err).To(BeNil())
+			frames, err := repo.TreeTimelapse("pkg")
+
+			// Then
+			Expect(err).To(BeNil())
+			Expect(len(frames)).To(Equal(2))
+
+			Expect(frames[0].Desc).To(Equal("first"))
+			Expect(frames[0].Files).To(HaveLen(1))
+			Expect(frames[0].Files[0].Path).To(Equal("pkg/a.txt"))
+			Expect(frames[0].Files[0].Lines).To(Equal(2))
+			Expect(frames[0].Changes).To(HaveLen(1))
+			Expect(frames[0].Changes[0].Status).To(Equal(api.FILE_ADDED))
+
+			Expect(frames[1].Desc).To(Equal("second"))
+			Expect(frames[1].Files).To(HaveLen(2))
+			Expect(frames[1].Files[0].Size).To(Equal(int64(14)))
+			Expect(frames[1].Files[0].Lines).To(Equal(3))
+			Expect(frames[1].Files[1].Lines).To(Equal(1))
+			Expect(frames[1].Changes).To(HaveLen(2))
+			Expect(frames[1].Changes[0].Status).To(Equal(api.FILE_MODIFIED))
+			Expect(frames[1].Changes[0].LinesDelta).To(Equal(1))
+			Expect(frames[1].Changes[0].SizeDelta).To(Equal(int64(6)))
+			Expect(frames[1].Changes[1].Status).To(Equal(api.FILE_ADDED))
+			Expect(frames[1].Changes[1].Path).To(Equal("pkg/b.txt"))
+		})
+	})
+
+	It("should report renames within the directory", func() {
+		// Given
+		test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+			tgr.MustAddFile("old.txt", "same contents\n")
+			tgr.MustCommit("add")
+			tgr.MustRun("mv", "old.txt", "new.txt")
+			tgr.MustCommit("rename")
+
+			// When
+			repo, err := api.OpenLocalGitRepo(tgr.Path, nil)
+			Expect(err).To(BeNil())
+			frames, err := repo.TreeTimelapse("")
+
+			// Then
+			Expect(err).To(BeNil())
+			Expect(len(frames)).To(Equal(2))
+			Expect(frames[1].Files).To(HaveLen(1))
+			Expect(frames[1].Files[0].Path).To(Equal("new.txt"))
+			Expect(frames[1].Changes).To(HaveLen(1))
+			Expect(frames[1].Changes[0].Status).To(Equal(api.FILE_RENAMED))
+			Expect(frames[1].Changes[0].OldPath).To(Equal("old.txt"))
+			Expect(frames[1].Changes[0].SizeDelta).To(BeZero())
+		})
+	})
+})
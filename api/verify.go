@@ -0,0 +1,135 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// TimelapseDivergence is where a frame of a timelapse first disagrees with the
+// file it's supposed to show. Line counts from 1. Want and Got are the lines
+// there in the file and in the timelapse; either is empty when its side ran
+// out of lines first, which WantLines and GotLines make plain. Hunk and
+// HunkLine say where in the timelapse Got came from, and are -1 when the
+// timelapse ran out.
+//
+type TimelapseDivergence struct {
+	Line                int
+	Want, Got           string
+	WantLines, GotLines int
+	Hunk, HunkLine      int
+}
+
+func (td *TimelapseDivergence) String() string {
+	format := "At line %d: file has %d lines (%.20q), timelapse has %d present lines (%.20q), from hunk %d, line %d"
+	return fmt.Sprintf(format, td.Line, td.WantLines, td.Want, td.GotLines, td.Got, td.Hunk, td.HunkLine)
+}
+
+// Compare checks that the PRESENT lines of tl are exactly contents, and says
+// where they first differ. It gives back nil when they don't.
+//
+func (tl Timelapse) Compare(contents []byte) *TimelapseDivergence {
+	want := splitLines(string(contents))
+	gotLines := 0
+	for _, hunk := range tl {
+		if hunk.Disposition == PRESENT {
+			gotLines += len(hunk.Lines)
+		}
+	}
+
+	line := 0
+	for h, hunk := range tl {
+		if hunk.Disposition != PRESENT {
+			continue
+		}
+		for l, got := range hunk.Lines {
+			if line >= len(want) || want[line] != got {
+				result := TimelapseDivergence{Line: line + 1, Got: got, WantLines: len(want), GotLines: gotLines, Hunk: h, HunkLine: l}
+				if line < len(want) {
+					result.Want = want[line]
+				}
+				return &result
+			}
+			line++
+		}
+	}
+	if line < len(want) {
+		return &TimelapseDivergence{Line: line + 1, Want: want[line], WantLines: len(want), GotLines: gotLines, Hunk: -1, HunkLine: -1}
+	}
+	return nil
+}
+
+// TimelapseVerification is what VerifyTimelapse found. Frames counts the
+// frames that were checked; when one didn't match git, Commit is the commit
+// it was built for, and Divergence says how it went wrong.
+//
+type TimelapseVerification struct {
+	Path       string
+	Frames     int
+	Total      int
+	Commit     *Commit
+	Divergence *TimelapseDivergence
+}
+
+func (tv *TimelapseVerification) String() string {
+	if tv.Divergence == nil {
+		return fmt.Sprintf("%s: all %d frames match git", tv.Path, tv.Frames)
+	}
+	return fmt.Sprintf("%s: frame %d of %d, for commit %s (%s), doesn't match git\n  %s",
+		tv.Path, tv.Frames, tv.Total, tv.Commit.Hash.Short(), tv.Commit.Subject(), tv.Divergence)
+}
+
+// VerifyTimelapse builds p's timelapse, and checks every frame of it against
+// the file as git has it at the frame's commit, stopping at the first frame
+// that doesn't match. Errors building the timelapse come back as errors;
+// frames that build but are wrong come back in the verification.
+//
+func (repo *LocalGitRepo) VerifyTimelapse(ctx context.Context, p string, opts TimelapseOptions) (*TimelapseVerification, error) {
+	blobs, err := repo.newBlobReader()
+	if err != nil {
+		return nil, err
+	}
+	defer blobs.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	result := TimelapseVerification{Path: p}
+	var verifyErr error
+	progress := opts.Progress
+	opts.Progress = func(tp TimelapseProgress) {
+		if progress != nil {
+			progress(tp)
+		}
+		if verifyErr != nil || result.Divergence != nil {
+			return
+		}
+		result.Frames, result.Total = tp.Processed, tp.Total
+
+		contents, err := blobs.read(fmt.Sprintf("%s:%s", tp.Hash, strings.TrimLeft(p, "/")))
+		if err == errObjectMissing {
+			contents, err = nil, nil
+		}
+		if err != nil {
+			verifyErr = err
+			cancel()
+			return
+		}
+		if divergence := tp.Partial.Compare(contents); divergence != nil {
+			commit := tp.Commit
+			result.Commit, result.Divergence = &commit, divergence
+			cancel()
+		}
+	}
+
+	_, err = repo.BuildTimelapse(ctx, p, opts)
+	if verifyErr != nil {
+		return nil, verifyErr
+	}
+	if result.Divergence != nil {
+		return &result, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
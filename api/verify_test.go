@@ -0,0 +1,94 @@
+package api_test
+
+import (
+	"github.com/rbwinslow/morlock/api"
+	"github.com/rbwinslow/morlock/test_util"
+
+	"context"
+	"os"
+	"path"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Timelapse verification", func() {
+	var tl = api.Timelapse{
+		{api.PRESENT, []string{"one"}},
+		{api.DELETED, []string{"two"}},
+		{api.PRESENT, []string{"three", "four"}},
+	}
+
+	It("should find nothing wrong with a matching frame", func() {
+		Expect(tl.Compare([]byte("one\nthree\nfour\n"))).To(BeNil())
+		Expect(api.Timelapse{}.Compare(nil)).To(BeNil())
+	})
+
+	It("should point out the first line that differs", func() {
+		divergence := tl.Compare([]byte("one\nthree\nfive\n"))
+
+		Expect(divergence).ToNot(BeNil())
+		Expect(*divergence).To(Equal(api.TimelapseDivergence{
+			Line: 3, Want: "five", Got: "four", WantLines: 3, GotLines: 3, Hunk: 2, HunkLine: 1,
+		}))
+		Expect(divergence.String()).To(ContainSubstring("At line 3"))
+	})
+
+	It("should notice when either side runs out of lines first", func() {
+		short := tl.Compare([]byte("one\nthree\nfour\nfive\n"))
+		long := tl.Compare([]byte("one\nthree\n"))
+
+		Expect(*short).To(Equal(api.TimelapseDivergence{
+			Line: 4, Want: "five", WantLines: 4, GotLines: 3, Hunk: -1, HunkLine: -1,
+		}))
+		Expect(*long).To(Equal(api.TimelapseDivergence{
+			Line: 3, Got: "four", WantLines: 2, GotLines: 3, Hunk: 2, HunkLine: 1,
+		}))
+	})
+
+	It("should check every frame of a real history against git", func() {
+		test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+			// Given
+			tgr.MustAddFile("file.txt", "a\nb\nc\n")
+			tgr.MustCommit("first")
+			tgr.MustAddFile("file.txt", "a\nc\nd")
+			tgr.MustCommit("second")
+			tgr.MustRun("rm", "-q", "file.txt")
+			tgr.MustCommit("gone")
+			tgr.MustAddFile("file.txt", "back\n")
+			tgr.MustCommit("back again")
+			repo, err := api.OpenLocalGitRepo(tgr.Path, nil)
+			Expect(err).To(BeNil())
+
+			// When
+			verification, err := repo.VerifyTimelapse(context.Background(), "file.txt", api.TimelapseOptions{})
+
+			// Then
+			Expect(err).To(BeNil())
+			Expect(verification.Divergence).To(BeNil())
+			Expect(verification.Frames).To(Equal(4))
+			Expect(verification.String()).To(Equal("file.txt: all 4 frames match git"))
+		})
+	})
+
+	It("should list the files it can verify", func() {
+		test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+			tgr.MustAddFile("top.txt", "a")
+			if err := os.Mkdir(path.Join(tgr.Path, "sub"), 0777); err != nil {
+				panic(err)
+			}
+			tgr.MustAddFile("sub/inner.txt", "b")
+			tgr.MustCommit("files")
+			repo, err := api.OpenLocalGitRepo(tgr.Path, nil)
+			Expect(err).To(BeNil())
+
+			all, err1 := repo.TrackedFiles("")
+			sub, err2 := repo.TrackedFiles("sub")
+
+			Expect(err1).To(BeNil())
+			Expect(err2).To(BeNil())
+			Expect(all).To(Equal([]string{"sub/inner.txt", "top.txt"}))
+			Expect(sub).To(Equal([]string{"sub/inner.txt"}))
+		})
+	})
+})
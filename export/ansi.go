@@ -0,0 +1,45 @@
+package export
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rbwinslow/morlock/api"
+)
+
+const (
+	ANSI_RESET        = "\x1b[0m"
+	ANSI_FAINT        = "\x1b[2m"
+	ANSI_REVERSE      = "\x1b[7m"
+	ANSI_RED          = "\x1b[31m"
+	ANSI_GREEN        = "\x1b[32m"
+	ANSI_CLEAR        = "\x1b[K"
+	ANSI_CLEAR_SCREEN = "\x1b[2J"
+	ANSI_HOME         = "\x1b[H"
+)
+
+// ANSIRow is row as a terminal shows it, width columns wide at most: its
+// number in a gutter that wide, a + or - for a change, and the text, green
+// when it was added and red when it was deleted. Lines deleted before are
+// faint. The color is left on, for whatever follows to reset.
+//
+func ANSIRow(row Row, gutter, width int) string {
+	number := strings.Repeat(" ", gutter)
+	if row.Number > 0 {
+		number = fmt.Sprintf("%*d", gutter, row.Number)
+	}
+	color, marker := "", " "
+	switch {
+	case row.Change == api.LINE_ADDED:
+		color, marker = ANSI_GREEN, "+"
+	case row.Change == api.LINE_DELETED:
+		color, marker = ANSI_RED, "-"
+	case row.Number == 0:
+		color = ANSI_FAINT
+	}
+	prefix := number + " " + marker + " "
+	if len(prefix) >= width {
+		return color + Clip(prefix, width)
+	}
+	return color + prefix + Clip(row.Text, width-len(prefix))
+}
@@ -0,0 +1,193 @@
+package export
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/rbwinslow/morlock/api"
+)
+
+const (
+	ASCIICAST_MAX_COLUMNS  = 500
+	ASCIICAST_MAX_ROWS     = 300
+	ASCIICAST_MAX_DURATION = 24 * time.Hour
+
+	// ASCIICAST_LAST_FRAME_HOLD is how long the last frame stays up before
+	// the recording ends.
+	ASCIICAST_LAST_FRAME_HOLD = 2 * time.Second
+)
+
+// AsciicastOptions shape an asciicast recording: a terminal Columns wide and
+// Rows tall, the top row a header describing the commit. Frames come either
+// every Delay, or, when Duration is set instead, as far apart as their
+// commits were, with the whole history squeezed into Duration.
+//
+type AsciicastOptions struct {
+	Playback
+	Duration      time.Duration
+	Columns, Rows int
+}
+
+var DefaultAsciicastOptions = AsciicastOptions{
+	Playback: Playback{Delay: time.Second, MaxFrames: 1000},
+	Columns:  80,
+	Rows:     24,
+}
+
+func (opts *AsciicastOptions) Validate() error {
+	if opts.Delay != 0 && opts.Duration != 0 {
+		return errors.New("Frames can come at an interval or over a duration, not both")
+	}
+	if err := opts.Playback.validate(PLAYBACK_MAX_FRAMES); err != nil {
+		return err
+	}
+	switch {
+	case opts.Duration < 0 || opts.Duration > ASCIICAST_MAX_DURATION:
+		return fmt.Errorf("Bad duration %s; expected at most %s", opts.Duration, ASCIICAST_MAX_DURATION)
+	case opts.Columns < 0 || opts.Columns > ASCIICAST_MAX_COLUMNS:
+		return fmt.Errorf("Bad column count %d; expected at most %d", opts.Columns, ASCIICAST_MAX_COLUMNS)
+	case opts.Rows == 1 || opts.Rows < 0 || opts.Rows > ASCIICAST_MAX_ROWS:
+		return fmt.Errorf("Bad row count %d; expected 2 to %d", opts.Rows, ASCIICAST_MAX_ROWS)
+	}
+	return nil
+}
+
+func (opts AsciicastOptions) withDefaults() AsciicastOptions {
+	defaults := DefaultAsciicastOptions.Playback
+	if opts.Duration != 0 {
+		defaults.Delay = 0
+	}
+	opts.Playback = opts.Playback.withDefaults(defaults)
+	if opts.Columns == 0 {
+		opts.Columns = DefaultAsciicastOptions.Columns
+	}
+	if opts.Rows == 0 {
+		opts.Rows = DefaultAsciicastOptions.Rows
+	}
+	return opts
+}
+
+type asciicastHeaderForJSON struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env"`
+}
+
+// WriteAsciicast writes frames (as LoadFrames makes them) as an asciicast v2
+// recording of p's history: a header, then an event per frame that redraws
+// the whole screen, then an empty event to hold the last frame up a while.
+//
+func WriteAsciicast(w io.Writer, p string, frames []api.TimelapseProgress, opts AsciicastOptions) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	opts = opts.withDefaults()
+	frames = Sample(frames, opts.MaxFrames)
+	if len(frames) == 0 {
+		return errors.New("No frames to make a recording of")
+	}
+
+	header := asciicastHeaderForJSON{
+		Version:   2,
+		Width:     opts.Columns,
+		Height:    opts.Rows,
+		Timestamp: frames[len(frames)-1].Commit.Date.Unix(),
+		Title:     p,
+		Env:       map[string]string{"TERM": "xterm-256color"},
+	}
+	if err := writeJSONLine(w, header); err != nil {
+		return err
+	}
+
+	times := frameTimes(frames, opts)
+	var prev api.Timelapse
+	for i, frame := range frames {
+		screen := renderAsciicastFrame(frame, prev, i, len(frames), opts)
+		if err := writeJSONLine(w, []interface{}{seconds(times[i]), "o", screen}); err != nil {
+			return err
+		}
+		prev = frame.Partial
+	}
+	end := times[len(times)-1] + ASCIICAST_LAST_FRAME_HOLD
+	return writeJSONLine(w, []interface{}{seconds(end), "o", ""})
+}
+
+// frameTimes is when each frame comes up: every Delay, or at its commit's
+// date, scaled so that the first comes at the start and the last at Duration.
+// Commit dates don't always go forward, but the frames always do.
+//
+func frameTimes(frames []api.TimelapseProgress, opts AsciicastOptions) []time.Duration {
+	times := make([]time.Duration, len(frames))
+	first, last := frames[0].Commit.Date, frames[len(frames)-1].Commit.Date
+	span := last.Sub(first)
+	for i, frame := range frames {
+		switch {
+		case opts.Duration == 0:
+			times[i] = time.Duration(i) * opts.Delay
+		case len(frames) == 1:
+			times[i] = 0
+		case span <= 0:
+			times[i] = opts.Duration * time.Duration(i) / time.Duration(len(frames)-1)
+		default:
+			elapsed := float64(frame.Commit.Date.Sub(first)) / float64(span)
+			times[i] = time.Duration(elapsed * float64(opts.Duration))
+		}
+		if times[i] < 0 {
+			times[i] = 0
+		}
+		if times[i] > opts.Duration && opts.Duration > 0 {
+			times[i] = opts.Duration
+		}
+		if i > 0 && times[i] < times[i-1] {
+			times[i] = times[i-1]
+		}
+	}
+	return times
+}
+
+// renderAsciicastFrame draws a frame on a cleared screen: a header describing
+// the commit and how far through the history it is, and then the rows around
+// the first change.
+//
+func renderAsciicastFrame(frame api.TimelapseProgress, prev api.Timelapse, i, count int, opts AsciicastOptions) string {
+	var b strings.Builder
+	b.WriteString(ANSI_HOME + ANSI_CLEAR_SCREEN)
+
+	counter := fmt.Sprintf("%d/%d ", i+1, count)
+	caption := Clip(Caption(frame.Commit), opts.Columns-len(counter))
+	if pad := opts.Columns - len([]rune(caption)) - len(counter); pad > 0 {
+		caption += strings.Repeat(" ", pad)
+	}
+	b.WriteString(ANSI_REVERSE + caption + Clip(counter, opts.Columns) + ANSI_RESET)
+
+	rows := Rows(frame.Partial, prev, false)
+	gutter := GutterWidth(rows)
+	height := opts.Rows - 1
+	top := ScrollTop(rows, height)
+	for i := top; i < top+height && i < len(rows); i++ {
+		b.WriteString("\r\n" + ANSIRow(rows[i], gutter, opts.Columns) + ANSI_RESET)
+	}
+	return b.String()
+}
+
+// seconds is how asciicast events are timed: in seconds, to the microsecond.
+//
+func seconds(d time.Duration) float64 {
+	return d.Round(time.Microsecond).Seconds()
+}
+
+func writeJSONLine(w io.Writer, v interface{}) error {
+	js, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(js))
+	return err
+}
@@ -0,0 +1,110 @@
+package export_test
+
+import (
+	"github.com/rbwinslow/morlock/api"
+	"github.com/rbwinslow/morlock/export"
+	"github.com/rbwinslow/morlock/test_util"
+
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type asciicastEvent struct {
+	Time float64
+	Data string
+}
+
+func mustParseAsciicast(b *bytes.Buffer) (header map[string]interface{}, events []asciicastEvent) {
+	scanner := bufio.NewScanner(b)
+	Expect(scanner.Scan()).To(BeTrue())
+	Expect(json.Unmarshal(scanner.Bytes(), &header)).To(Succeed())
+	for scanner.Scan() {
+		var event []interface{}
+		Expect(json.Unmarshal(scanner.Bytes(), &event)).To(Succeed())
+		Expect(event).To(HaveLen(3))
+		Expect(event[1]).To(Equal("o"))
+		events = append(events, asciicastEvent{event[0].(float64), event[2].(string)})
+	}
+	return
+}
+
+var _ = Describe("asciicast export", func() {
+	It("should redraw the screen for each commit, in color, at fixed intervals", func() {
+		test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+			// Given
+			tgr.MustAddFile("file.txt", "a\nb\n")
+			first := tgr.MustCommit("first")
+			tgr.MustAddFile("file.txt", "a\nc\n")
+			tgr.MustCommit("second")
+			frames := mustLoadFrames(tgr, "file.txt")
+			var b bytes.Buffer
+
+			// When
+			err := export.WriteAsciicast(&b, "file.txt", frames, export.AsciicastOptions{Playback: export.Playback{Delay: 1500 * time.Millisecond}, Columns: 60, Rows: 5})
+
+			// Then
+			Expect(err).To(BeNil())
+			header, events := mustParseAsciicast(&b)
+			Expect(header["version"]).To(BeNumerically("==", 2))
+			Expect(header["width"]).To(BeNumerically("==", 60))
+			Expect(header["height"]).To(BeNumerically("==", 5))
+			Expect(header["title"]).To(Equal("file.txt"))
+
+			Expect(events).To(HaveLen(3))
+			Expect(events[0].Time).To(Equal(0.0))
+			Expect(events[1].Time).To(Equal(1.5))
+			Expect(events[2]).To(Equal(asciicastEvent{3.5, ""}))
+
+			lines := strings.Split(events[0].Data, "\r\n")
+			Expect(lines[0]).To(HavePrefix(export.ANSI_HOME + export.ANSI_CLEAR_SCREEN + export.ANSI_REVERSE + " " + first.String()))
+			Expect(lines[0]).To(ContainSubstring("first"))
+			Expect(lines[0]).To(ContainSubstring("1/2"))
+			Expect(lines[1]).To(Equal(export.ANSI_GREEN + "   1 + a" + export.ANSI_RESET))
+
+			lines = strings.Split(events[1].Data, "\r\n")
+			Expect(lines).To(HaveLen(4))
+			Expect(lines[1]).To(Equal("   1   a" + export.ANSI_RESET))
+			Expect(lines[2]).To(Equal(export.ANSI_RED + "     - b" + export.ANSI_RESET))
+			Expect(lines[3]).To(Equal(export.ANSI_GREEN + "   2 + c" + export.ANSI_RESET))
+		})
+	})
+
+	It("should space frames by their commits' dates, squeezed into the duration", func() {
+		// Given
+		start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		var frames []api.TimelapseProgress
+		for _, days := range []int{0, 1, 9, 7, 10} {
+			frames = append(frames, api.TimelapseProgress{
+				Commit:  api.Commit{Date: start.AddDate(0, 0, days), Desc: fmt.Sprint(days)},
+				Partial: api.Timelapse{{Disposition: api.PRESENT, Lines: []string{fmt.Sprint(days)}}},
+			})
+		}
+		var b bytes.Buffer
+
+		// When
+		err := export.WriteAsciicast(&b, "file.txt", frames, export.AsciicastOptions{Duration: 20 * time.Second})
+
+		// Then
+		Expect(err).To(BeNil())
+		_, events := mustParseAsciicast(&b)
+		var times []float64
+		for _, event := range events {
+			times = append(times, event.Time)
+		}
+		Expect(times).To(Equal([]float64{0, 2, 18, 18, 20, 22}))
+	})
+
+	It("should take an interval or a duration, not both", func() {
+		opts := export.AsciicastOptions{Playback: export.Playback{Delay: time.Second}, Duration: time.Minute}
+		Expect(opts.Validate()).NotTo(BeNil())
+		opts = export.AsciicastOptions{Rows: 1}
+		Expect(opts.Validate()).NotTo(BeNil())
+	})
+})
@@ -0,0 +1,184 @@
+// Package export turns a file's timelapse into things that play it back
+// outside of morlock: each frame is the file as one commit left it, with the
+// lines that commit added and deleted picked out.
+//
+package export
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"unicode"
+
+	"github.com/rbwinslow/morlock/api"
+)
+
+const TAB_WIDTH = 8
+
+// LoadFrames builds p's timelapse, keeping the frame each commit made along
+// the way, oldest first. opts.Progress, if any, still hears about each one.
+// A file with no history has no frames, which is ErrPathNotFound.
+//
+func LoadFrames(ctx context.Context, repo *api.LocalGitRepo, p string, opts api.TimelapseOptions) ([]api.TimelapseProgress, error) {
+	var frames []api.TimelapseProgress
+	progress := opts.Progress
+	opts.Progress = func(tp api.TimelapseProgress) {
+		frames = append(frames, tp)
+		if progress != nil {
+			progress(tp)
+		}
+	}
+	if _, err := repo.BuildTimelapse(ctx, p, opts); err != nil {
+		return nil, err
+	}
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("%w in the history: \"%s\"", api.ErrPathNotFound, p)
+	}
+	return frames, nil
+}
+
+// Sample picks at most max of frames, spread evenly over the history, always
+// including the last. When max is zero or less, all of them are kept.
+//
+func Sample(frames []api.TimelapseProgress, max int) []api.TimelapseProgress {
+	if max <= 0 || len(frames) <= max {
+		return frames
+	}
+	if max == 1 {
+		return frames[len(frames)-1:]
+	}
+	sample := make([]api.TimelapseProgress, max)
+	for i := range sample {
+		sample[i] = frames[i*(len(frames)-1)/(max-1)]
+	}
+	return sample
+}
+
+// The most any export can ask for. Some formats take fewer frames than this.
+//
+const (
+	PLAYBACK_MAX_FRAMES = 5000
+	PLAYBACK_MAX_DELAY  = time.Minute
+)
+
+// Playback is what every export has in common: each frame stays up for
+// Delay, and at most MaxFrames commits make it in, picked by Sample. Each
+// format's options embed it, and zero values get that format's defaults.
+//
+type Playback struct {
+	Delay     time.Duration
+	MaxFrames int
+}
+
+// validate checks pb against the limits, with maxFrames the most frames the
+// format can take.
+//
+func (pb Playback) validate(maxFrames int) error {
+	switch {
+	case pb.Delay < 0 || pb.Delay > PLAYBACK_MAX_DELAY:
+		return fmt.Errorf("Bad delay %s; expected at most %s", pb.Delay, PLAYBACK_MAX_DELAY)
+	case pb.MaxFrames < 0 || pb.MaxFrames > maxFrames:
+		return fmt.Errorf("Bad frame limit %d; expected at most %d", pb.MaxFrames, maxFrames)
+	}
+	return nil
+}
+
+func (pb Playback) withDefaults(defaults Playback) Playback {
+	if pb.Delay == 0 {
+		pb.Delay = defaults.Delay
+	}
+	if pb.MaxFrames == 0 {
+		pb.MaxFrames = defaults.MaxFrames
+	}
+	return pb
+}
+
+// Row is a line of a frame as it's shown. Number is the line's number in the
+// file, or zero for a deleted line.
+//
+type Row struct {
+	Number int
+	Text   string
+	Change api.LineChange
+}
+
+// Rows lays out frame, picking out the changes since prev, an earlier frame
+// of the same build (or nil for the first). Lines deleted before prev are
+// left out unless withDeleted is set.
+//
+func Rows(frame, prev api.Timelapse, withDeleted bool) []Row {
+	changes := frame.ChangesSince(prev)
+	var rows []Row
+	number, i := 0, 0
+	for _, hunk := range frame {
+		for _, line := range hunk.Lines {
+			change := changes[i]
+			i++
+			if hunk.Disposition == api.PRESENT {
+				number++
+				rows = append(rows, Row{number, line, change})
+			} else if change == api.LINE_DELETED || withDeleted {
+				rows = append(rows, Row{0, line, change})
+			}
+		}
+	}
+	return rows
+}
+
+// FirstChange is the index of the first row that changed, or -1.
+//
+func FirstChange(rows []Row) int {
+	for i, row := range rows {
+		if row.Change != api.LINE_KEPT {
+			return i
+		}
+	}
+	return -1
+}
+
+// ScrollTop is the first of rows to show in a window height rows tall, so
+// that the first change is a third of the way down it.
+//
+func ScrollTop(rows []Row, height int) int {
+	top := FirstChange(rows) - height/3
+	if last := len(rows) - height; top > last {
+		top = last
+	}
+	if top < 0 {
+		top = 0
+	}
+	return top
+}
+
+// GutterWidth is how many columns the line numbers of rows take up.
+//
+func GutterWidth(rows []Row) int {
+	width := len(fmt.Sprint(len(rows)))
+	if width < 4 {
+		width = 4
+	}
+	return width
+}
+
+// Clip makes s safe to show in width columns: tabs expanded, other control
+// characters made visible, and anything past the edge cut off.
+//
+func Clip(s string, width int) string {
+	var out []rune
+	for _, r := range s {
+		if len(out) >= width {
+			break
+		}
+		switch {
+		case r == '\t':
+			for pad := TAB_WIDTH - len(out)%TAB_WIDTH; pad > 0 && len(out) < width; pad-- {
+				out = append(out, ' ')
+			}
+		case unicode.IsControl(r):
+			out = append(out, '?')
+		default:
+			out = append(out, r)
+		}
+	}
+	return string(out)
+}
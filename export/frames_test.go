@@ -0,0 +1,102 @@
+package export_test
+
+import (
+	"github.com/rbwinslow/morlock/api"
+	"github.com/rbwinslow/morlock/export"
+	"github.com/rbwinslow/morlock/test_util"
+
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func mustLoadFrames(tgr *test_util.TemporaryGitRepo, p string) []api.TimelapseProgress {
+	repo, err := api.OpenLocalGitRepo(tgr.Path, nil)
+	Expect(err).To(BeNil())
+	frames, err := export.LoadFrames(context.Background(), repo, p, api.TimelapseOptions{})
+	Expect(err).To(BeNil())
+	return frames
+}
+
+var _ = Describe("frames", func() {
+	It("should keep a frame per commit, and lay each out with its changes", func() {
+		test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+			// Given
+			tgr.MustAddFile("file.txt", "a\nb\n")
+			tgr.MustCommit("first")
+			tgr.MustAddFile("file.txt", "a\nc\n")
+			tgr.MustCommit("second")
+			tgr.MustAddFile("file.txt", "a\n")
+			tgr.MustCommit("third")
+
+			// When
+			frames := mustLoadFrames(tgr, "file.txt")
+			rows := export.Rows(frames[2].Partial, frames[1].Partial, false)
+			all := export.Rows(frames[2].Partial, frames[1].Partial, true)
+
+			// Then
+			Expect(frames).To(HaveLen(3))
+			Expect(frames[0].Commit.Desc).To(Equal("first"))
+			Expect(rows).To(Equal([]export.Row{
+				{1, "a", api.LINE_KEPT},
+				{0, "c", api.LINE_DELETED},
+			}))
+			Expect(all).To(Equal([]export.Row{
+				{1, "a", api.LINE_KEPT},
+				{0, "b", api.LINE_KEPT},
+				{0, "c", api.LINE_DELETED},
+			}))
+			Expect(export.FirstChange(rows)).To(Equal(1))
+		})
+	})
+
+	It("should say when a file has no history", func() {
+		test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+			tgr.MustAddFile("file.txt", "a\n")
+			tgr.MustCommit("first")
+			tgr.MustAddFile("new.txt", "b\n")
+			repo, err := api.OpenLocalGitRepo(tgr.Path, nil)
+			Expect(err).To(BeNil())
+
+			_, err = export.LoadFrames(context.Background(), repo, "new.txt", api.TimelapseOptions{})
+
+			Expect(errors.Is(err, api.ErrPathNotFound)).To(BeTrue())
+		})
+	})
+
+	It("should sample frames evenly, keeping the last", func() {
+		frames := make([]api.TimelapseProgress, 10)
+		for i := range frames {
+			frames[i].Processed = i + 1
+		}
+		processed := func(sample []api.TimelapseProgress) (result []int) {
+			for _, frame := range sample {
+				result = append(result, frame.Processed)
+			}
+			return
+		}
+
+		Expect(processed(export.Sample(frames, 4))).To(Equal([]int{1, 4, 7, 10}))
+		Expect(processed(export.Sample(frames, 1))).To(Equal([]int{10}))
+		Expect(export.Sample(frames, 0)).To(HaveLen(10))
+		Expect(export.Sample(frames, 20)).To(HaveLen(10))
+	})
+
+	It("should scroll the first change a third of the way down", func() {
+		rows := make([]export.Row, 100)
+		rows[50].Change = api.LINE_ADDED
+
+		Expect(export.ScrollTop(rows, 30)).To(Equal(40))
+		Expect(export.ScrollTop(rows[:60], 30)).To(Equal(30))
+		Expect(export.ScrollTop(rows[40:], 30)).To(Equal(0))
+		Expect(export.ScrollTop(rows[51:], 30)).To(Equal(0))
+	})
+
+	It("should clip text to fit, expanding tabs and hiding control characters", func() {
+		Expect(export.Clip("a\tb\x1bc", 20)).To(Equal("a       b?c"))
+		Expect(export.Clip("héllo world", 5)).To(Equal("héllo"))
+		Expect(export.Clip("\tx", 4)).To(Equal("    "))
+	})
+})
@@ -0,0 +1,262 @@
+package export
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/rbwinslow/morlock/api"
+)
+
+// Indexes into gifPalette.
+//
+const (
+	GIF_PAPER uint8 = iota
+	GIF_INK
+	GIF_GUTTER
+	GIF_ADDED
+	GIF_DELETED
+	GIF_PROGRESS
+)
+
+var gifPalette = color.Palette{
+	color.RGBA{0xff, 0xff, 0xff, 0xff},
+	color.RGBA{0x24, 0x29, 0x2f, 0xff},
+	color.RGBA{0x8c, 0x95, 0x9f, 0xff},
+	color.RGBA{0xd2, 0xf8, 0xd9, 0xff},
+	color.RGBA{0xff, 0xd7, 0xd5, 0xff},
+	color.RGBA{0x09, 0x69, 0xda, 0xff},
+}
+
+// The most a GIF can ask for, so that nobody has to wait on, or store, an
+// image much bigger than anyone would want.
+//
+const (
+	GIF_MAX_FRAMES  = 500
+	GIF_MAX_COLUMNS = 300
+	GIF_MAX_ROWS    = 200
+	GIF_MAX_SCALE   = 4
+
+	// GIF_MAX_PIXELS caps the pixels of all the frames together, since each
+	// is kept until the GIF is encoded. Any one of the limits above is fine
+	// on its own, but all of them at once would be billions.
+	GIF_MAX_PIXELS = 100 * 1000 * 1000
+
+	// GIF_PROGRESS_HEIGHT is how tall, in pixels before scaling, the bar
+	// showing how far through the history a frame is.
+	GIF_PROGRESS_HEIGHT = 2
+
+	// GIF_LAST_FRAME_HOLD is how many times longer the last frame stays
+	// up than the others, so the loop starting over doesn't hide it.
+	GIF_LAST_FRAME_HOLD = 3
+)
+
+// GIFOptions shape an animated GIF: each frame shows Rows lines of Columns
+// characters, and then there's a caption describing the commit. Every pixel
+// is blown up to Scale by Scale.
+//
+type GIFOptions struct {
+	Playback
+	Columns, Rows int
+	Scale         int
+}
+
+var DefaultGIFOptions = GIFOptions{
+	Playback: Playback{Delay: 500 * time.Millisecond, MaxFrames: 100},
+	Columns:  80,
+	Rows:     30,
+	Scale:    2,
+}
+
+func (opts *GIFOptions) Validate() error {
+	if err := opts.Playback.validate(GIF_MAX_FRAMES); err != nil {
+		return err
+	}
+	switch {
+	case opts.Columns < 0 || opts.Columns > GIF_MAX_COLUMNS:
+		return fmt.Errorf("Bad column count %d; expected at most %d", opts.Columns, GIF_MAX_COLUMNS)
+	case opts.Rows < 0 || opts.Rows > GIF_MAX_ROWS:
+		return fmt.Errorf("Bad row count %d; expected at most %d", opts.Rows, GIF_MAX_ROWS)
+	case opts.Scale < 0 || opts.Scale > GIF_MAX_SCALE:
+		return fmt.Errorf("Bad scale %d; expected at most %d", opts.Scale, GIF_MAX_SCALE)
+	}
+	if pixels := opts.withDefaults().pixels(); pixels > GIF_MAX_PIXELS {
+		return fmt.Errorf("A GIF that big could take %d pixels; expected at most %d, so ask for fewer frames, columns or rows, or a smaller scale",
+			pixels, GIF_MAX_PIXELS)
+	}
+	return nil
+}
+
+// pixels is how many pixels the frames could take, every one of them in full:
+// the rows, the progress bar and the caption, Columns wide, all blown up to
+// Scale, and MaxFrames of them.
+//
+func (opts GIFOptions) pixels() int {
+	width := opts.Columns * CELL_WIDTH * opts.Scale
+	height := (opts.Rows*CELL_HEIGHT + GIF_PROGRESS_HEIGHT + CELL_HEIGHT) * opts.Scale
+	return width * height * opts.MaxFrames
+}
+
+func (opts GIFOptions) withDefaults() GIFOptions {
+	opts.Playback = opts.Playback.withDefaults(DefaultGIFOptions.Playback)
+	if opts.Columns == 0 {
+		opts.Columns = DefaultGIFOptions.Columns
+	}
+	if opts.Rows == 0 {
+		opts.Rows = DefaultGIFOptions.Rows
+	}
+	if opts.Scale == 0 {
+		opts.Scale = DefaultGIFOptions.Scale
+	}
+	return opts
+}
+
+// WriteGIF encodes frames (as LoadFrames makes them) as an animated GIF that
+// loops forever. Each frame after the first only covers what changed, which
+// keeps both the file and the memory it takes to make it small.
+//
+func WriteGIF(w io.Writer, frames []api.TimelapseProgress, opts GIFOptions) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	opts = opts.withDefaults()
+	frames = Sample(frames, opts.MaxFrames)
+	if len(frames) == 0 {
+		return errors.New("No frames to make a GIF of")
+	}
+
+	var prev api.Timelapse
+	var shown *image.Paletted
+	anim := &gif.GIF{}
+	for i, frame := range frames {
+		img := scaleUp(renderGIFFrame(frame, prev, float64(i+1)/float64(len(frames)), opts), opts.Scale)
+		delay := int(opts.Delay / (10 * time.Millisecond))
+		if delay < 2 {
+			delay = 2
+		}
+		if i == len(frames)-1 {
+			delay *= GIF_LAST_FRAME_HOLD
+		}
+		if shown == nil {
+			anim.Image = append(anim.Image, img)
+		} else {
+			anim.Image = append(anim.Image, changedPart(shown, img))
+		}
+		anim.Delay = append(anim.Delay, delay)
+		anim.Disposal = append(anim.Disposal, gif.DisposalNone)
+		shown, prev = img, frame.Partial
+	}
+	anim.Config = image.Config{ColorModel: gifPalette, Width: shown.Rect.Dx(), Height: shown.Rect.Dy()}
+	return gif.EncodeAll(w, anim)
+}
+
+// renderGIFFrame draws a frame at one pixel per pixel: the rows around the
+// first change, a bar progress of the way across, and the caption.
+//
+func renderGIFFrame(frame api.TimelapseProgress, prev api.Timelapse, progress float64, opts GIFOptions) *image.Paletted {
+	width := opts.Columns * CELL_WIDTH
+	textHeight := opts.Rows * CELL_HEIGHT
+	img := image.NewPaletted(image.Rect(0, 0, width, textHeight+GIF_PROGRESS_HEIGHT+CELL_HEIGHT), gifPalette)
+
+	rows := Rows(frame.Partial, prev, false)
+	gutter := GutterWidth(rows)
+	top := ScrollTop(rows, opts.Rows)
+	for i := 0; i < opts.Rows && top+i < len(rows); i++ {
+		row, y := rows[top+i], i*CELL_HEIGHT
+		number, marker := "", " "
+		if row.Number > 0 {
+			number = fmt.Sprint(row.Number)
+		}
+		switch row.Change {
+		case api.LINE_ADDED:
+			fillRect(img, image.Rect(0, y, width, y+CELL_HEIGHT), GIF_ADDED)
+			marker = "+"
+		case api.LINE_DELETED:
+			fillRect(img, image.Rect(0, y, width, y+CELL_HEIGHT), GIF_DELETED)
+			marker = "-"
+		}
+		drawText(img, (gutter-len(number))*CELL_WIDTH, y, Clip(number+" "+marker, opts.Columns), GIF_GUTTER)
+		if text := gutter + 3; text < opts.Columns {
+			drawText(img, text*CELL_WIDTH, y, Clip(row.Text, opts.Columns-text), GIF_INK)
+		}
+	}
+
+	y := textHeight
+	fillRect(img, image.Rect(0, y, int(float64(width)*progress), y+GIF_PROGRESS_HEIGHT), GIF_PROGRESS)
+	y += GIF_PROGRESS_HEIGHT
+	fillRect(img, image.Rect(0, y, width, y+CELL_HEIGHT), GIF_INK)
+	drawText(img, 0, y, Clip(Caption(frame.Commit), opts.Columns), GIF_PAPER)
+	return img
+}
+
+// Caption describes a commit in a line: its hash, date, author and subject.
+//
+func Caption(c api.Commit) string {
+	author := c.Author
+	if i := strings.Index(author, " <"); i >= 0 {
+		author = author[:i]
+	}
+	return fmt.Sprintf(" %s  %s  %s  %s", c.Hash.Short(), c.Date.Format("2006-01-02"), author, c.Subject())
+}
+
+func fillRect(img *image.Paletted, r image.Rectangle, index uint8) {
+	r = r.Intersect(img.Rect)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			img.Pix[img.PixOffset(x, y)] = index
+		}
+	}
+}
+
+func scaleUp(img *image.Paletted, scale int) *image.Paletted {
+	if scale <= 1 {
+		return img
+	}
+	b := img.Rect
+	big := image.NewPaletted(image.Rect(0, 0, b.Dx()*scale, b.Dy()*scale), img.Palette)
+	for y := 0; y < big.Rect.Dy(); y++ {
+		for x := 0; x < big.Rect.Dx(); x++ {
+			big.Pix[big.PixOffset(x, y)] = img.Pix[img.PixOffset(x/scale, y/scale)]
+		}
+	}
+	return big
+}
+
+// changedPart is the smallest piece of next that covers everything that
+// differs from prev, copied out on its own. A frame identical to the one
+// before still needs a pixel to hang its delay on.
+//
+func changedPart(prev, next *image.Paletted) *image.Paletted {
+	b := next.Rect
+	minX, minY, maxX, maxY := b.Max.X, b.Max.Y, b.Min.X, b.Min.Y
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if prev.Pix[prev.PixOffset(x, y)] != next.Pix[next.PixOffset(x, y)] {
+				if x < minX {
+					minX = x
+				}
+				if x >= maxX {
+					maxX = x + 1
+				}
+				if y < minY {
+					minY = y
+				}
+				maxY = y + 1
+			}
+		}
+	}
+	changed := image.Rect(minX, minY, maxX, maxY)
+	if maxX <= minX {
+		changed = image.Rect(b.Min.X, b.Min.Y, b.Min.X+1, b.Min.Y+1)
+	}
+	part := image.NewPaletted(changed, next.Palette)
+	for y := changed.Min.Y; y < changed.Max.Y; y++ {
+		copy(part.Pix[part.PixOffset(changed.Min.X, y):], next.Pix[next.PixOffset(changed.Min.X, y):next.PixOffset(changed.Max.X, y)])
+	}
+	return part
+}
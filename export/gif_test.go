@@ -0,0 +1,78 @@
+package export_test
+
+import (
+	"github.com/rbwinslow/morlock/export"
+	"github.com/rbwinslow/morlock/test_util"
+
+	"bytes"
+	"fmt"
+	"image/color"
+	"image/gif"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GIF export", func() {
+	It("should animate each commit, up to the most frames allowed", func() {
+		test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+			// Given
+			contents := ""
+			for i := 1; i <= 5; i++ {
+				contents += fmt.Sprintf("line %d\n", i)
+				tgr.MustAddFile("file.txt", contents)
+				tgr.MustCommit(fmt.Sprintf("commit %d", i))
+			}
+			frames := mustLoadFrames(tgr, "file.txt")
+			opts := export.GIFOptions{Playback: export.Playback{Delay: 250 * time.Millisecond, MaxFrames: 3}, Columns: 20, Rows: 4, Scale: 1}
+			var b bytes.Buffer
+
+			// When
+			err := export.WriteGIF(&b, frames, opts)
+
+			// Then
+			Expect(err).To(BeNil())
+			anim, err := gif.DecodeAll(&b)
+			Expect(err).To(BeNil())
+			Expect(anim.Config.Width).To(Equal(20 * export.CELL_WIDTH))
+			Expect(anim.Config.Height).To(Equal(5*export.CELL_HEIGHT + 2))
+			Expect(anim.Delay).To(Equal([]int{25, 25, 75}))
+			Expect(anim.LoopCount).To(Equal(0))
+			Expect(anim.Image[0].Bounds()).To(Equal(anim.Image[0].Rect))
+			Expect(anim.Image[1].Bounds().Dx()).To(BeNumerically("<=", 20*export.CELL_WIDTH))
+
+			// The last frame's fourth row, the line that commit added, is
+			// highlighted; the first frame's second row, past the end of the
+			// file, isn't.
+			last := anim.Image[2]
+			added := last.At(last.Rect.Max.X-1, 3*export.CELL_HEIGHT+1)
+			Expect(colorOf(added)).To(Equal(colorOf(color.RGBA{0xd2, 0xf8, 0xd9, 0xff})))
+			first := anim.Image[0]
+			Expect(colorOf(first.At(first.Rect.Max.X-1, export.CELL_HEIGHT+1))).To(Equal(colorOf(color.White)))
+		})
+	})
+
+	It("should refuse options past the limits", func() {
+		var b bytes.Buffer
+		for _, opts := range []export.GIFOptions{
+			{Playback: export.Playback{MaxFrames: export.GIF_MAX_FRAMES + 1}},
+			{Columns: -1},
+			{Scale: export.GIF_MAX_SCALE + 1},
+			{Playback: export.Playback{Delay: 2 * time.Minute}},
+			{Playback: export.Playback{MaxFrames: export.GIF_MAX_FRAMES}, Columns: export.GIF_MAX_COLUMNS, Rows: export.GIF_MAX_ROWS, Scale: export.GIF_MAX_SCALE},
+			{Playback: export.Playback{MaxFrames: 200}, Columns: 200, Scale: 3},
+		} {
+			Expect(opts.Validate()).NotTo(BeNil())
+			Expect(export.WriteGIF(&b, nil, opts)).NotTo(BeNil())
+		}
+		Expect(b.Len()).To(Equal(0))
+		Expect(export.DefaultGIFOptions.Validate()).To(BeNil())
+		Expect((&export.GIFOptions{Playback: export.Playback{MaxFrames: export.GIF_MAX_FRAMES}, Scale: 1}).Validate()).To(BeNil())
+	})
+})
+
+func colorOf(c color.Color) [4]uint32 {
+	r, g, b, a := c.RGBA()
+	return [4]uint32{r, g, b, a}
+}
@@ -0,0 +1,250 @@
+package export
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/rbwinslow/morlock/api"
+)
+
+// HTMLOptions shape an HTML report, whose player needs nothing more than
+// the Playback.
+//
+type HTMLOptions struct {
+	Playback
+}
+
+var DefaultHTMLOptions = HTMLOptions{
+	Playback: Playback{Delay: 500 * time.Millisecond, MaxFrames: 1000},
+}
+
+func (opts *HTMLOptions) Validate() error {
+	return opts.Playback.validate(PLAYBACK_MAX_FRAMES)
+}
+
+func (opts HTMLOptions) withDefaults() HTMLOptions {
+	opts.Playback = opts.Playback.withDefaults(DefaultHTMLOptions.Playback)
+	return opts
+}
+
+// htmlFrameForJSON is a commit and the file as it left it. Each row is an
+// index into the report's Lines and the row's api.LineChange; the player
+// numbers the rows itself.
+//
+type htmlFrameForJSON struct {
+	Hash         string   `json:"hash"`
+	Author       string   `json:"author"`
+	Date         string   `json:"date"`
+	Desc         string   `json:"desc"`
+	LinesAdded   int      `json:"linesAdded"`
+	LinesRemoved int      `json:"linesRemoved"`
+	Rows         [][2]int `json:"rows"`
+}
+
+// htmlReportForJSON is everything the player needs. Most lines stay the same
+// from one frame to the next, so each distinct line is only stored once, in
+// Lines, and the frames refer to it.
+//
+type htmlReportForJSON struct {
+	Path   string             `json:"path"`
+	Delay  int64              `json:"delay"`
+	Lines  []string           `json:"lines"`
+	Frames []htmlFrameForJSON `json:"frames"`
+}
+
+type htmlPage struct {
+	Title  string
+	Last   api.Commit
+	Report htmlReportForJSON
+}
+
+// WriteHTML writes frames (as LoadFrames makes them) as a single HTML page
+// that plays p's history back: the frames, what each commit was, and the
+// script to play them, all inline, so that it works with nothing else
+// around.
+//
+func WriteHTML(w io.Writer, p string, frames []api.TimelapseProgress, opts HTMLOptions) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	opts = opts.withDefaults()
+	frames = Sample(frames, opts.MaxFrames)
+	if len(frames) == 0 {
+		return errors.New("No frames to make a report of")
+	}
+
+	report := htmlReportForJSON{
+		Path:   p,
+		Delay:  int64(opts.Delay / time.Millisecond),
+		Lines:  []string{},
+		Frames: make([]htmlFrameForJSON, 0, len(frames)),
+	}
+	lineIndexes := map[string]int{}
+	var prev api.Timelapse
+	for _, frame := range frames {
+		c := frame.Commit
+		facade := htmlFrameForJSON{
+			Hash:         c.Hash.String(),
+			Author:       c.Author,
+			Date:         c.Date.Format("2006-01-02 15:04:05 -0700"),
+			Desc:         strings.TrimSpace(c.Desc),
+			LinesAdded:   c.LinesAdded,
+			LinesRemoved: c.LinesRemoved,
+			Rows:         [][2]int{},
+		}
+		for _, row := range Rows(frame.Partial, prev, false) {
+			index, ok := lineIndexes[row.Text]
+			if !ok {
+				index = len(report.Lines)
+				lineIndexes[row.Text] = index
+				report.Lines = append(report.Lines, row.Text)
+			}
+			facade.Rows = append(facade.Rows, [2]int{index, int(row.Change)})
+		}
+		report.Frames = append(report.Frames, facade)
+		prev = frame.Partial
+	}
+
+	page := htmlPage{
+		Title:  fmt.Sprintf("%s: timelapse", p),
+		Last:   frames[len(frames)-1].Commit,
+		Report: report,
+	}
+	return htmlReportTemplate.Execute(w, page)
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="UTF-8">
+<title>{{.Title}}</title>
+<style>
+body { margin: 0; font-family: sans-serif; color: #24292f; }
+header { position: sticky; top: 0; background: #f6f8fa; border-bottom: 1px solid #d0d7de; padding: 8px 12px; }
+h1 { font-size: 16px; margin: 0 0 6px; }
+#controls { display: flex; align-items: center; gap: 6px; }
+#scrub { flex: 1; }
+#commit { font-size: 13px; margin-top: 6px; white-space: pre-wrap; }
+#commit .hash { font-family: monospace; }
+#screen { margin: 0; font: 13px/1.4 monospace; tab-size: 8; }
+#screen div { white-space: pre; padding-right: 12px; }
+#screen .number { display: inline-block; min-width: 4em; padding: 0 8px; text-align: right; color: #8c959f; user-select: none; }
+#screen .added { background: #d2f8d9; }
+#screen .deleted { background: #ffd7d5; text-decoration: line-through; }
+</style>
+</head>
+<body>
+<header>
+<h1>{{.Report.Path}}</h1>
+<div id="controls">
+<button id="play" title="Play or pause (space)">Play</button>
+<button id="prev" title="Previous commit (left)">&lt;</button>
+<button id="next" title="Next commit (right)">&gt;</button>
+<input id="scrub" type="range" min="0" value="0">
+<span id="position"></span>
+</div>
+<div id="commit"><span class="hash">{{.Last.Hash.Short}}</span> {{.Last.Date.Format "2006-01-02"}} {{.Last.Author}}</div>
+</header>
+<noscript><p>The timelapse needs JavaScript to play.</p></noscript>
+<pre id="screen"></pre>
+<script>
+(function () {
+    var report = {{.Report}};
+    var current = report.frames.length - 1, timer = null;
+    var $ = function (id) { return document.getElementById(id); };
+    var scrub = $("scrub"), play = $("play");
+    scrub.max = report.frames.length - 1;
+
+    function row(number, text, change) {
+        var div = document.createElement("div"), gutter = document.createElement("span");
+        gutter.className = "number";
+        gutter.textContent = number > 0 ? number : "";
+        div.appendChild(gutter);
+        div.appendChild(document.createTextNode(text));
+        div.className = ["", "added", "deleted"][change];
+        return div;
+    }
+
+    function show(i) {
+        current = Math.max(0, Math.min(i, report.frames.length - 1));
+        var frame = report.frames[current], screen = $("screen"), number = 0, first = null;
+        screen.textContent = "";
+        frame.rows.forEach(function (r) {
+            var div = row(r[1] == 2 ? 0 : ++number, report.lines[r[0]], r[1]);
+            if (r[1] != 0 && !first) {
+                first = div;
+            }
+            screen.appendChild(div);
+        });
+        var commit = $("commit"), hash = document.createElement("span");
+        hash.className = "hash";
+        hash.textContent = frame.hash.slice(0, 7);
+        commit.textContent = "";
+        commit.appendChild(hash);
+        commit.appendChild(document.createTextNode(" " + frame.date + "  " + frame.author +
+            "  +" + frame.linesAdded + " -" + frame.linesRemoved + "\n" + frame.desc));
+        scrub.value = current;
+        $("position").textContent = (current + 1) + "/" + report.frames.length;
+        if (first) {
+            first.scrollIntoView({block: "center"});
+        }
+    }
+
+    function pause() {
+        clearInterval(timer);
+        timer = null;
+        play.textContent = "Play";
+    }
+
+    function toggle() {
+        if (timer) {
+            pause();
+            return;
+        }
+        if (current == report.frames.length - 1) {
+            show(0);
+        }
+        play.textContent = "Pause";
+        timer = setInterval(function () {
+            show(current + 1);
+            if (current == report.frames.length - 1) {
+                pause();
+            }
+        }, report.delay);
+    }
+
+    play.onclick = toggle;
+    $("prev").onclick = function () { pause(); show(current - 1); };
+    $("next").onclick = function () { pause(); show(current + 1); };
+    scrub.oninput = function () { pause(); show(+scrub.value); };
+    document.onkeydown = function (e) {
+        var moves = {ArrowLeft: -1, ArrowRight: 1, "[": -10, "]": 10};
+        if (e.target == scrub && e.key in moves) {
+            return;
+        }
+        if (e.key == " ") {
+            toggle();
+        } else if (e.key in moves) {
+            pause();
+            show(current + moves[e.key]);
+        } else if (e.key == "Home") {
+            pause();
+            show(0);
+        } else if (e.key == "End") {
+            pause();
+            show(report.frames.length - 1);
+        } else {
+            return;
+        }
+        e.preventDefault();
+    };
+    show(current);
+})();
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,81 @@
+package export_test
+
+import (
+	"github.com/rbwinslow/morlock/export"
+	"github.com/rbwinslow/morlock/test_util"
+
+	"bytes"
+	"encoding/json"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type htmlReport struct {
+	Path   string
+	Delay  int
+	Lines  []string
+	Frames []struct {
+		Hash   string
+		Author string
+		Desc   string
+		Rows   [][2]int
+	}
+}
+
+func mustParseHTMLReport(page string) (report htmlReport) {
+	start := strings.Index(page, "var report = ")
+	Expect(start).To(BeNumerically(">=", 0))
+	page = page[start+len("var report = "):]
+	Expect(json.Unmarshal([]byte(page[:strings.Index(page, ";\n")]), &report)).To(Succeed())
+	return
+}
+
+var _ = Describe("HTML export", func() {
+	It("should put every frame and commit in the page, sharing the lines they have in common", func() {
+		test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+			// Given
+			tgr.MustAddFile("file.txt", "a\nb\n")
+			first := tgr.MustCommit("first")
+			tgr.MustAddFile("file.txt", "a\n</script><b>c</b>\n")
+			second := tgr.MustCommit("second")
+			frames := mustLoadFrames(tgr, "file.txt")
+			var b bytes.Buffer
+
+			// When
+			err := export.WriteHTML(&b, "file.txt", frames, export.HTMLOptions{Playback: export.Playback{Delay: 250 * time.Millisecond}})
+
+			// Then
+			Expect(err).To(BeNil())
+			page := b.String()
+			Expect(page).To(HavePrefix("<!DOCTYPE html>"))
+			Expect(page).NotTo(ContainSubstring("src="))
+			Expect(strings.Count(page, "</script>")).To(Equal(1))
+
+			report := mustParseHTMLReport(page)
+			Expect(report.Path).To(Equal("file.txt"))
+			Expect(report.Delay).To(Equal(250))
+			Expect(report.Lines).To(Equal([]string{"a", "b", "</script><b>c</b>"}))
+			Expect(report.Frames).To(HaveLen(2))
+			Expect(report.Frames[0].Hash).To(HavePrefix(first.String()))
+			Expect(report.Frames[0].Desc).To(Equal("first"))
+			Expect(report.Frames[0].Rows).To(Equal([][2]int{{0, 1}, {1, 1}}))
+			Expect(report.Frames[1].Hash).To(HavePrefix(second.String()))
+			Expect(report.Frames[1].Rows).To(Equal([][2]int{{0, 0}, {1, 2}, {2, 1}}))
+		})
+	})
+
+	It("should refuse options past the limits", func() {
+		var b bytes.Buffer
+		for _, opts := range []export.HTMLOptions{
+			{Playback: export.Playback{MaxFrames: export.PLAYBACK_MAX_FRAMES + 1}},
+			{Playback: export.Playback{Delay: -time.Second}},
+		} {
+			Expect(opts.Validate()).NotTo(BeNil())
+			Expect(export.WriteHTML(&b, "file.txt", nil, opts)).NotTo(BeNil())
+		}
+		Expect(b.Len()).To(Equal(0))
+	})
+})
@@ -0,0 +1,386 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rbwinslow/morlock/api"
+)
+
+const (
+	// SITE_VERSION changes whenever what WriteSite writes for a file does,
+	// so that the files an older version wrote get written over.
+	SITE_VERSION = 1
+
+	SITE_MANIFEST = "manifest.json"
+	SITE_FILES    = "files"
+
+	SITE_PAGE      = "index.html"
+	SITE_HISTORY   = "history.json"
+	SITE_TIMELAPSE = "timelapse.json"
+)
+
+// SiteOptions shape a static site. Paths are the files and directories
+// (relative to the repository) to cover, or all of it when there are none.
+// Each file's page is an HTML report, as HTML describes. Unless Rebuild is
+// set, files whose history hasn't changed since the site was last written
+// are left alone. Progress, if any, hears about each file as it's done.
+//
+type SiteOptions struct {
+	Paths       []string
+	HTML        HTMLOptions
+	Concurrency int
+	Rebuild     bool
+	Progress    func(p string, built bool)
+}
+
+// SiteSummary counts what WriteSite did with the files: how many it wrote,
+// how many it left as they were, and how many it took out because they're
+// gone from the repository.
+//
+type SiteSummary struct {
+	Built, Kept, Removed int
+}
+
+// siteFileForJSON is what the manifest says about a file: the newest commit
+// that touched it, which is what decides whether it needs writing again,
+// and enough about that commit to list it. Page and Timelapse are empty for
+// binary files, which only get a history.
+//
+type siteFileForJSON struct {
+	Path        string    `json:"path"`
+	Anchor      string    `json:"anchor"`
+	Commits     int       `json:"commits"`
+	Binary      bool      `json:"binary,omitempty"`
+	LastDate    time.Time `json:"lastDate"`
+	LastAuthor  string    `json:"lastAuthor"`
+	LastSubject string    `json:"lastSubject"`
+	Page        string    `json:"page,omitempty"`
+	History     string    `json:"history"`
+	Timelapse   string    `json:"timelapse,omitempty"`
+}
+
+type siteManifestForJSON struct {
+	Version   int               `json:"version"`
+	Commit    string            `json:"commit"`
+	Delay     int64             `json:"delay"`
+	MaxFrames int               `json:"maxFrames"`
+	Files     []siteFileForJSON `json:"files"`
+}
+
+// WriteSite writes a static site into dir that browses repo's files as of
+// HEAD with no server: an index of the files, and for each one, under
+// files/<path>/, an HTML report of its timelapse, and its history and
+// timelapse as JSON, the same as the server's /api/history and
+// /api/timelapse send. manifest.json lists all of it. The pages don't read
+// the JSON; it's for other tools.
+//
+func WriteSite(ctx context.Context, repo *api.LocalGitRepo, dir string, opts SiteOptions) (SiteSummary, error) {
+	var summary SiteSummary
+	if err := opts.HTML.Validate(); err != nil {
+		return summary, err
+	}
+	opts.HTML = opts.HTML.withDefaults()
+	head, err := repo.ResolveRevision("HEAD")
+	if err != nil {
+		return summary, err
+	}
+	paths, err := siteFiles(repo, opts.Paths)
+	if err != nil {
+		return summary, err
+	}
+
+	old := readSiteManifest(dir)
+	reusable := !opts.Rebuild && old.Version == SITE_VERSION &&
+		old.Delay == int64(opts.HTML.Delay/time.Millisecond) && old.MaxFrames == opts.HTML.MaxFrames
+	previous := map[string]siteFileForJSON{}
+	for _, file := range old.Files {
+		previous[file.Path] = file
+	}
+
+	wanted := map[string]bool{}
+	for _, p := range paths {
+		wanted[p] = true
+	}
+	for _, file := range old.Files {
+		if !wanted[file.Path] {
+			if err := removeSiteFile(dir, file); err != nil {
+				return summary, err
+			}
+			summary.Removed++
+		}
+	}
+
+	manifest := siteManifestForJSON{
+		Version:   SITE_VERSION,
+		Commit:    head.String(),
+		Delay:     int64(opts.HTML.Delay / time.Millisecond),
+		MaxFrames: opts.HTML.MaxFrames,
+		Files:     []siteFileForJSON{},
+	}
+	for _, p := range paths {
+		if err := ctx.Err(); err != nil {
+			return summary, err
+		}
+		anchor, found, err := repo.TimelapseAnchor(p)
+		if err != nil {
+			return summary, err
+		}
+		if !found {
+			continue
+		}
+		if file, ok := previous[p]; ok && reusable && file.Anchor == anchor.String() && siteFileExists(dir, file) {
+			manifest.Files = append(manifest.Files, file)
+			summary.Kept++
+			if opts.Progress != nil {
+				opts.Progress(p, false)
+			}
+			continue
+		}
+		if file, ok := previous[p]; ok {
+			if err := removeSiteFile(dir, file); err != nil {
+				return summary, err
+			}
+		}
+		file, err := writeSiteFile(ctx, repo, dir, p, opts)
+		if err != nil {
+			return summary, err
+		}
+		manifest.Files = append(manifest.Files, file)
+		summary.Built++
+		if opts.Progress != nil {
+			opts.Progress(p, true)
+		}
+	}
+
+	js, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return summary, err
+	}
+	if err := writeSiteBytes(dir, SITE_MANIFEST, append(js, '\n')); err != nil {
+		return summary, err
+	}
+	var index bytes.Buffer
+	err = siteIndexTemplate.Execute(&index, siteIndex{Title: filepath.Base(repo.Path), Manifest: manifest})
+	if err != nil {
+		return summary, err
+	}
+	return summary, writeSiteBytes(dir, SITE_PAGE, index.Bytes())
+}
+
+// siteFiles lists the files under paths in HEAD, each once, in order. A
+// path with no files under it is ErrPathNotFound.
+//
+func siteFiles(repo *api.LocalGitRepo, paths []string) ([]string, error) {
+	if len(paths) == 0 {
+		paths = []string{""}
+	}
+	seen := map[string]bool{}
+	var files []string
+	for _, p := range paths {
+		tracked, err := repo.TrackedFiles(p)
+		if err != nil {
+			return nil, err
+		}
+		if len(tracked) == 0 {
+			return nil, fmt.Errorf("%w at HEAD: \"%s\"", api.ErrPathNotFound, p)
+		}
+		for _, file := range tracked {
+			if !seen[file] {
+				seen[file] = true
+				files = append(files, file)
+			}
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// writeSiteFile writes everything the site has for p.
+//
+func writeSiteFile(ctx context.Context, repo *api.LocalGitRepo, dir, p string, opts SiteOptions) (siteFileForJSON, error) {
+	file := siteFileForJSON{Path: p, History: sitePath(p, SITE_HISTORY)}
+	walk, err := repo.WalkHistory(ctx, p, api.HistoryOptions{})
+	if err != nil {
+		return file, err
+	}
+	var history api.CommitList
+	for c := range walk.Commits {
+		history = append(history, c)
+	}
+	if err := walk.Err(); err != nil {
+		return file, err
+	}
+	if len(history) == 0 {
+		return file, api.ErrPathNotFound
+	}
+	last := history[0]
+	file.Anchor = last.Hash.String()
+	file.Commits = len(history)
+	file.Binary = last.Binary
+	file.LastDate = last.Date
+	file.LastAuthor = last.Author
+	file.LastSubject = strings.SplitN(strings.TrimSpace(last.Desc), "\n", 2)[0]
+
+	js, err := history.ToJSON()
+	if err != nil {
+		return file, err
+	}
+	if err := writeSiteBytes(dir, file.History, append(js, '\n')); err != nil {
+		return file, err
+	}
+	if file.Binary {
+		return file, nil
+	}
+
+	frames, err := LoadFrames(ctx, repo, p, api.TimelapseOptions{Concurrency: opts.Concurrency})
+	if err != nil {
+		return file, err
+	}
+	file.Timelapse = sitePath(p, SITE_TIMELAPSE)
+	if js, err = frames[len(frames)-1].Partial.ToJSON(); err != nil {
+		return file, err
+	}
+	if err := writeSiteBytes(dir, file.Timelapse, append(js, '\n')); err != nil {
+		return file, err
+	}
+	file.Page = sitePath(p, SITE_PAGE)
+	var page bytes.Buffer
+	if err := WriteHTML(&page, p, frames, opts.HTML); err != nil {
+		return file, err
+	}
+	return file, writeSiteBytes(dir, file.Page, page.Bytes())
+}
+
+// sitePath is where, relative to the site, something the site has for p
+// goes. Every file gets a directory of its own, which can't collide with
+// another's, since a path can't be both a file and a directory at once.
+//
+func sitePath(p, name string) string {
+	return path.Join(SITE_FILES, p, name)
+}
+
+func siteFileExists(dir string, file siteFileForJSON) bool {
+	for _, rel := range []string{file.History, file.Timelapse, file.Page} {
+		if len(rel) == 0 {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(rel))); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// removeSiteFile takes out what the site had for a file, and then any
+// directories that leaves empty.
+//
+func removeSiteFile(dir string, file siteFileForJSON) error {
+	for _, rel := range []string{file.History, file.Timelapse, file.Page} {
+		if len(rel) == 0 {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, filepath.FromSlash(rel))); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	for p := sitePath(file.Path, ""); p != SITE_FILES && p != "."; p = path.Dir(p) {
+		if os.Remove(filepath.Join(dir, filepath.FromSlash(p))) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// readSiteManifest reads the manifest a site was last written with. A site
+// that hasn't been written yet, or whose manifest can't be made sense of,
+// gets an empty one, so that everything is written from scratch.
+//
+func readSiteManifest(dir string) siteManifestForJSON {
+	var manifest siteManifestForJSON
+	js, err := ioutil.ReadFile(filepath.Join(dir, SITE_MANIFEST))
+	if err != nil || json.Unmarshal(js, &manifest) != nil {
+		return siteManifestForJSON{}
+	}
+	return manifest
+}
+
+func writeSiteBytes(dir, rel string, data []byte) error {
+	p := filepath.Join(dir, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(p, data, 0644)
+}
+
+type siteIndex struct {
+	Title    string
+	Manifest siteManifestForJSON
+}
+
+var siteIndexTemplate = template.Must(template.New("site").Funcs(template.FuncMap{
+	"link": func(rel string) string {
+		parts := strings.Split(rel, "/")
+		for i, part := range parts {
+			parts[i] = url.PathEscape(part)
+		}
+		return strings.Join(parts, "/")
+	},
+	"date": func(t time.Time) string {
+		return t.Format("2006-01-02")
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="UTF-8">
+<title>{{.Title}}</title>
+<style>
+body { margin: 0; padding: 8px 12px; font-family: sans-serif; color: #24292f; }
+h1 { font-size: 18px; }
+#filter { width: 100%; max-width: 40em; margin-bottom: 8px; }
+table { border-collapse: collapse; font-size: 13px; }
+th, td { text-align: left; padding: 2px 12px 2px 0; }
+td.path { font-family: monospace; }
+td.commits { text-align: right; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{len .Manifest.Files}} files as of {{slice .Manifest.Commit 0 7}}</p>
+<input id="filter" type="search" placeholder="Filter by path">
+<table>
+<thead><tr><th>Path</th><th>Commits</th><th>Last changed</th><th>By</th><th>In</th></tr></thead>
+<tbody id="files">
+{{range .Manifest.Files -}}
+<tr data-path="{{.Path}}">
+<td class="path">{{if .Page}}<a href="{{link .Page}}">{{.Path}}</a>{{else}}{{.Path}} (<a href="{{link .History}}">binary</a>){{end}}</td>
+<td class="commits"><a href="{{link .History}}">{{.Commits}}</a></td>
+<td>{{date .LastDate}}</td>
+<td>{{.LastAuthor}}</td>
+<td>{{.LastSubject}}</td>
+</tr>
+{{end -}}
+</tbody>
+</table>
+<script>
+document.getElementById("filter").oninput = function () {
+    var filter = this.value.toLowerCase();
+    Array.prototype.forEach.call(document.getElementById("files").rows, function (row) {
+        row.hidden = row.getAttribute("data-path").toLowerCase().indexOf(filter) < 0;
+    });
+};
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,143 @@
+package export_test
+
+import (
+	"github.com/rbwinslow/morlock/api"
+	"github.com/rbwinslow/morlock/export"
+	"github.com/rbwinslow/morlock/test_util"
+
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("static site", func() {
+	var siteDir string
+
+	BeforeEach(func() {
+		var err error
+		siteDir, err = ioutil.TempDir("", "morlock-site")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(siteDir)
+	})
+
+	var mustWriteSite = func(tgr *test_util.TemporaryGitRepo, opts export.SiteOptions) export.SiteSummary {
+		repo, err := api.OpenLocalGitRepo(tgr.Path, nil)
+		Expect(err).To(BeNil())
+		summary, err := export.WriteSite(context.Background(), repo, siteDir, opts)
+		Expect(err).To(BeNil())
+		return summary
+	}
+
+	var exists = func(rel string) bool {
+		_, err := os.Stat(path.Join(siteDir, rel))
+		return err == nil
+	}
+
+	It("should write a page, a history and a timelapse for every file, and an index of them", func() {
+		test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+			// Given
+			Expect(os.Mkdir(path.Join(tgr.Path, "dir"), 0755)).To(Succeed())
+			tgr.MustAddFile("a.txt", "a\n")
+			tgr.MustAddFile("dir/b.txt", "b\n")
+			tgr.MustCommit("first")
+			tgr.MustAddFile("a.txt", "a\nA\n")
+			tgr.MustCommit("second")
+
+			// When
+			summary := mustWriteSite(tgr, export.SiteOptions{})
+
+			// Then
+			Expect(summary).To(Equal(export.SiteSummary{Built: 2}))
+			for _, rel := range []string{"index.html", "files/a.txt/index.html", "files/dir/b.txt/timelapse.json"} {
+				Expect(exists(rel)).To(BeTrue(), rel)
+			}
+			index, err := ioutil.ReadFile(path.Join(siteDir, "index.html"))
+			Expect(err).To(BeNil())
+			Expect(string(index)).To(ContainSubstring(`href="files/dir/b.txt/index.html"`))
+
+			js, err := ioutil.ReadFile(path.Join(siteDir, "files/a.txt/history.json"))
+			Expect(err).To(BeNil())
+			var history []struct{ Desc string }
+			Expect(json.Unmarshal(js, &history)).To(Succeed())
+			Expect(history).To(HaveLen(2))
+			Expect(history[0].Desc).To(ContainSubstring("second"))
+
+			js, err = ioutil.ReadFile(path.Join(siteDir, "manifest.json"))
+			Expect(err).To(BeNil())
+			var manifest struct {
+				Files []struct {
+					Path    string
+					Commits int
+				}
+			}
+			Expect(json.Unmarshal(js, &manifest)).To(Succeed())
+			Expect(manifest.Files).To(HaveLen(2))
+			Expect(manifest.Files[0].Path).To(Equal("a.txt"))
+			Expect(manifest.Files[0].Commits).To(Equal(2))
+		})
+	})
+
+	It("should only write again the files whose history changed, and take out the ones that are gone", func() {
+		test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+			// Given
+			Expect(os.Mkdir(path.Join(tgr.Path, "dir"), 0755)).To(Succeed())
+			tgr.MustAddFile("a.txt", "a\n")
+			tgr.MustAddFile("c.txt", "c\n")
+			tgr.MustAddFile("dir/b.txt", "b\n")
+			tgr.MustCommit("first")
+			mustWriteSite(tgr, export.SiteOptions{})
+			tgr.MustAddFile("a.txt", "a\nA\n")
+			tgr.MustRun("rm", "-q", "dir/b.txt")
+			tgr.MustCommit("second")
+
+			// When
+			var built []string
+			summary := mustWriteSite(tgr, export.SiteOptions{Progress: func(p string, b bool) {
+				if b {
+					built = append(built, p)
+				}
+			}})
+			rebuilt := mustWriteSite(tgr, export.SiteOptions{Rebuild: true})
+			changedOptions := mustWriteSite(tgr, export.SiteOptions{HTML: export.HTMLOptions{Playback: export.Playback{MaxFrames: 1}}})
+
+			// Then
+			Expect(summary).To(Equal(export.SiteSummary{Built: 1, Kept: 1, Removed: 1}))
+			Expect(built).To(Equal([]string{"a.txt"}))
+			Expect(exists("files/dir")).To(BeFalse())
+			Expect(exists("files/c.txt/index.html")).To(BeTrue())
+			Expect(rebuilt).To(Equal(export.SiteSummary{Built: 2}))
+			Expect(changedOptions).To(Equal(export.SiteSummary{Built: 2}))
+		})
+	})
+
+	It("should only cover the paths it's given, and refuse ones with no files", func() {
+		test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+			// Given
+			Expect(os.Mkdir(path.Join(tgr.Path, "dir"), 0755)).To(Succeed())
+			tgr.MustAddFile("a.txt", "a\n")
+			tgr.MustAddFile("dir/b.txt", "b\n")
+			tgr.MustCommit("first")
+			repo, err := api.OpenLocalGitRepo(tgr.Path, nil)
+			Expect(err).To(BeNil())
+
+			// When
+			summary := mustWriteSite(tgr, export.SiteOptions{Paths: []string{"dir"}})
+			_, missingErr := export.WriteSite(context.Background(), repo, siteDir, export.SiteOptions{Paths: []string{"nowhere"}})
+
+			// Then
+			Expect(summary).To(Equal(export.SiteSummary{Built: 1}))
+			Expect(exists("files/dir/b.txt/index.html")).To(BeTrue())
+			Expect(exists("files/a.txt")).To(BeFalse())
+			Expect(errors.Is(missingErr, api.ErrPathNotFound)).To(BeTrue())
+		})
+	})
+})
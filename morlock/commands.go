@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rbwinslow/morlock/api"
+)
+
+const (
+	FORMAT_TEXT   = "text"
+	FORMAT_JSON   = "json"
+	FORMAT_NDJSON = "ndjson"
+)
+
+func formatFlag(flags *flag.FlagSet) *string {
+	return flags.String("format", FORMAT_TEXT, "output format: text, json or ndjson")
+}
+
+func checkFormat(format string) error {
+	switch format {
+	case FORMAT_TEXT, FORMAT_JSON, FORMAT_NDJSON:
+		return nil
+	}
+	return usagef("Unknown format \"%s\" (expected text, json or ndjson)", format)
+}
+
+// openFile finds the repository that the file at arg (relative to the working
+// directory) is in, and the file's path relative to the repository. The file
+// needn't exist any more.
+//
+func openFile(arg string) (*api.LocalGitRepo, string, error) {
+	abs, err := filepath.Abs(arg)
+	if err != nil {
+		return nil, "", err
+	}
+	dir := abs
+	for ; dir != "/"; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		}
+	}
+	repo, err := api.OpenLocalGitRepo(dir, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	subPath, err := filepath.Rel(repo.Path, abs)
+	if err != nil {
+		return nil, "", err
+	}
+	return repo, filepath.ToSlash(subPath), nil
+}
+
+// openTrackedFile is openFile for a file that has to have a history. One
+// without fails the way it does in the server: api.ErrNotTracked when it's on
+// disk, and api.ErrPathNotFound when it isn't.
+//
+func openTrackedFile(arg string) (*api.LocalGitRepo, string, error) {
+	repo, subPath, err := openFile(arg)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := repo.CheckTracked(subPath); err != nil {
+		return nil, "", err
+	}
+	return repo, subPath, nil
+}
+
+func historyCommand(flags *flag.FlagSet, args []string, stdout io.Writer) error {
+	format := formatFlag(flags)
+	since := flags.String("since", "", "only commits on or after this date (YYYY-MM-DD or RFC 3339)")
+	until := flags.String("until", "", "only commits on or before this date (YYYY-MM-DD or RFC 3339)")
+	author := flags.String("author", "", "only commits whose author matches this regular expression")
+	message := flags.String("message", "", "only commits whose message matches this regular expression")
+	limit := flags.Int("limit", 0, "most commits to show (0 for all)")
+	rev := flags.String("rev", "", "revision to start from (default HEAD)")
+	arg, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if err := checkFormat(*format); err != nil {
+		return err
+	}
+
+	opts := api.HistoryOptions{Start: *rev, Author: *author, Message: *message, Limit: *limit}
+	if opts.Since, err = parseDate(*since); err != nil {
+		return err
+	}
+	if opts.Until, err = parseDate(*until); err != nil {
+		return err
+	}
+	repo, subPath, err := openTrackedFile(arg)
+	if err != nil {
+		return err
+	}
+	if len(opts.Start) > 0 {
+		if _, err := repo.ResolveRevision(opts.Start); err != nil {
+			return err
+		}
+	}
+	walk, err := repo.WalkHistory(context.Background(), subPath, opts)
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case FORMAT_NDJSON:
+		if err := walk.WriteNDJSON(stdout, nil); err != nil {
+			return err
+		}
+		return walk.Err()
+	case FORMAT_JSON:
+		commits := api.CommitList{}
+		for c := range walk.Commits {
+			commits = append(commits, c)
+		}
+		if err := walk.Err(); err != nil {
+			return err
+		}
+		return writeJSON(stdout, commits.ToJSON)
+	}
+	for c := range walk.Commits {
+		fmt.Fprintf(stdout, "%s %s %-20.20s %5s %5s  %s\n", c.Hash.Short(), c.Date.Format("2006-01-02"), authorName(c.Author),
+			fmt.Sprintf("+%d", c.LinesAdded), fmt.Sprintf("-%d", c.LinesRemoved), c.Subject())
+	}
+	return walk.Err()
+}
+
+func timelapseCommand(flags *flag.FlagSet, args []string, stdout io.Writer) error {
+	format := formatFlag(flags)
+	concurrency := flags.Int("concurrency", 0, "diffs to fetch from git at once (0 for one at a time)")
+	arg, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if err := checkFormat(*format); err != nil {
+		return err
+	}
+
+	repo, subPath, err := openTrackedFile(arg)
+	if err != nil {
+		return err
+	}
+	tl, err := repo.BuildTimelapse(context.Background(), subPath, api.TimelapseOptions{Concurrency: *concurrency})
+	if err != nil {
+		return err
+	}
+	return writeTimelapse(stdout, *format, tl, tl.ToJSON)
+}
+
+func frameCommand(flags *flag.FlagSet, args []string, stdout io.Writer) error {
+	format := formatFlag(flags)
+	rev := flags.String("rev", "HEAD", "revision whose frame to show")
+	concurrency := flags.Int("concurrency", 0, "diffs to fetch from git at once (0 for one at a time)")
+	arg, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if err := checkFormat(*format); err != nil {
+		return err
+	}
+
+	repo, subPath, err := openFile(arg)
+	if err != nil {
+		return err
+	}
+	frame, err := repo.TimelapseFrame(context.Background(), subPath, *rev, api.TimelapseOptions{Concurrency: *concurrency})
+	if err != nil {
+		return err
+	}
+	return writeTimelapse(stdout, *format, frame.Timelapse, frame.ToJSON)
+}
+
+func blameCommand(flags *flag.FlagSet, args []string, stdout io.Writer) error {
+	format := formatFlag(flags)
+	rev := flags.String("rev", "HEAD", "revision of the file to blame")
+	arg, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if err := checkFormat(*format); err != nil {
+		return err
+	}
+
+	repo, subPath, err := openFile(arg)
+	if err != nil {
+		return err
+	}
+	blame, err := repo.Blame(*rev, subPath)
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case FORMAT_JSON:
+		return writeJSON(stdout, blame.ToJSON)
+	case FORMAT_NDJSON:
+		return writeNDJSON(stdout, blame.ToJSON)
+	}
+	for _, line := range blame {
+		fmt.Fprintf(stdout, "%s (%-20.20s %s %4d) %s\n",
+			line.Commit.Hash.Short(), authorName(line.Commit.Author), line.Commit.Date.Format("2006-01-02"), line.Number, line.Content)
+	}
+	return nil
+}
+
+// writeTimelapse shows a timelapse: as text, each line that's in the file
+// indented by two spaces and each line that was taken out after "- "; as
+// JSON, however toJSON has it; and as NDJSON, a record per hunk.
+//
+func writeTimelapse(w io.Writer, format string, tl api.Timelapse, toJSON func() ([]byte, error)) error {
+	switch format {
+	case FORMAT_JSON:
+		return writeJSON(w, toJSON)
+	case FORMAT_NDJSON:
+		return writeNDJSON(w, tl.ToJSON)
+	}
+	for _, hunk := range tl {
+		prefix := "  "
+		if hunk.Disposition == api.DELETED {
+			prefix = "- "
+		}
+		for _, line := range hunk.Lines {
+			fmt.Fprintf(w, "%s%s\n", prefix, line)
+		}
+	}
+	return nil
+}
+
+func writeJSON(w io.Writer, toJSON func() ([]byte, error)) error {
+	js, err := toJSON()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(js))
+	return err
+}
+
+type ndjsonEndForJSON struct {
+	Done  bool `json:"done"`
+	Count int  `json:"count"`
+}
+
+// writeNDJSON writes each element of the JSON array toJSON makes on a line of
+// its own, and then the record that ends the stream.
+//
+func writeNDJSON(w io.Writer, toJSON func() ([]byte, error)) error {
+	js, err := toJSON()
+	if err != nil {
+		return err
+	}
+	var records []json.RawMessage
+	if err := json.Unmarshal(js, &records); err != nil {
+		return err
+	}
+	for _, record := range records {
+		if _, err := fmt.Fprintln(w, string(record)); err != nil {
+			return err
+		}
+	}
+	end, _ := json.Marshal(ndjsonEndForJSON{true, len(records)})
+	_, err = fmt.Fprintln(w, string(end))
+	return err
+}
+
+func parseDate(s string) (time.Time, error) {
+	if len(s) == 0 {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+	if err != nil {
+		return t, usagef("Bad date \"%s\"; expected YYYY-MM-DD or an RFC 3339 timestamp", s)
+	}
+	return t, nil
+}
+
+// authorName drops the email address from an author as git log gives it.
+//
+func authorName(author string) string {
+	if i := strings.Index(author, " <"); i >= 0 {
+		return author[:i]
+	}
+	return author
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"io"
+	"os"
+
+	"github.com/rbwinslow/morlock/api"
+	"github.com/rbwinslow/morlock/export"
+	"golang.org/x/term"
+)
+
+const (
+	EXPORT_GIF       = "gif"
+	EXPORT_ASCIICAST = "asciicast"
+	EXPORT_HTML      = "html"
+)
+
+// exportCommand writes a file's timelapse out as an animation, to -o or, as
+// long as it isn't a terminal, to stdout. Flags left at zero get the
+// format's defaults.
+//
+func exportCommand(flags *flag.FlagSet, args []string, stdout io.Writer) error {
+	format := flags.String("format", EXPORT_GIF, "what to export: gif, asciicast or html")
+	output := flags.String("o", "", "file to write (default stdout)")
+	delay := flags.Duration("delay", 0, "how long each commit stays up")
+	duration := flags.Duration("duration", 0, "asciicast only: space commits as far apart as their dates, over this long in all")
+	maxFrames := flags.Int("max-frames", 0, "most commits to show, spread evenly over the history")
+	columns := flags.Int("columns", 0, "characters per line")
+	rows := flags.Int("rows", 0, "lines per frame")
+	scale := flags.Int("scale", 0, "GIF only: how many times to blow up each pixel")
+	concurrency := flags.Int("concurrency", 0, "diffs to fetch from git at once (0 for one at a time)")
+	arg, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+
+	playback := export.Playback{Delay: *delay, MaxFrames: *maxFrames}
+	var write func(w io.Writer, p string, frames []api.TimelapseProgress) error
+	switch *format {
+	case EXPORT_GIF:
+		if *duration != 0 {
+			return usagef("-duration only applies to asciicast")
+		}
+		opts := export.GIFOptions{Playback: playback, Columns: *columns, Rows: *rows, Scale: *scale}
+		if err := opts.Validate(); err != nil {
+			return usagef("%s", err)
+		}
+		if len(*output) == 0 {
+			if f, ok := stdout.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+				return usagef("Won't write a GIF to a terminal; use -o or a redirect")
+			}
+		}
+		write = func(w io.Writer, p string, frames []api.TimelapseProgress) error {
+			return export.WriteGIF(w, frames, opts)
+		}
+	case EXPORT_ASCIICAST:
+		if *scale != 0 {
+			return usagef("-scale only applies to gif")
+		}
+		opts := export.AsciicastOptions{Playback: playback, Duration: *duration, Columns: *columns, Rows: *rows}
+		if err := opts.Validate(); err != nil {
+			return usagef("%s", err)
+		}
+		write = func(w io.Writer, p string, frames []api.TimelapseProgress) error {
+			return export.WriteAsciicast(w, p, frames, opts)
+		}
+	case EXPORT_HTML:
+		if *duration != 0 || *columns != 0 || *rows != 0 || *scale != 0 {
+			return usagef("html only takes -delay and -max-frames")
+		}
+		opts := export.HTMLOptions{Playback: playback}
+		if err := opts.Validate(); err != nil {
+			return usagef("%s", err)
+		}
+		write = func(w io.Writer, p string, frames []api.TimelapseProgress) error {
+			return export.WriteHTML(w, p, frames, opts)
+		}
+	default:
+		return usagef("Unknown export format \"%s\" (expected gif, asciicast or html)", *format)
+	}
+
+	repo, subPath, err := openTrackedFile(arg)
+	if err != nil {
+		return err
+	}
+	frames, err := export.LoadFrames(context.Background(), repo, subPath, api.TimelapseOptions{Concurrency: *concurrency})
+	if err != nil {
+		return err
+	}
+
+	if len(*output) == 0 {
+		return write(stdout, subPath, frames)
+	}
+	f, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if err := write(w, subPath, frames); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
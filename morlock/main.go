@@ -0,0 +1,186 @@
+// Command morlock shows the history of files in git repositories, from the
+// command line or, with serve, in a browser.
+//
+//     morlock history [-format F] [-since D] [-until D] [-author RE] [-message RE] [-limit N] [-rev REV] path
+//     morlock timelapse [-format F] [-concurrency N] path
+//     morlock frame [-format F] [-rev REV] [-concurrency N] path
+//     morlock blame [-format F] [-rev REV] path
+//     morlock play [-interval D] [-concurrency N] path
+//     morlock export [-format gif|asciicast|html] [-o FILE] [-delay D] [-duration D] [-max-frames N] [-columns N] [-rows N] [-scale N] path
+//     morlock site -o DIR [-delay D] [-max-frames N] [-rebuild] [-concurrency N] path...
+//     morlock verify [-concurrency N] [-q] path...
+//     morlock serve [server flags]
+//
+// The format F is text (the default), json, or ndjson: one JSON record per
+// commit, hunk or line, and then a last record with "done" set to true and a
+// count of the records before it.
+//
+// play shows the timelapse full-screen in a terminal, commit by commit, with
+// the lines each commit added in green and the ones it deleted in red. Space
+// plays and pauses, the arrow keys step and scroll, [ and ] skip ten commits,
+// d shows the lines deleted before, + and - change the speed, and q quits.
+//
+// export makes an animated GIF of the timelapse, a frame per commit, to drop
+// into documents, an asciicast v2 recording of it to play in a terminal, or
+// a single HTML page that plays it in a browser, with nothing else needed.
+//
+// site writes a directory that browses a whole repository, or the paths given,
+// with no server: an index, and for each file its history and timelapse as
+// JSON and a page like export's. Written again, it only redoes the files whose
+// history changed since.
+//
+// verify rebuilds the timelapse of each file given, or of each text file in
+// each directory given, and checks every frame of it against the file as git
+// has it at that commit, reporting the first frame that doesn't match.
+//
+// It exits with status 0 on success, 2 when it's used wrong (bad flags or
+// revisions included), 3 when the path isn't in a git repository, 4 when git
+// doesn't know the file, 5 when git isn't installed, and 1 for anything else,
+// a timelapse that verify finds doesn't match included.
+//
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rbwinslow/morlock/api"
+	"github.com/rbwinslow/morlock/web"
+)
+
+const (
+	EXIT_OK = iota
+	EXIT_INTERNAL
+	EXIT_USAGE
+	EXIT_NOT_REPOSITORY
+	EXIT_NOT_TRACKED
+	EXIT_GIT_MISSING
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(flags *flag.FlagSet, args []string, stdout io.Writer) error
+}
+
+var commands = []command{
+	{"history", "[-format F] [-since D] [-until D] [-author RE] [-message RE] [-limit N] [-rev REV] path", historyCommand},
+	{"timelapse", "[-format F] [-concurrency N] path", timelapseCommand},
+	{"frame", "[-format F] [-rev REV] [-concurrency N] path", frameCommand},
+	{"blame", "[-format F] [-rev REV] path", blameCommand},
+	{"play", "[-interval D] [-concurrency N] path", playCommand},
+	{"export", "[-format gif|asciicast|html] [-o FILE] [-delay D] [-duration D] [-max-frames N] [-columns N] [-rows N] [-scale N] path", exportCommand},
+	{"site", "-o DIR [-delay D] [-max-frames N] [-rebuild] [-concurrency N] path...", siteCommand},
+	{"verify", "[-concurrency N] [-q] path...", verifyCommand},
+	{"serve", "[server flags]", serveCommand},
+}
+
+// serveCommand runs the web server, which parses its own flags.
+//
+func serveCommand(flags *flag.FlagSet, args []string, stdout io.Writer) error {
+	err := web.Serve(args)
+	if errors.Is(err, web.ErrBadFlags) {
+		return &usageError{message: err.Error(), reported: true}
+	}
+	return err
+}
+
+// usageError is a command used wrong; its message says how. The flag package
+// reports its own errors, so those are marked reported, and not repeated.
+//
+type usageError struct {
+	message  string
+	reported bool
+}
+
+func (ue *usageError) Error() string {
+	return ue.message
+}
+
+func usagef(format string, args ...interface{}) error {
+	return &usageError{message: fmt.Sprintf(format, args...)}
+}
+
+// parseFlags parses a command's flags, and checks that exactly one argument,
+// the path, is left over.
+//
+func parseFlags(flags *flag.FlagSet, args []string) (string, error) {
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return "", err
+		}
+		return "", &usageError{message: err.Error(), reported: true}
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return "", &usageError{message: "expected one path", reported: true}
+	}
+	return flags.Arg(0), nil
+}
+
+func main() {
+	os.Exit(Run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// Run runs the command that args (without the program name) call for, and
+// returns the status to exit with.
+//
+func Run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		printUsage(stderr)
+		return EXIT_USAGE
+	}
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+			flags.SetOutput(stderr)
+			usage := cmd.usage
+			flags.Usage = func() {
+				fmt.Fprintf(stderr, "usage: morlock %s %s\n", flags.Name(), usage)
+				flags.PrintDefaults()
+			}
+			err := cmd.run(flags, args[1:], stdout)
+			var usageErr *usageError
+			if err != nil && err != flag.ErrHelp && !(errors.As(err, &usageErr) && usageErr.reported) {
+				fmt.Fprintf(stderr, "morlock %s: %s\n", cmd.name, err)
+			}
+			return exitCode(err)
+		}
+	}
+	if args[0] == "help" || args[0] == "-h" || args[0] == "-help" {
+		printUsage(stdout)
+		return EXIT_OK
+	}
+	fmt.Fprintf(stderr, "morlock: no such command \"%s\"\n", args[0])
+	printUsage(stderr)
+	return EXIT_USAGE
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "usage:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "    morlock %s %s\n", cmd.name, cmd.usage)
+	}
+}
+
+// exitCode picks the status to exit with after err.
+//
+func exitCode(err error) int {
+	var usage *usageError
+	switch {
+	case err == nil, err == flag.ErrHelp:
+		return EXIT_OK
+	case errors.As(err, &usage), errors.Is(err, api.ErrBadRevision), errors.Is(err, api.ErrBadCursor), errors.Is(err, api.ErrPathIsDirectory):
+		return EXIT_USAGE
+	case errors.Is(err, api.ErrNotRepository):
+		return EXIT_NOT_REPOSITORY
+	case errors.Is(err, api.ErrPathNotFound), errors.Is(err, api.ErrNotTracked):
+		return EXIT_NOT_TRACKED
+	case errors.Is(err, api.ErrGitMissing):
+		return EXIT_GIT_MISSING
+	}
+	return EXIT_INTERNAL
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"github.com/rbwinslow/morlock/test_util"
+
+	"bytes"
+	"encoding/json"
+	"image/gif"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("morlock", func() {
+	var run = func(args ...string) (int, string, string) {
+		var stdout, stderr bytes.Buffer
+		status := Run(args, &stdout, &stderr)
+		return status, stdout.String(), stderr.String()
+	}
+
+	It("should show a file's history in each format", func() {
+		test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+			// Given
+			tgr.MustAddFile("file.txt", "one\n")
+			first := tgr.MustCommit("first")
+			tgr.MustAddFile("file.txt", "one\ntwo\n")
+			second := tgr.MustCommit("second")
+			file := path.Join(tgr.Path, "file.txt")
+
+			// When
+			textStatus, text, _ := run("history", file)
+			jsonStatus, js, _ := run("history", "-format", "json", file)
+			ndjsonStatus, ndjson, _ := run("history", "-format", "ndjson", "-limit", "1", file)
+
+			// Then
+			Expect(textStatus).To(Equal(EXIT_OK))
+			lines := strings.Split(strings.TrimSpace(text), "\n")
+			Expect(lines).To(HaveLen(2))
+			Expect(lines[0]).To(HavePrefix(second.String()))
+			Expect(lines[0]).To(HaveSuffix("second"))
+			Expect(lines[1]).To(HavePrefix(first.String()))
+
+			Expect(jsonStatus).To(Equal(EXIT_OK))
+			var commits []struct{ Desc string }
+			Expect(json.Unmarshal([]byte(js), &commits)).To(Succeed())
+			Expect(commits).To(HaveLen(2))
+			Expect(commits[0].Desc).To(Equal("second"))
+
+			Expect(ndjsonStatus).To(Equal(EXIT_OK))
+			records := strings.Split(strings.TrimSpace(ndjson), "\n")
+			Expect(records).To(HaveLen(2))
+			Expect(records[1]).To(MatchJSON(`{"done": true, "count": 1}`))
+		})
+	})
+
+	It("should show a timelapse, a frame of one, and blame", func() {
+		test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+			// Given
+			tgr.MustAddFile("file.txt", "a\nb\n")
+			first := tgr.MustCommit("first")
+			tgr.MustAddFile("file.txt", "a\n")
+			tgr.MustCommit("second")
+			file := path.Join(tgr.Path, "file.txt")
+
+			// When
+			timelapseStatus, timelapse, _ := run("timelapse", file)
+			frameStatus, frame, _ := run("frame", "-format", "json", "-rev", first.String(), file)
+			blameStatus, blame, _ := run("blame", "-format", "ndjson", file)
+
+			// Then
+			Expect(timelapseStatus).To(Equal(EXIT_OK))
+			Expect(timelapse).To(Equal("  a\n- b\n"))
+
+			Expect(frameStatus).To(Equal(EXIT_OK))
+			var f struct {
+				Commit    struct{ Desc string }
+				Timelapse []struct{ Lines []string }
+			}
+			Expect(json.Unmarshal([]byte(frame), &f)).To(Succeed())
+			Expect(f.Commit.Desc).To(Equal("first"))
+			Expect(f.Timelapse).To(HaveLen(1))
+			Expect(f.Timelapse[0].Lines).To(Equal([]string{"a", "b"}))
+
+			Expect(blameStatus).To(Equal(EXIT_OK))
+			records := strings.Split(strings.TrimSpace(blame), "\n")
+			Expect(records).To(HaveLen(2))
+			Expect(records[0]).To(ContainSubstring(`"content":"a"`))
+		})
+	})
+
+	It("should export a GIF to a file, and an asciicast or a page to stdout", func() {
+		test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+			// Given
+			tgr.MustAddFile("file.txt", "a\n")
+			tgr.MustCommit("first")
+			tgr.MustAddFile("file.txt", "a\nb\n")
+			tgr.MustCommit("second")
+			output := path.Join(tgr.Path, "out.gif")
+
+			// When
+			status, _, _ := run("export", "-o", output, "-max-frames", "1", path.Join(tgr.Path, "file.txt"))
+			castStatus, cast, _ := run("export", "-format", "asciicast", "-delay", "2s", path.Join(tgr.Path, "file.txt"))
+			pageStatus, page, _ := run("export", "-format", "html", path.Join(tgr.Path, "file.txt"))
+			badFormat, _, _ := run("export", "-format", "mov", path.Join(tgr.Path, "file.txt"))
+			badPageFlag, _, _ := run("export", "-format", "html", "-columns", "40", path.Join(tgr.Path, "file.txt"))
+			badFlag, _, _ := run("export", "-duration", "1m", path.Join(tgr.Path, "file.txt"))
+
+			// Then
+			Expect(status).To(Equal(EXIT_OK))
+			f, err := os.Open(output)
+			Expect(err).To(BeNil())
+			defer f.Close()
+			anim, err := gif.DecodeAll(f)
+			Expect(err).To(BeNil())
+			Expect(anim.Image).To(HaveLen(1))
+
+			Expect(castStatus).To(Equal(EXIT_OK))
+			events := strings.Split(strings.TrimSpace(cast), "\n")
+			Expect(events).To(HaveLen(4))
+			Expect(events[2]).To(HavePrefix(`[2,"o",`))
+
+			Expect(pageStatus).To(Equal(EXIT_OK))
+			Expect(page).To(HavePrefix("<!DOCTYPE html>"))
+			Expect(page).To(ContainSubstring(`"path":"file.txt"`))
+
+			Expect(badFormat).To(Equal(EXIT_USAGE))
+			Expect(badFlag).To(Equal(EXIT_USAGE))
+			Expect(badPageFlag).To(Equal(EXIT_USAGE))
+		})
+	})
+
+	It("should write a static site, and only the files that changed when run again", func() {
+		test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+			// Given
+			tgr.MustAddFile("a.txt", "a\n")
+			tgr.MustAddFile("b.txt", "b\n")
+			tgr.MustCommit("first")
+			site, err := ioutil.TempDir("", "morlock-test-")
+			Expect(err).To(BeNil())
+			defer os.RemoveAll(site)
+
+			// When
+			status, out, _ := run("site", "-o", site, tgr.Path)
+			tgr.MustAddFile("a.txt", "a\nA\n")
+			tgr.MustCommit("second")
+			againStatus, again, _ := run("site", "-o", site, path.Join(tgr.Path, "a.txt"), path.Join(tgr.Path, "b.txt"))
+			noOutput, _, _ := run("site", tgr.Path)
+			notTracked, _, _ := run("site", "-o", site, path.Join(tgr.Path, "nope.txt"))
+
+			// Then
+			Expect(status).To(Equal(EXIT_OK))
+			Expect(out).To(Equal("2 files written, 0 kept and 0 removed in " + site + "\n"))
+			_, err = os.Stat(path.Join(site, "files", "b.txt", "index.html"))
+			Expect(err).To(BeNil())
+			Expect(againStatus).To(Equal(EXIT_OK))
+			Expect(again).To(HavePrefix("1 files written, 1 kept and 0 removed"))
+			Expect(noOutput).To(Equal(EXIT_USAGE))
+			Expect(notTracked).To(Equal(EXIT_NOT_TRACKED))
+		})
+	})
+
+	It("should verify the timelapses of a file, or of the text files in a directory", func() {
+		test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+			// Given
+			Expect(os.Mkdir(path.Join(tgr.Path, "dir"), 0777)).To(Succeed())
+			tgr.MustAddFile("a.txt", "one\n")
+			tgr.MustAddFile("dir/b.txt", "two\n")
+			tgr.MustAddFile("dir/c.bin", "\x00\x01")
+			tgr.MustCommit("first")
+			tgr.MustAddFile("dir/b.txt", "two\nthree\n")
+			tgr.MustCommit("second")
+
+			// When
+			dirStatus, dir, _ := run("verify", tgr.Path)
+			quietStatus, quiet, _ := run("verify", "-q", path.Join(tgr.Path, "dir/b.txt"))
+			notTracked, _, _ := run("verify", path.Join(tgr.Path, "nope.txt"))
+			noPath, _, _ := run("verify")
+
+			// Then
+			Expect(dirStatus).To(Equal(EXIT_OK))
+			Expect(strings.Split(strings.TrimSpace(dir), "\n")).To(Equal([]string{
+				"a.txt: all 1 frames match git",
+				"dir/b.txt: all 2 frames match git",
+			}))
+			Expect(quietStatus).To(Equal(EXIT_OK))
+			Expect(quiet).To(BeEmpty())
+			Expect(notTracked).To(Equal(EXIT_NOT_TRACKED))
+			Expect(noPath).To(Equal(EXIT_USAGE))
+		})
+	})
+
+	It("should tell the reasons it failed apart by exit status", func() {
+		test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+			// Given
+			tgr.MustAddFile("file.txt", "a\n")
+			tgr.MustCommit("first")
+			outside, err := ioutil.TempDir("", "morlock-test-")
+			Expect(err).To(BeNil())
+			defer os.RemoveAll(outside)
+
+			// When
+			notRepo, _, notRepoErr := run("history", path.Join(outside, "file.txt"))
+			notTracked, _, _ := run("history", path.Join(tgr.Path, "nope.txt"))
+			Expect(ioutil.WriteFile(path.Join(tgr.Path, "new.txt"), []byte("b\n"), 0666)).To(Succeed())
+			uncommitted, _, uncommittedErr := run("timelapse", path.Join(tgr.Path, "new.txt"))
+			badRev, _, _ := run("blame", "-rev", "no-such-branch", path.Join(tgr.Path, "file.txt"))
+			badFlag, _, badFlagErr := run("history", "-bogus", path.Join(tgr.Path, "file.txt"))
+			badFormat, _, _ := run("blame", "-format", "xml", path.Join(tgr.Path, "file.txt"))
+			noCommand, _, _ := run("frobnicate")
+			badServeFlag, _, badServeFlagErr := run("serve", "-bogus")
+
+			// Then
+			Expect(notRepo).To(Equal(EXIT_NOT_REPOSITORY))
+			Expect(notRepoErr).To(HavePrefix("morlock history: "))
+			Expect(notTracked).To(Equal(EXIT_NOT_TRACKED))
+			Expect(uncommitted).To(Equal(EXIT_NOT_TRACKED))
+			Expect(uncommittedErr).To(ContainSubstring("never been committed"))
+			Expect(badRev).To(Equal(EXIT_USAGE))
+			Expect(badFlag).To(Equal(EXIT_USAGE))
+			Expect(badFlagErr).To(ContainSubstring("usage: morlock history"))
+			Expect(badFormat).To(Equal(EXIT_USAGE))
+			Expect(noCommand).To(Equal(EXIT_USAGE))
+			Expect(badServeFlag).To(Equal(EXIT_USAGE))
+			Expect(badServeFlagErr).NotTo(ContainSubstring("morlock serve:"))
+		})
+	})
+})
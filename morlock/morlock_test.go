@@ -0,0 +1,12 @@
+package main
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"testing"
+)
+
+func TestMorlock(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Morlock command line")
+}
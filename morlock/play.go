@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/rbwinslow/morlock/api"
+	"github.com/rbwinslow/morlock/export"
+	"golang.org/x/term"
+)
+
+const (
+	ANSI_ALTERNATE_SCREEN = "\x1b[?1049h"
+	ANSI_NORMAL_SCREEN    = "\x1b[?1049l"
+	ANSI_HIDE_CURSOR      = "\x1b[?25l"
+	ANSI_SHOW_CURSOR      = "\x1b[?25h"
+)
+
+// playCommand builds a file's timelapse, keeping the frame each commit made
+// along the way, and plays them full-screen. It needs a terminal at both
+// ends.
+//
+func playCommand(flags *flag.FlagSet, args []string, stdout io.Writer) error {
+	interval := flags.Duration("interval", 500*time.Millisecond, "how long each commit stays on screen while playing")
+	concurrency := flags.Int("concurrency", 0, "diffs to fetch from git at once (0 for one at a time)")
+	arg, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	out, ok := stdout.(*os.File)
+	if !ok || !term.IsTerminal(int(out.Fd())) || !term.IsTerminal(int(os.Stdin.Fd())) {
+		return usagef("play needs a terminal; try timelapse or frame instead")
+	}
+	if *interval <= 0 {
+		return usagef("Bad interval %s", *interval)
+	}
+
+	repo, subPath, err := openTrackedFile(arg)
+	if err != nil {
+		return err
+	}
+	opts := api.TimelapseOptions{Concurrency: *concurrency, Progress: func(tp api.TimelapseProgress) {
+		fmt.Fprintf(os.Stderr, "\rLoading %s: %d of %d commits", subPath, tp.Processed, tp.Total)
+	}}
+	frames, err := export.LoadFrames(context.Background(), repo, subPath, opts)
+	fmt.Fprint(os.Stderr, "\r"+export.ANSI_CLEAR)
+	if err != nil {
+		return err
+	}
+
+	return newPlayer(subPath, frames, *interval).run(os.Stdin, out)
+}
+
+// run plays until it's told to quit, redrawing the screen whenever a key,
+// the next frame or a new screen size calls for it.
+//
+func (p *player) run(in, out *os.File) error {
+	state, err := term.MakeRaw(int(in.Fd()))
+	if err != nil {
+		return err
+	}
+	defer term.Restore(int(in.Fd()), state)
+	fmt.Fprint(out, ANSI_ALTERNATE_SCREEN+ANSI_HIDE_CURSOR)
+	defer fmt.Fprint(out, ANSI_SHOW_CURSOR+ANSI_NORMAL_SCREEN)
+
+	keys := make(chan []key)
+	go readKeys(in, keys)
+	interval := p.interval
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	dirty := true
+	for {
+		// Not every platform signals a resize, so the size is checked
+		// on every tick instead.
+		if width, height, err := term.GetSize(int(out.Fd())); err == nil && p.resize(width, height) {
+			dirty = true
+		}
+		if dirty {
+			if err := p.render(out); err != nil {
+				return err
+			}
+			dirty = false
+		}
+
+		select {
+		case ks, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			for _, k := range ks {
+				if k == KEY_QUIT {
+					return nil
+				}
+				p.handle(k)
+			}
+			if p.interval != interval {
+				interval = p.interval
+				ticker.Reset(interval)
+			}
+			dirty = true
+		case <-ticker.C:
+			dirty = p.tick()
+		}
+	}
+}
+
+// readKeys sends along the keys read from in until it can't read any more.
+//
+func readKeys(in io.Reader, keys chan<- []key) {
+	defer close(keys)
+	buf := make([]byte, 256)
+	for {
+		n, err := in.Read(buf)
+		if n > 0 {
+			keys <- parseKeys(buf[:n])
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/rbwinslow/morlock/api"
+	"github.com/rbwinslow/morlock/export"
+)
+
+// key is something the player has been asked to do from the keyboard.
+//
+type key int
+
+const (
+	KEY_QUIT key = iota
+	KEY_PLAY
+	KEY_NEXT
+	KEY_PREV
+	KEY_FORWARD
+	KEY_BACK
+	KEY_FIRST
+	KEY_LAST
+	KEY_UP
+	KEY_DOWN
+	KEY_PAGE_UP
+	KEY_PAGE_DOWN
+	KEY_DELETED
+	KEY_FASTER
+	KEY_SLOWER
+)
+
+const (
+	FRAMES_PER_SKIP = 10
+	MIN_INTERVAL    = 50 * time.Millisecond
+	MAX_INTERVAL    = 10 * time.Second
+)
+
+var runeKeys = map[byte]key{
+	'q': KEY_QUIT, 'Q': KEY_QUIT, 3: KEY_QUIT,
+	' ': KEY_PLAY, 'p': KEY_PLAY,
+	'l': KEY_NEXT, 'h': KEY_PREV,
+	']': KEY_FORWARD, '[': KEY_BACK,
+	'g': KEY_FIRST, 'G': KEY_LAST,
+	'k': KEY_UP, 'j': KEY_DOWN,
+	'b': KEY_PAGE_UP, 'f': KEY_PAGE_DOWN,
+	'd': KEY_DELETED,
+	'+': KEY_FASTER, '=': KEY_FASTER, '-': KEY_SLOWER,
+}
+
+// escapeKeys are the sequences terminals send for the keys that don't type
+// anything, without the escape in front. Cursor keys come in two flavors,
+// depending on the mode the terminal is in.
+//
+var escapeKeys = map[string]key{
+	"[A": KEY_UP, "[B": KEY_DOWN, "[C": KEY_NEXT, "[D": KEY_PREV,
+	"OA": KEY_UP, "OB": KEY_DOWN, "OC": KEY_NEXT, "OD": KEY_PREV,
+	"[H": KEY_FIRST, "[F": KEY_LAST, "OH": KEY_FIRST, "OF": KEY_LAST,
+	"[1~": KEY_FIRST, "[4~": KEY_LAST, "[7~": KEY_FIRST, "[8~": KEY_LAST,
+	"[5~": KEY_PAGE_UP, "[6~": KEY_PAGE_DOWN,
+}
+
+// parseKeys makes out the keys in what one read from the terminal got. An
+// escape on its own is taken as a request to quit; sequences the player
+// doesn't know are skipped whole.
+//
+func parseKeys(input []byte) []key {
+	var keys []key
+	for i := 0; i < len(input); i++ {
+		if input[i] != 0x1b {
+			if k, ok := runeKeys[input[i]]; ok {
+				keys = append(keys, k)
+			}
+			continue
+		}
+		if i+1 == len(input) || (input[i+1] != '[' && input[i+1] != 'O') {
+			keys = append(keys, KEY_QUIT)
+			continue
+		}
+		end := i + 2
+		for end < len(input) && (input[end] < 0x40 || input[end] > 0x7e) {
+			end++
+		}
+		if end == len(input) {
+			break
+		}
+		if k, ok := escapeKeys[string(input[i+1:end+1])]; ok {
+			keys = append(keys, k)
+		}
+		i = end
+	}
+	return keys
+}
+
+// player plays a timelapse frame by frame: each frame is the file as one
+// commit left it, with the lines the commit added and deleted picked out.
+// The lines deleted by earlier commits are hidden unless showDeleted is set.
+// top is the first row of the frame on screen, and width and height are the
+// size of the screen.
+//
+type player struct {
+	path          string
+	frames        []api.TimelapseProgress
+	current       int
+	playing       bool
+	showDeleted   bool
+	interval      time.Duration
+	top           int
+	width, height int
+}
+
+func newPlayer(path string, frames []api.TimelapseProgress, interval time.Duration) *player {
+	p := &player{path: path, frames: frames, interval: interval, width: 80, height: 24}
+	p.seek(len(frames) - 1)
+	return p
+}
+
+// handle does what k asks. It doesn't quit; that's up to the caller.
+//
+func (p *player) handle(k key) {
+	switch k {
+	case KEY_PLAY:
+		p.playing = !p.playing
+		if p.playing && p.current == len(p.frames)-1 {
+			p.seek(0)
+		}
+	case KEY_NEXT:
+		p.playing = false
+		p.seek(p.current + 1)
+	case KEY_PREV:
+		p.playing = false
+		p.seek(p.current - 1)
+	case KEY_FORWARD:
+		p.seek(p.current + FRAMES_PER_SKIP)
+	case KEY_BACK:
+		p.seek(p.current - FRAMES_PER_SKIP)
+	case KEY_FIRST:
+		p.seek(0)
+	case KEY_LAST:
+		p.seek(len(p.frames) - 1)
+	case KEY_UP:
+		p.scroll(-1)
+	case KEY_DOWN:
+		p.scroll(1)
+	case KEY_PAGE_UP:
+		p.scroll(-p.textHeight())
+	case KEY_PAGE_DOWN:
+		p.scroll(p.textHeight())
+	case KEY_DELETED:
+		p.showDeleted = !p.showDeleted
+		p.scrollToChange()
+	case KEY_FASTER:
+		if p.interval /= 2; p.interval < MIN_INTERVAL {
+			p.interval = MIN_INTERVAL
+		}
+	case KEY_SLOWER:
+		if p.interval *= 2; p.interval > MAX_INTERVAL {
+			p.interval = MAX_INTERVAL
+		}
+	}
+}
+
+// tick moves a playing player on to the next frame, and stops it at the last
+// one. It says whether anything changed.
+//
+func (p *player) tick() bool {
+	if !p.playing {
+		return false
+	}
+	p.seek(p.current + 1)
+	if p.current == len(p.frames)-1 {
+		p.playing = false
+	}
+	return true
+}
+
+// resize fits the player to a screen of a new size, and says whether the size
+// really was new.
+//
+func (p *player) resize(width, height int) bool {
+	if width == p.width && height == p.height {
+		return false
+	}
+	p.width, p.height = width, height
+	p.scrollToChange()
+	return true
+}
+
+func (p *player) seek(frame int) {
+	if frame >= len(p.frames) {
+		frame = len(p.frames) - 1
+	}
+	if frame < 0 {
+		frame = 0
+	}
+	p.current = frame
+	p.scrollToChange()
+}
+
+func (p *player) scroll(rows int) {
+	p.top += rows
+	if last := len(p.rows()) - p.textHeight(); p.top > last {
+		p.top = last
+	}
+	if p.top < 0 {
+		p.top = 0
+	}
+}
+
+// scrollToChange brings the first line the current commit changed into view,
+// a third of the way down, unless it's on screen already.
+//
+func (p *player) scrollToChange() {
+	rows := p.rows()
+	if first := export.FirstChange(rows); first >= 0 && (first < p.top || first >= p.top+p.textHeight()) {
+		p.top = export.ScrollTop(rows, p.textHeight())
+	}
+	p.scroll(0)
+}
+
+// textHeight is how many rows of the screen the frame gets: all but the scrub
+// bar and the status line.
+//
+func (p *player) textHeight() int {
+	if p.height < 3 {
+		return 1
+	}
+	return p.height - 2
+}
+
+// rows lays out the current frame.
+//
+func (p *player) rows() []export.Row {
+	if len(p.frames) == 0 {
+		return nil
+	}
+	var prev api.Timelapse
+	if p.current > 0 {
+		prev = p.frames[p.current-1].Partial
+	}
+	return export.Rows(p.frames[p.current].Partial, prev, p.showDeleted)
+}
+
+// render draws the whole screen: the rows of the frame in view, the scrub bar
+// and the status line.
+//
+func (p *player) render(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString(export.ANSI_HOME)
+
+	rows := p.rows()
+	gutter := export.GutterWidth(rows)
+	for i := p.top; i < p.top+p.textHeight(); i++ {
+		if i < len(rows) {
+			b.WriteString(export.ANSIRow(rows[i], gutter, p.width))
+		}
+		b.WriteString(export.ANSI_RESET + export.ANSI_CLEAR + "\r\n")
+	}
+	b.WriteString(p.scrubBar() + export.ANSI_CLEAR + "\r\n")
+	b.WriteString(export.ANSI_REVERSE + p.statusLine() + export.ANSI_RESET)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// scrubBar shows how far through the history the current frame is, and
+// whether it's playing.
+//
+func (p *player) scrubBar() string {
+	state := "||"
+	if p.playing {
+		state = "> "
+	}
+	counter := fmt.Sprintf(" %d/%d %s", p.current+1, len(p.frames), p.interval)
+	help := "  space play  <- -> step  [ ] skip  d deleted  q quit"
+	barWidth := p.width - len(state) - len(counter) - len(help) - 3
+	if barWidth < 10 {
+		help = ""
+		barWidth = p.width - len(state) - len(counter) - 3
+	}
+	if barWidth < 1 {
+		return export.Clip(state+counter, p.width)
+	}
+
+	position := 0
+	if len(p.frames) > 1 {
+		position = p.current * (barWidth - 1) / (len(p.frames) - 1)
+	}
+	bar := strings.Repeat("=", position) + "#" + strings.Repeat("-", barWidth-position-1)
+	return state + " [" + bar + "]" + counter + help
+}
+
+// statusLine describes the commit the current frame is from, padded out to
+// the width of the screen.
+//
+func (p *player) statusLine() string {
+	status := " " + p.path
+	if len(p.frames) > 0 {
+		status = export.Caption(p.frames[p.current].Commit)
+	}
+	status = export.Clip(status, p.width)
+	if pad := p.width - len([]rune(status)); pad > 0 {
+		status += strings.Repeat(" ", pad)
+	}
+	return status
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"github.com/rbwinslow/morlock/api"
+	"github.com/rbwinslow/morlock/export"
+	"github.com/rbwinslow/morlock/test_util"
+
+	"context"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("player", func() {
+	var load = func(tgr *test_util.TemporaryGitRepo, p string) *player {
+		repo, err := api.OpenLocalGitRepo(tgr.Path, nil)
+		Expect(err).To(BeNil())
+		var frames []api.TimelapseProgress
+		opts := api.TimelapseOptions{Progress: func(tp api.TimelapseProgress) {
+			frames = append(frames, tp)
+		}}
+		_, err = repo.BuildTimelapse(context.Background(), p, opts)
+		Expect(err).To(BeNil())
+		pl := newPlayer(p, frames, time.Second)
+		pl.resize(60, 6)
+		return pl
+	}
+
+	var screen = func(pl *player) []string {
+		var b strings.Builder
+		Expect(pl.render(&b)).To(Succeed())
+		return strings.Split(b.String(), "\r\n")
+	}
+
+	It("should make out keys and escape sequences", func() {
+		Expect(parseKeys([]byte("q"))).To(Equal([]key{KEY_QUIT}))
+		Expect(parseKeys([]byte(" \x1b[C\x1b[Dx\x1b[5~\x1bOA"))).To(Equal([]key{KEY_PLAY, KEY_NEXT, KEY_PREV, KEY_PAGE_UP, KEY_UP}))
+		Expect(parseKeys([]byte("\x1b[2~]\x1b"))).To(Equal([]key{KEY_FORWARD, KEY_QUIT}))
+	})
+
+	It("should step through the commits, picking out what each one changed", func() {
+		test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+			// Given
+			tgr.MustAddFile("file.txt", "a\nb\n")
+			tgr.MustCommit("first")
+			tgr.MustAddFile("file.txt", "a\nc\n")
+			tgr.MustCommit("second\n\nwith a body")
+			pl := load(tgr, "file.txt")
+
+			// When
+			last := screen(pl)
+			pl.handle(KEY_PREV)
+			first := screen(pl)
+			pl.handle(KEY_DELETED)
+			pl.handle(KEY_NEXT)
+			pl.handle(KEY_NEXT)
+			again := screen(pl)
+
+			// Then
+			Expect(last).To(HaveLen(6))
+			Expect(last[0]).To(ContainSubstring("   1   a"))
+			Expect(last[1]).To(HavePrefix(export.ANSI_RED))
+			Expect(last[1]).To(ContainSubstring("     - b"))
+			Expect(last[2]).To(HavePrefix(export.ANSI_GREEN + "   2 + c"))
+			Expect(last[4]).To(ContainSubstring("] 2/2 1s"))
+			Expect(last[5]).To(ContainSubstring("  second"))
+			Expect(last[5]).NotTo(ContainSubstring("body"))
+
+			Expect(first[0]).To(HavePrefix(export.ANSI_HOME + export.ANSI_GREEN + "   1 + a"))
+			Expect(first[1]).To(HavePrefix(export.ANSI_GREEN + "   2 + b"))
+			Expect(first[4]).To(ContainSubstring("[#-"))
+			Expect(first[5]).To(ContainSubstring("  first"))
+
+			Expect(pl.current).To(Equal(1))
+			Expect(again).To(Equal(last))
+		})
+	})
+
+	It("should play to the end, and start over from the beginning", func() {
+		test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+			// Given
+			for _, contents := range []string{"1\n", "1\n2\n", "1\n2\n3\n"} {
+				tgr.MustAddFile("file.txt", contents)
+				tgr.MustCommit(contents)
+			}
+			pl := load(tgr, "file.txt")
+
+			// When
+			pl.handle(KEY_PLAY)
+			started := pl.current
+			var ticks []bool
+			for i := 0; i < 3; i++ {
+				ticks = append(ticks, pl.tick())
+			}
+
+			// Then
+			Expect(started).To(Equal(0))
+			Expect(ticks).To(Equal([]bool{true, true, false}))
+			Expect(pl.current).To(Equal(2))
+			Expect(pl.playing).To(BeFalse())
+		})
+	})
+
+	It("should keep the changes in view, and the text inside the screen", func() {
+		test_util.WithTemporaryGitRepo(func(tgr *test_util.TemporaryGitRepo) {
+			// Given
+			lines := strings.Repeat("line\n", 20)
+			tgr.MustAddFile("file.txt", lines)
+			tgr.MustCommit("first")
+			tgr.MustAddFile("file.txt", lines+"\tthe end, with a line much too long to fit on the screen\n")
+			tgr.MustCommit("second")
+			pl := load(tgr, "file.txt")
+
+			// When
+			rows := screen(pl)
+			pl.handle(KEY_PAGE_DOWN)
+			bottom := pl.top
+			pl.handle(KEY_FIRST)
+
+			// Then
+			Expect(rows[3]).To(Equal(export.ANSI_GREEN + "  21 +         the end, with a line much too long to fit on " + export.ANSI_RESET + export.ANSI_CLEAR))
+			Expect(bottom).To(Equal(17))
+			Expect(pl.top).To(Equal(0))
+		})
+	})
+})
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/rbwinslow/morlock/api"
+	"github.com/rbwinslow/morlock/export"
+)
+
+// siteCommand writes a static site browsing the files under the paths it's
+// given, which all have to be in the same repository, into -o. Run again
+// over the same directory, it only writes the files whose history changed.
+//
+func siteCommand(flags *flag.FlagSet, args []string, stdout io.Writer) error {
+	output := flags.String("o", "", "directory to write the site into (required)")
+	delay := flags.Duration("delay", 0, "how long each commit stays up in the pages' players")
+	maxFrames := flags.Int("max-frames", 0, "most commits each page shows, spread evenly over the history")
+	rebuild := flags.Bool("rebuild", false, "write every file again, whether its history changed or not")
+	concurrency := flags.Int("concurrency", 0, "diffs to fetch from git at once (0 for one at a time)")
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return err
+		}
+		return &usageError{message: err.Error(), reported: true}
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return &usageError{message: "expected at least one path", reported: true}
+	}
+	if len(*output) == 0 {
+		return usagef("site needs a directory to write to; use -o")
+	}
+	opts := export.SiteOptions{
+		HTML:        export.HTMLOptions{Playback: export.Playback{Delay: *delay, MaxFrames: *maxFrames}},
+		Concurrency: *concurrency,
+		Rebuild:     *rebuild,
+	}
+	if err := opts.HTML.Validate(); err != nil {
+		return usagef("%s", err)
+	}
+
+	var repo *api.LocalGitRepo
+	for _, arg := range flags.Args() {
+		argRepo, subPath, err := openFile(arg)
+		if err != nil {
+			return err
+		}
+		if repo != nil && argRepo.Path != repo.Path {
+			return usagef("\"%s\" isn't in %s; a site covers one repository", arg, repo.Path)
+		}
+		if subPath == ".." || strings.HasPrefix(subPath, "../") {
+			return usagef("\"%s\" isn't in %s", arg, argRepo.Path)
+		}
+		repo = argRepo
+		opts.Paths = append(opts.Paths, subPath)
+	}
+
+	done := 0
+	opts.Progress = func(p string, built bool) {
+		done++
+		fmt.Fprintf(os.Stderr, "\rWriting the site: %d files", done)
+	}
+	summary, err := export.WriteSite(context.Background(), repo, *output, opts)
+	fmt.Fprint(os.Stderr, "\r"+export.ANSI_CLEAR)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "%d files written, %d kept and %d removed in %s\n", summary.Built, summary.Kept, summary.Removed, *output)
+	return nil
+}
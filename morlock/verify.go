@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rbwinslow/morlock/api"
+)
+
+// verifyCommand rebuilds the timelapse of each file it's given, checking
+// every frame against the file as git has it at that commit, and reports the
+// first frame of each that doesn't match. Given a directory, it verifies every
+// text file in it that's in the HEAD commit.
+//
+func verifyCommand(flags *flag.FlagSet, args []string, stdout io.Writer) error {
+	concurrency := flags.Int("concurrency", 0, "diffs to fetch from git at once (0 for one at a time)")
+	quiet := flags.Bool("q", false, "only report files whose timelapses don't match")
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return err
+		}
+		return &usageError{message: err.Error(), reported: true}
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return &usageError{message: "expected at least one path", reported: true}
+	}
+
+	opts := api.TimelapseOptions{Concurrency: *concurrency}
+	failed, total := 0, 0
+	for _, arg := range flags.Args() {
+		repo, files, err := verifiableFiles(arg)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			total++
+			verification, err := repo.VerifyTimelapse(context.Background(), file, opts)
+			if err != nil {
+				fmt.Fprintf(stdout, "%s: couldn't build timelapse: %s\n", file, err)
+				failed++
+				continue
+			}
+			if verification.Divergence != nil {
+				failed++
+			} else if *quiet {
+				continue
+			}
+			fmt.Fprintln(stdout, verification)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d timelapses don't match git", failed, total)
+	}
+	return nil
+}
+
+// verifiableFiles is the file at arg, which has to have a history, or when
+// arg is a directory, the text files under it in the HEAD commit.
+//
+func verifiableFiles(arg string) (*api.LocalGitRepo, []string, error) {
+	if info, err := os.Stat(arg); err != nil || !info.IsDir() {
+		repo, subPath, err := openTrackedFile(arg)
+		if err != nil {
+			return nil, nil, err
+		}
+		return repo, []string{subPath}, nil
+	}
+
+	repo, subPath, err := openFile(arg)
+	if err != nil {
+		return nil, nil, err
+	}
+	if subPath == "." {
+		subPath = ""
+	}
+	tracked, err := repo.TrackedFiles(subPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	var files []string
+	for _, file := range tracked {
+		if blob, err := repo.Blob("HEAD", file); err == nil && blob.Binary {
+			continue
+		}
+		files = append(files, file)
+	}
+	return repo, files, nil
+}
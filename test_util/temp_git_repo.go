@@ -73,6 +73,13 @@ func (tgr *TemporaryGitRepo) MustInit() {
 	}
 }
 
+func (tgr *TemporaryGitRepo) MustRun(args ...string) {
+	if err, stdout, stderr := tgr.runGitCommand(args...) ; err != nil {
+		msg := api.CookedErrorFromGitExec(stdout, stderr, err).Error()
+		panic(fmt.Sprintf("MustRun (git %s) couldn't: %s", strings.Join(args, " "), msg))
+	}
+}
+
 func (tgr *TemporaryGitRepo) runGitCommand(args ...string) (e error, stdout, stderr *bytes.Buffer) {
 	cmd := exec.Command("git", args...)
 	cmd.Dir = tgr.Path
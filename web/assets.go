@@ -0,0 +1,129 @@
+package web
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"os"
+	"time"
+)
+
+// DEV_RELOAD_POLL is how often, in dev mode, the assets on disk are checked
+// for changes.
+//
+const DEV_RELOAD_POLL = 500 * time.Millisecond
+
+// The front end, built in: page templates under html, and the scripts they
+// load under static. AngularJS is vendored there too, rather than loaded from
+// a CDN, so that the front end works with no way out to the internet; go
+// generate fetches it again.
+//
+//go:generate curl -fsSL -o static/angular.min.js https://ajax.googleapis.com/ajax/libs/angularjs/1.5.6/angular.min.js
+//go:generate curl -fsSL -o static/angular-resource.min.js https://ajax.googleapis.com/ajax/libs/angularjs/1.5.6/angular-resource.min.js
+//go:embed html static
+var builtInAssets embed.FS
+
+var (
+	// assets is where the front end comes from: the copy built in or, in
+	// dev mode, devDir on disk.
+	assets fs.FS = builtInAssets
+	devDir string
+)
+
+// UseDevAssets puts the server in dev mode, serving the front end from dir
+// (the web directory of a source checkout) instead of the copy built in.
+// Every request reads the assets afresh, and pages reload themselves when
+// any of them change.
+//
+func UseDevAssets(dir string) error {
+	dirFS := os.DirFS(dir)
+	if _, err := fs.Stat(dirFS, "html/index.html"); err != nil {
+		return fmt.Errorf("\"%s\" doesn't look like morlock's web directory: %s", dir, err)
+	}
+	assets, devDir = dirFS, dir
+	return nil
+}
+
+// UseBuiltInAssets leaves dev mode, going back to the front end built in.
+//
+func UseBuiltInAssets() {
+	assets, devDir = builtInAssets, ""
+}
+
+func newHtmlTemplate(name string) (*template.Template, error) {
+	text, err := fs.ReadFile(assets, fmt.Sprintf("html/%s.html", name))
+	if err != nil {
+		return nil, err
+	}
+	tmpl := template.New(name)
+	tmpl = tmpl.Delims("[[", "]]")
+	return tmpl.Parse(string(text))
+}
+
+// StaticHandler serves the scripts under /static/. In dev mode,
+// browsers are told not to hold on to them.
+//
+func StaticHandler(w http.ResponseWriter, r *http.Request) {
+	static, err := fs.Sub(assets, "static")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if len(devDir) > 0 {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	http.StripPrefix("/static/", http.FileServer(http.FS(static))).ServeHTTP(w, r)
+}
+
+// DevReloadHandler streams a Server-Sent Event, "reload", whenever any of
+// the assets on disk change, until the client goes away. It's only there in
+// dev mode.
+//
+func DevReloadHandler(w http.ResponseWriter, r *http.Request) {
+	if len(devDir) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeErrorResponse(w, http.StatusInternalServerError, "streaming_unsupported", "Streaming isn't supported on this connection")
+		return
+	}
+
+	seen := lastModified(assets)
+	w.Header().Add("Content-Type", "text/event-stream")
+	w.Header().Add("Cache-Control", "no-cache")
+	flusher.Flush()
+	ticker := time.NewTicker(DEV_RELOAD_POLL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			if modified := lastModified(assets); modified.After(seen) {
+				seen = modified
+				writeServerSentEvent(w, "reload", []byte("{}"))
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// lastModified is when the most recently changed file in fsys changed.
+//
+func lastModified(fsys fs.FS) time.Time {
+	var latest time.Time
+	fs.WalkDir(fsys, ".", func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info, err := entry.Info(); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+		return nil
+	})
+	return latest
+}
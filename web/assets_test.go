@@ -0,0 +1,110 @@
+package web_test
+
+import (
+	"github.com/rbwinslow/morlock/web"
+
+	"bufio"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("front-end assets", func() {
+	var server *httptest.Server
+
+	BeforeEach(func() {
+		server = httptest.NewServer(web.Handler())
+	})
+
+	AfterEach(func() {
+		server.Close()
+		web.UseBuiltInAssets()
+	})
+
+	var get = func(p string) (*http.Response, string) {
+		response, err := http.Get(server.URL + p)
+		Expect(err).To(BeNil())
+		defer response.Body.Close()
+		body, err := ioutil.ReadAll(response.Body)
+		Expect(err).To(BeNil())
+		return response, string(body)
+	}
+
+	It("should serve the page and everything it loads from the binary, with nothing from elsewhere", func() {
+		// When
+		_, page := get("/")
+
+		// Then
+		Expect(page).NotTo(MatchRegexp(`(src|href)="(https?:)?//`))
+		Expect(page).NotTo(ContainSubstring("reload.js"))
+		loads := regexp.MustCompile(`(?:src|href)="([^"]+)"`).FindAllStringSubmatch(page, -1)
+		Expect(loads).To(HaveLen(2))
+		for _, load := range loads {
+			response, body := get("/" + load[1])
+			Expect(response.StatusCode).To(Equal(http.StatusOK), load[1]+" is missing; go generate ./web fetches it")
+			Expect(body).NotTo(BeEmpty())
+		}
+		script, _ := get("/static/angular.min.js")
+		Expect(script.Header.Get("Content-Type")).To(ContainSubstring("javascript"))
+	})
+
+	It("should serve the assets from disk in dev mode, and tell pages when they change", func() {
+		// Given
+		dir, err := ioutil.TempDir("", "morlock-assets")
+		Expect(err).To(BeNil())
+		defer os.RemoveAll(dir)
+		Expect(os.Mkdir(path.Join(dir, "html"), 0755)).To(Succeed())
+		Expect(os.Mkdir(path.Join(dir, "static"), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(path.Join(dir, "html/index.html"), []byte("first[[if .Dev]] dev[[end]]"), 0644)).To(Succeed())
+		Expect(ioutil.WriteFile(path.Join(dir, "static/app.js"), []byte("// first"), 0644)).To(Succeed())
+		Expect(web.UseDevAssets(dir)).To(Succeed())
+
+		// When
+		_, before := get("/")
+		events, err := http.Get(server.URL + "/dev/reload")
+		Expect(err).To(BeNil())
+		defer events.Body.Close()
+		later := time.Now().Add(time.Second)
+		Expect(os.Chtimes(path.Join(dir, "static/app.js"), later, later)).To(Succeed())
+		Expect(ioutil.WriteFile(path.Join(dir, "html/index.html"), []byte("second"), 0644)).To(Succeed())
+		_, after := get("/")
+		script, scriptBody := get("/static/app.js")
+		reload := make(chan string, 1)
+		go func() {
+			line, _ := bufio.NewReader(events.Body).ReadString('\n')
+			reload <- line
+		}()
+
+		// Then
+		Expect(before).To(Equal("first dev"))
+		Expect(after).To(Equal("second"))
+		Expect(scriptBody).To(Equal("// first"))
+		Expect(script.Header.Get("Cache-Control")).To(Equal("no-cache"))
+		Eventually(reload, 5*time.Second).Should(Receive(Equal("event: reload\n")))
+	})
+
+	It("should refuse a dev directory that isn't one", func() {
+		// Given
+		dir, err := ioutil.TempDir("", "morlock-assets")
+		Expect(err).To(BeNil())
+		defer os.RemoveAll(dir)
+
+		// When
+		err = web.UseDevAssets(dir)
+
+		// Then
+		Expect(err).NotTo(BeNil())
+		_, page := get("/")
+		Expect(strings.Contains(page, "static/angular.min.js")).To(BeTrue())
+		reload, _ := get("/dev/reload")
+		Expect(reload.StatusCode).To(Equal(http.StatusNotFound))
+	})
+})
@@ -0,0 +1,71 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/rbwinslow/morlock/api"
+)
+
+type errorResponseForJSON struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+}
+
+// errorStatus picks the HTTP status for an error, from the api or from the
+// checks the handlers make themselves, along with a code that clients can go
+// by instead of the message.
+//
+func errorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, errPathNotAllowed):
+		return http.StatusForbidden, "path_not_allowed"
+	case errors.Is(err, errRelativePath):
+		return http.StatusBadRequest, "bad_path"
+	case errors.Is(err, errUnknownRepo):
+		return http.StatusNotFound, "unknown_repo"
+	case errors.Is(err, api.ErrPathNotFound):
+		return http.StatusNotFound, "path_not_found"
+	case errors.Is(err, api.ErrNotTracked):
+		return http.StatusNotFound, "not_tracked"
+	case errors.Is(err, api.ErrPathIsDirectory):
+		return http.StatusBadRequest, "path_is_directory"
+	case errors.Is(err, api.ErrNotRepository):
+		return http.StatusNotFound, "not_repository"
+	case errors.Is(err, api.ErrBadRevision):
+		return http.StatusBadRequest, "bad_revision"
+	case errors.Is(err, api.ErrBadCursor):
+		return http.StatusBadRequest, "bad_cursor"
+	case errors.Is(err, api.ErrGitMissing):
+		return http.StatusServiceUnavailable, "git_missing"
+	}
+	var te *api.TimelapseError
+	if errors.As(err, &te) {
+		return http.StatusInternalServerError, "timelapse_error"
+	}
+	return http.StatusInternalServerError, "internal"
+}
+
+// writeError sends err to the client as JSON, with the status errorStatus
+// gives it.
+//
+func writeError(w http.ResponseWriter, err error) {
+	status, code := errorStatus(err)
+	writeErrorResponse(w, status, code, err.Error())
+}
+
+// badRequest sends a JSON 400 for a request parameter that doesn't make sense.
+//
+func badRequest(w http.ResponseWriter, err error) {
+	writeErrorResponse(w, http.StatusBadRequest, "bad_request", err.Error())
+}
+
+func writeErrorResponse(w http.ResponseWriter, status int, code, message string) {
+	js, _ := json.Marshal(errorResponseForJSON{message, code})
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	fmt.Fprintln(w, string(js))
+}
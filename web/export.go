@@ -0,0 +1,175 @@
+package web
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rbwinslow/morlock/api"
+	"github.com/rbwinslow/morlock/export"
+)
+
+// The server's GIFs start out smaller than export.DefaultGIFOptions, since it
+// holds every frame, and then the whole file, in memory until it's done.
+//
+const (
+	WEB_GIF_MAX_FRAMES = 50
+	WEB_GIF_SCALE      = 1
+)
+
+// ExportGIFHandler sends a file's timelapse as an animated GIF. delay is how
+// many milliseconds each frame stays up, and maxFrames, columns, rows and
+// scale shape it as export.GIFOptions describes; all of them are optional,
+// with maxFrames WEB_GIF_MAX_FRAMES and scale WEB_GIF_SCALE when left out.
+// Options that would make too big a GIF are a bad request.
+//
+func ExportGIFHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm() ; err != nil {
+		badRequest(w, err)
+		return
+	}
+	var opts export.GIFOptions
+	err := formInts(r, map[string]*int{
+		"maxFrames": &opts.MaxFrames,
+		"columns":   &opts.Columns,
+		"rows":      &opts.Rows,
+		"scale":     &opts.Scale,
+	})
+	if err == nil {
+		opts.Delay, err = formMilliseconds(r, "delay")
+	}
+	if opts.MaxFrames == 0 {
+		opts.MaxFrames = WEB_GIF_MAX_FRAMES
+	}
+	if opts.Scale == 0 {
+		opts.Scale = WEB_GIF_SCALE
+	}
+	if err == nil {
+		err = opts.Validate()
+	}
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+
+	sendExport(w, r, "image/gif", func(w io.Writer, p string, frames []api.TimelapseProgress) error {
+		return export.WriteGIF(w, frames, opts)
+	})
+}
+
+// ExportAsciicastHandler sends a file's timelapse as an asciicast v2
+// recording. Frames come every interval milliseconds or, given a duration
+// in milliseconds instead, as far apart as their commits were; maxFrames,
+// columns and rows shape it as export.AsciicastOptions describes.
+//
+func ExportAsciicastHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm() ; err != nil {
+		badRequest(w, err)
+		return
+	}
+	var opts export.AsciicastOptions
+	err := formInts(r, map[string]*int{
+		"maxFrames": &opts.MaxFrames,
+		"columns":   &opts.Columns,
+		"rows":      &opts.Rows,
+	})
+	if err == nil {
+		opts.Delay, err = formMilliseconds(r, "interval")
+	}
+	if err == nil {
+		opts.Duration, err = formMilliseconds(r, "duration")
+	}
+	if err == nil {
+		err = opts.Validate()
+	}
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+
+	sendExport(w, r, "application/x-asciicast", func(w io.Writer, p string, frames []api.TimelapseProgress) error {
+		return export.WriteAsciicast(w, p, frames, opts)
+	})
+}
+
+// ExportHTMLHandler sends a file's timelapse as a page that plays it back
+// on its own. delay is how many milliseconds each frame stays up, and
+// maxFrames limits them as export.HTMLOptions describes.
+//
+func ExportHTMLHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm() ; err != nil {
+		badRequest(w, err)
+		return
+	}
+	var opts export.HTMLOptions
+	err := formInts(r, map[string]*int{"maxFrames": &opts.MaxFrames})
+	if err == nil {
+		opts.Delay, err = formMilliseconds(r, "delay")
+	}
+	if err == nil {
+		err = opts.Validate()
+	}
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+
+	sendExport(w, r, "text/html; charset=utf-8", func(w io.Writer, p string, frames []api.TimelapseProgress) error {
+		return export.WriteHTML(w, p, frames, opts)
+	})
+}
+
+// sendExport loads the frames of the file the request names and has write
+// export them. The export is finished before any of it is sent, so that a
+// failure can still be reported properly.
+//
+func sendExport(w http.ResponseWriter, r *http.Request, contentType string, write func(io.Writer, string, []api.TimelapseProgress) error) {
+	repo, fileSubPath, err := openRepoForRequest(r, "path")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	frames, err := export.LoadFrames(r.Context(), repo, fileSubPath, api.TimelapseOptions{Concurrency: TimelapseConcurrency})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var b bytes.Buffer
+	if err := write(&b, fileSubPath, frames); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Add("Content-Type", contentType)
+	w.Write(b.Bytes())
+}
+
+// formInts reads the integer parameters named in fields, leaving alone the
+// fields of the ones that aren't there.
+//
+func formInts(r *http.Request, fields map[string]*int) error {
+	for param, field := range fields {
+		if s := r.Form.Get(param); len(s) > 0 {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				return fmt.Errorf("Bad %s \"%s\"", param, s)
+			}
+			*field = n
+		}
+	}
+	return nil
+}
+
+func formMilliseconds(r *http.Request, param string) (time.Duration, error) {
+	ms := r.Form.Get(param)
+	if len(ms) == 0 {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(ms)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("Bad %s \"%s\"", param, ms)
+	}
+	return time.Duration(n) * time.Millisecond, nil
+}
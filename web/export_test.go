@@ -0,0 +1,95 @@
+package web_test
+
+import (
+	"github.com/rbwinslow/morlock/export"
+	"github.com/rbwinslow/morlock/test_util"
+	"github.com/rbwinslow/morlock/web"
+
+	"image/gif"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("export endpoints", func() {
+	It("should send a file's timelapse as a GIF", func() {
+		test_util.WithTemporaryGitRepo(func(repo *test_util.TemporaryGitRepo) {
+			// Given
+			repo.MustAddFile("file.txt", "a\n")
+			repo.MustCommit("first")
+			repo.MustAddFile("file.txt", "a\nb\n")
+			repo.MustCommit("second")
+			file := url.QueryEscape(path.Join(repo.Path, "file.txt"))
+
+			// When
+			response := getFrom(web.ExportGIFHandler, "path="+file+"&delay=100&columns=40&rows=10&scale=1")
+			defaults := getFrom(web.ExportGIFHandler, "path="+file)
+			tooBig := getFrom(web.ExportGIFHandler, "path="+file+"&scale=100")
+			tooManyPixels := getFrom(web.ExportGIFHandler, "path="+file+"&maxFrames=500&columns=300&rows=200&scale=4")
+
+			// Then
+			Expect(response.Code).To(Equal(http.StatusOK))
+			Expect(response.Header().Get("Content-Type")).To(Equal("image/gif"))
+			anim, err := gif.DecodeAll(response.Body)
+			Expect(err).To(BeNil())
+			Expect(anim.Image).To(HaveLen(2))
+			Expect(anim.Delay[0]).To(Equal(10))
+			Expect(anim.Config.Width).To(Equal(240))
+
+			Expect(defaults.Code).To(Equal(http.StatusOK))
+			anim, err = gif.DecodeAll(defaults.Body)
+			Expect(err).To(BeNil())
+			Expect(anim.Config.Width).To(Equal(export.DefaultGIFOptions.Columns * export.CELL_WIDTH * web.WEB_GIF_SCALE))
+
+			Expect(tooBig.Code).To(Equal(http.StatusBadRequest))
+			Expect(errorCode(tooBig)).To(Equal("bad_request"))
+			Expect(tooManyPixels.Code).To(Equal(http.StatusBadRequest))
+			Expect(errorCode(tooManyPixels)).To(Equal("bad_request"))
+		})
+	})
+
+	It("should send a file's timelapse as an asciicast", func() {
+		test_util.WithTemporaryGitRepo(func(repo *test_util.TemporaryGitRepo) {
+			// Given
+			repo.MustAddFile("file.txt", "a\n")
+			repo.MustCommit("first")
+			file := url.QueryEscape(path.Join(repo.Path, "file.txt"))
+
+			// When
+			response := getFrom(web.ExportAsciicastHandler, "path="+file+"&interval=250&rows=10")
+			both := getFrom(web.ExportAsciicastHandler, "path="+file+"&interval=250&duration=1000")
+
+			// Then
+			Expect(response.Code).To(Equal(http.StatusOK))
+			Expect(response.Header().Get("Content-Type")).To(Equal("application/x-asciicast"))
+			lines := strings.Split(strings.TrimSpace(response.Body.String()), "\n")
+			Expect(lines).To(HaveLen(3))
+			Expect(lines[0]).To(ContainSubstring(`"height":10`))
+			Expect(lines[1]).To(HavePrefix(`[0,"o",`))
+			Expect(both.Code).To(Equal(http.StatusBadRequest))
+		})
+	})
+
+	It("should send a file's timelapse as a page", func() {
+		test_util.WithTemporaryGitRepo(func(repo *test_util.TemporaryGitRepo) {
+			// Given
+			repo.MustAddFile("file.txt", "a\n")
+			repo.MustCommit("first")
+			file := url.QueryEscape(path.Join(repo.Path, "file.txt"))
+
+			// When
+			response := getFrom(web.ExportHTMLHandler, "path="+file+"&delay=250")
+			tooMany := getFrom(web.ExportHTMLHandler, "path="+file+"&maxFrames=1000000")
+
+			// Then
+			Expect(response.Code).To(Equal(http.StatusOK))
+			Expect(response.Header().Get("Content-Type")).To(Equal("text/html; charset=utf-8"))
+			Expect(response.Body.String()).To(ContainSubstring(`"delay":250`))
+			Expect(tooMany.Code).To(Equal(http.StatusBadRequest))
+		})
+	})
+})
@@ -1,37 +1,392 @@
-package main
+package web
 
 import (
 	"net/http"
 	"fmt"
-	"html/template"
 	"github.com/rbwinslow/morlock/api"
+	"encoding/json"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
 )
 
 func HistoryHandler(w http.ResponseWriter, r *http.Request) {
 	if err := r.ParseForm() ; err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		badRequest(w, err)
 		return
 	}
 
-	p := r.Form.Get("path")
-	repo, err := api.OpenLocalGitRepo(p, nil)
+	opts, limit, err := historyOptionsFromForm(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		badRequest(w, err)
 		return
 	}
-	fileSubPath := p[len(repo.Path)+1:]
-	var commits api.CommitList
-	out, err := repo.History(fileSubPath)
+
+	repo, fileSubPath, err := openRepoForRequest(r, "path")
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
-	for c := range out {
-		commits = append(commits, c)
+	if wantsNDJSON(r) {
+		streamHistory(w, r, repo, fileSubPath, opts, limit)
+		return
+	}
+	commits, next, err := repo.HistoryPage(r.Context(), fileSubPath, opts, r.Form.Get("cursor"), limit)
+	if err != nil {
+		writeError(w, err)
+		return
 	}
 	js, err := commits.ToJSON()
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	if len(next) > 0 {
+		w.Header().Add("X-Next-Cursor", next)
+	}
+	fmt.Fprintln(w, string(js))
+}
+
+// streamHistory is HistoryHandler's NDJSON mode: it sends each commit as soon
+// as git reports it, instead of waiting for the whole history. A cursor from
+// a paginated response picks up where that page left off. A file with no
+// history at all fails the same way it does in a paginated response, before
+// anything is streamed.
+//
+func streamHistory(w http.ResponseWriter, r *http.Request, repo *api.LocalGitRepo, fileSubPath string, opts api.HistoryOptions, limit int) {
+	if cursor := r.Form.Get("cursor"); len(cursor) > 0 {
+		position, err := api.ParseHistoryCursor(cursor)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		opts.Start, opts.Skip = position.Anchor.String(), position.Offset
+	} else if err := repo.CheckTracked(fileSubPath); err != nil {
+		writeError(w, err)
+		return
+	}
+	opts.Limit = limit
+
+	walk, err := repo.WalkHistory(r.Context(), fileSubPath, opts)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/x-ndjson")
+	w.Header().Add("X-Content-Type-Options", "nosniff")
+	var flush func()
+	if flusher, ok := w.(http.Flusher); ok {
+		flush = flusher.Flush
+	}
+	walk.WriteNDJSON(w, flush)
+}
+
+func wantsNDJSON(r *http.Request) bool {
+	return r.Form.Get("format") == "ndjson" || strings.Contains(r.Header.Get("Accept"), "application/x-ndjson")
+}
+
+// historyOptionsFromForm reads the history filters from a request: since and
+// until (RFC 3339 timestamps or plain dates), author and message (regular
+// expressions), and limit, the largest number of commits to return at once.
+//
+func historyOptionsFromForm(r *http.Request) (opts api.HistoryOptions, limit int, err error) {
+	if opts.Since, err = parseFormTime(r.Form.Get("since")); err != nil {
+		return
+	}
+	if opts.Until, err = parseFormTime(r.Form.Get("until")); err != nil {
+		return
+	}
+	opts.Author = r.Form.Get("author")
+	opts.Message = r.Form.Get("message")
+	if l := r.Form.Get("limit"); len(l) > 0 {
+		if limit, err = strconv.Atoi(l); err != nil || limit < 1 {
+			err = fmt.Errorf("Bad limit \"%s\"", l)
+		}
+	}
+	return
+}
+
+func parseFormTime(s string) (time.Time, error) {
+	if len(s) == 0 {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+	if err != nil {
+		return t, fmt.Errorf("Bad date \"%s\"; expected YYYY-MM-DD or an RFC 3339 timestamp", s)
+	}
+	return t, nil
+}
+
+func BlobHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm() ; err != nil {
+		badRequest(w, err)
+		return
+	}
+
+	repo, fileSubPath, err := openRepoForRequest(r, "path")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	rev := r.Form.Get("rev")
+	if len(rev) == 0 {
+		rev = "HEAD"
+	}
+	blob, err := repo.OpenBlob(rev, fileSubPath)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer blob.Close()
+
+	w.Header().Set("Content-Type", blob.ContentType)
+	w.Header().Set("ETag", fmt.Sprintf("\"%s\"", blob.Object))
+	w.Header().Set("X-Morlock-Commit", blob.Commit.String())
+	w.Header().Set("X-Morlock-Size", strconv.FormatInt(blob.Size, 10))
+	w.Header().Set("X-Morlock-Binary", strconv.FormatBool(blob.Binary))
+	http.ServeContent(w, r, path.Base(fileSubPath), time.Time{}, blob)
+}
+
+func DiffHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm() ; err != nil {
+		badRequest(w, err)
+		return
+	}
+
+	opts := api.DiffOptions{Algorithm: r.Form.Get("algorithm"), FollowRenames: r.Form.Get("renames") != "false"}
+	whitespace, err := api.ParseWhitespaceMode(r.Form.Get("whitespace"))
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+	opts.Whitespace = whitespace
+	if err := opts.Validate(); err != nil {
+		badRequest(w, err)
+		return
+	}
+
+	repo, fileSubPath, err := openRepoForRequest(r, "path")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	to := r.Form.Get("to")
+	if len(to) == 0 {
+		to = "HEAD"
+	}
+	diff, err := repo.Diff(r.Form.Get("from"), to, fileSubPath, opts)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	js, err := diff.ToJSON()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	fmt.Fprintln(w, string(js))
+}
+
+func CommitHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm() ; err != nil {
+		badRequest(w, err)
+		return
+	}
+
+	// repo is a name from the registry, or the absolute path of a repository.
+	var repo *api.LocalGitRepo
+	var err error
+	if repoParam := r.Form.Get("repo"); path.IsAbs(repoParam) {
+		repo, _, err = openRepoForPath(repoParam)
+	} else {
+		repo, _, err = Repos.open(repoParam, "")
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	detail, err := repo.CommitDetail(r.Form.Get("hash"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	js, err := detail.ToJSON()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	fmt.Fprintln(w, string(js))
+}
+
+func TimelapseHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm() ; err != nil {
+		badRequest(w, err)
+		return
+	}
+
+	repo, fileSubPath, err := openRepoForRequest(r, "path")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	tl, err := TimelapseCache.Timelapse(r.Context(), repo, fileSubPath, api.TimelapseOptions{Concurrency: TimelapseConcurrency})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	js, err := tl.ToJSON()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	fmt.Fprintln(w, string(js))
+}
+
+// TimelapseEventsHandler builds a timelapse like TimelapseHandler, but streams
+// Server-Sent Events while it works: a "progress" event for each commit, a
+// "frame" event with the partial timelapse at most once per frameInterval
+// milliseconds (default 1000), and finally either "done" with the finished
+// timelapse or "error". The work stops if the client goes away.
+//
+func TimelapseEventsHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm() ; err != nil {
+		badRequest(w, err)
+		return
+	}
+
+	frameInterval := time.Second
+	if ms := r.Form.Get("frameInterval"); len(ms) > 0 {
+		n, err := strconv.Atoi(ms)
+		if err != nil || n < 0 {
+			badRequest(w, fmt.Errorf("Bad frameInterval \"%s\"", ms))
+			return
+		}
+		frameInterval = time.Duration(n) * time.Millisecond
+	}
+
+	repo, fileSubPath, err := openRepoForRequest(r, "path")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeErrorResponse(w, http.StatusInternalServerError, "streaming_unsupported", "Streaming isn't supported on this connection")
+		return
+	}
+
+	w.Header().Add("Content-Type", "text/event-stream")
+	w.Header().Add("Cache-Control", "no-cache")
+	var lastFrame time.Time
+	opts := api.TimelapseOptions{Concurrency: TimelapseConcurrency, Progress: func(progress api.TimelapseProgress) {
+		if js, err := progress.ToJSON(); err == nil {
+			writeServerSentEvent(w, "progress", js)
+		}
+		if progress.Processed < progress.Total && time.Since(lastFrame) >= frameInterval {
+			if js, err := progress.Partial.ToJSON(); err == nil {
+				writeServerSentEvent(w, "frame", js)
+			}
+			lastFrame = time.Now()
+		}
+		flusher.Flush()
+	}}
+
+	tl, err := TimelapseCache.Timelapse(r.Context(), repo, fileSubPath, opts)
+	if err != nil {
+		if r.Context().Err() == nil {
+			_, code := errorStatus(err)
+			js, _ := json.Marshal(errorResponseForJSON{err.Error(), code})
+			writeServerSentEvent(w, "error", js)
+			flusher.Flush()
+		}
+		return
+	}
+	js, err := tl.ToJSON()
+	if err != nil {
+		js, _ = json.Marshal(errorResponseForJSON{err.Error(), "internal"})
+		writeServerSentEvent(w, "error", js)
+	} else {
+		writeServerSentEvent(w, "done", js)
+	}
+	flusher.Flush()
+}
+
+func writeServerSentEvent(w io.Writer, event string, data []byte) {
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+}
+
+func CacheStatsHandler(w http.ResponseWriter, r *http.Request) {
+	stats := TimelapseCache.Stats()
+	js, err := stats.ToJSON()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	fmt.Fprintln(w, string(js))
+}
+
+func TreeTimelapseHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm() ; err != nil {
+		badRequest(w, err)
+		return
+	}
+
+	repo, dirSubPath, err := openRepoForRequest(r, "path")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	frames, err := repo.TreeTimelapse(dirSubPath)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	js, err := frames.ToJSON()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	fmt.Fprintln(w, string(js))
+}
+
+// TreeHandler lists a directory (dir) as of a revision (rev, default HEAD),
+// with the last commit to touch each entry.
+//
+func TreeHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm() ; err != nil {
+		badRequest(w, err)
+		return
+	}
+
+	repo, dirSubPath, err := openRepoForRequest(r, "dir")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	rev := r.Form.Get("rev")
+	if len(rev) == 0 {
+		rev = "HEAD"
+	}
+	listing, err := repo.ListTree(r.Context(), rev, dirSubPath)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	js, err := listing.ToJSON()
+	if err != nil {
+		writeError(w, err)
 		return
 	}
 	w.Header().Add("Content-Type", "application/json")
@@ -45,14 +400,8 @@ func IndexHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = tmpl.ExecuteTemplate(w, "index", nil)
+	err = tmpl.ExecuteTemplate(w, "index", struct{ Dev bool }{len(devDir) > 0})
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 }
-
-func newHtmlTemplate(name string) (*template.Template, error) {
-	tmpl := template.New(name)
-	tmpl = tmpl.Delims("[[", "]]")
-	return tmpl.Parse(templates[fmt.Sprintf("html/%s.html", name)])
-}
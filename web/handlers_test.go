@@ -1,9 +1,10 @@
-package main_test
+package web_test
 
 import (
 	"github.com/rbwinslow/morlock/test_util"
 	"github.com/rbwinslow/morlock/web"
 
+	"context"
 	"encoding/json"
 	"fmt"
 	. "github.com/onsi/ginkgo"
@@ -12,7 +13,9 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
 	"path"
+	"strings"
 	"time"
 	"github.com/rbwinslow/morlock/api"
 )
@@ -39,7 +42,7 @@ var _ = Describe("request handlers", func() {
 				w := httptest.NewRecorder()
 
 				// When
-				main.HistoryHandler(w, req)
+				web.HistoryHandler(w, req)
 
 				// Then
 				response := w.Result()
@@ -47,10 +50,13 @@ var _ = Describe("request handlers", func() {
 				Expect(response.Header["Content-Type"][0]).To(Equal("application/json"))
 
 				var result []struct {
-					Hash   string
-					Author string
-					Date   time.Time
-					Desc   string
+					Hash         string
+					Author       string
+					Date         time.Time
+					Desc         string
+					LinesAdded   int
+					LinesRemoved int
+					Binary       bool
 				}
 				body, err := ioutil.ReadAll(response.Body)
 				Expect(err).To(BeNil())
@@ -64,7 +70,580 @@ var _ = Describe("request handlers", func() {
 					Expect(result[i].Author).To(ContainSubstring(repo.UserName))
 					Expect(result[i].Date).To(BeTemporally("<", time.Now(), 10 * time.Second))
 					Expect(result[i].Desc).To(Equal(contents[i]))
+					Expect(result[i].LinesAdded).To(Equal(1))
+					Expect(result[i].Binary).To(BeFalse())
 				}
+				Expect(result[0].LinesRemoved).To(Equal(1))
+				Expect(result[1].LinesRemoved).To(Equal(0))
+			})
+		})
+		It("should page and filter the history", func() {
+			// Given
+			filename := "paged.txt"
+			test_util.WithTemporaryGitRepo(func(repo *test_util.TemporaryGitRepo) {
+				for i := 1; i <= 3; i++ {
+					repo.MustAddFile(filename, fmt.Sprintf("version %d", i))
+					repo.MustCommit(fmt.Sprintf("commit %d", i))
+				}
+
+				filepath := path.Join(repo.Path, filename)
+				get := func(query string) *http.Response {
+					URL := fmt.Sprintf("http://localhost/history?path=%s&%s", url.QueryEscape(filepath), query)
+					req, err := http.NewRequest("GET", URL, nil)
+					if err != nil {
+						panic(err)
+					}
+					w := httptest.NewRecorder()
+					web.HistoryHandler(w, req)
+					return w.Result()
+				}
+				descs := func(response *http.Response) []string {
+					var result []struct{ Desc string }
+					body, err := ioutil.ReadAll(response.Body)
+					Expect(err).To(BeNil())
+					Expect(json.Unmarshal(body, &result)).To(BeNil())
+					descs := []string{}
+					for _, c := range result {
+						descs = append(descs, c.Desc)
+					}
+					return descs
+				}
+
+				// When
+				first := get("limit=2")
+				second := get("limit=2&cursor=" + first.Header.Get("X-Next-Cursor"))
+				filtered := get("message=" + url.QueryEscape("[13]$"))
+				bad := get("since=yesterday")
+
+				// Then
+				Expect(first.StatusCode).To(Equal(http.StatusOK))
+				Expect(descs(first)).To(Equal([]string{"commit 3", "commit 2"}))
+				Expect(second.StatusCode).To(Equal(http.StatusOK))
+				Expect(descs(second)).To(Equal([]string{"commit 1"}))
+				Expect(second.Header.Get("X-Next-Cursor")).To(BeEmpty())
+				Expect(descs(filtered)).To(Equal([]string{"commit 3", "commit 1"}))
+				Expect(bad.StatusCode).To(Equal(http.StatusBadRequest))
+			})
+		})
+		It("should answer failures with a status and a code to go by", func() {
+			test_util.WithTemporaryGitRepo(func(repo *test_util.TemporaryGitRepo) {
+				// Given
+				repo.MustAddFile("file.txt", "a")
+				repo.MustCommit("first")
+				repo.MustAddFile("new.txt", "never committed")
+				get := func(handler http.HandlerFunc, query string) (int, map[string]string) {
+					req, err := http.NewRequest("GET", "http://localhost/api?"+query, nil)
+					if err != nil {
+						panic(err)
+					}
+					w := httptest.NewRecorder()
+					handler(w, req)
+					var body map[string]string
+					Expect(w.Result().Header.Get("Content-Type")).To(Equal("application/json"))
+					Expect(json.NewDecoder(w.Result().Body).Decode(&body)).To(BeNil())
+					Expect(body["error"]).ToNot(BeEmpty())
+					return w.Result().StatusCode, body
+				}
+				file := "path=" + url.QueryEscape(path.Join(repo.Path, "file.txt"))
+
+				// When
+				outside, outsideBody := get(web.HistoryHandler, "path=/etc/passwd")
+				missing, missingBody := get(web.HistoryHandler, "path="+url.QueryEscape(path.Join(repo.Path, "no/such.txt")))
+				cursor, cursorBody := get(web.HistoryHandler, file+"&cursor=nonsense")
+				date, dateBody := get(web.HistoryHandler, file+"&since=yesterday")
+				rev, revBody := get(web.BlobHandler, file+"&rev=no-such-branch")
+				untracked := "path=" + url.QueryEscape(path.Join(repo.Path, "new.txt"))
+				untrackedHistory, untrackedHistoryBody := get(web.HistoryHandler, untracked)
+				untrackedTimelapse, untrackedTimelapseBody := get(web.TimelapseHandler, untracked)
+				untrackedStream, untrackedStreamBody := get(web.HistoryHandler, untracked+"&format=ndjson")
+
+				// Then
+				Expect(outside).To(Equal(http.StatusNotFound))
+				Expect(outsideBody["code"]).To(Equal("not_repository"))
+				Expect(missing).To(Equal(http.StatusNotFound))
+				Expect(missingBody["code"]).To(Equal("path_not_found"))
+				Expect(cursor).To(Equal(http.StatusBadRequest))
+				Expect(cursorBody["code"]).To(Equal("bad_cursor"))
+				Expect(date).To(Equal(http.StatusBadRequest))
+				Expect(dateBody["code"]).To(Equal("bad_request"))
+				Expect(rev).To(Equal(http.StatusBadRequest))
+				Expect(revBody["code"]).To(Equal("bad_revision"))
+				Expect(untrackedHistory).To(Equal(http.StatusNotFound))
+				Expect(untrackedHistoryBody["code"]).To(Equal("not_tracked"))
+				Expect(untrackedTimelapse).To(Equal(http.StatusNotFound))
+				Expect(untrackedTimelapseBody["code"]).To(Equal("not_tracked"))
+				Expect(untrackedStream).To(Equal(http.StatusNotFound))
+				Expect(untrackedStreamBody["code"]).To(Equal("not_tracked"))
+			})
+		})
+		It("should stream history as NDJSON with a terminal record", func() {
+			// Given
+			filename := "streamed.txt"
+			test_util.WithTemporaryGitRepo(func(repo *test_util.TemporaryGitRepo) {
+				for i := 1; i <= 3; i++ {
+					repo.MustAddFile(filename, fmt.Sprintf("version %d", i))
+					repo.MustCommit(fmt.Sprintf("commit %d", i))
+				}
+
+				filepath := path.Join(repo.Path, filename)
+				get := func(query string, accept string) []map[string]interface{} {
+					URL := fmt.Sprintf("http://localhost/history?path=%s&%s", url.QueryEscape(filepath), query)
+					req, err := http.NewRequest("GET", URL, nil)
+					if err != nil {
+						panic(err)
+					}
+					if len(accept) > 0 {
+						req.Header.Set("Accept", accept)
+					}
+					w := httptest.NewRecorder()
+					web.HistoryHandler(w, req)
+					response := w.Result()
+					Expect(response.StatusCode).To(Equal(http.StatusOK))
+					Expect(response.Header.Get("Content-Type")).To(Equal("application/x-ndjson"))
+
+					var records []map[string]interface{}
+					body, err := ioutil.ReadAll(response.Body)
+					Expect(err).To(BeNil())
+					for _, line := range strings.Split(strings.TrimRight(string(body), "\n"), "\n") {
+						var record map[string]interface{}
+						Expect(json.Unmarshal([]byte(line), &record)).To(BeNil())
+						records = append(records, record)
+					}
+					return records
+				}
+
+				// When
+				all := get("format=ndjson", "")
+				limited := get("limit=1", "application/x-ndjson")
+				failed := get("format=ndjson&author="+url.QueryEscape("["), "")
+
+				// Then
+				Expect(len(all)).To(Equal(4))
+				Expect(all[0]["desc"]).To(Equal("commit 3"))
+				Expect(all[2]["desc"]).To(Equal("commit 1"))
+				Expect(all[3]).To(Equal(map[string]interface{}{"done": true, "count": float64(3)}))
+
+				Expect(len(limited)).To(Equal(2))
+				Expect(limited[0]["desc"]).To(Equal("commit 3"))
+				Expect(limited[1]["done"]).To(Equal(true))
+
+				Expect(len(failed)).To(Equal(1))
+				Expect(failed[0]["done"]).To(Equal(true))
+				Expect(failed[0]["error"]).ToNot(BeEmpty())
+			})
+		})
+	})
+
+	Describe("tree timelapse endpoint", func() {
+		It("should return a frame per commit touching the directory", func() {
+			// Given
+			test_util.WithTemporaryGitRepo(func(repo *test_util.TemporaryGitRepo) {
+				if err := os.Mkdir(path.Join(repo.Path, "pkg"), 0777); err != nil {
+					panic(err)
+				}
+				repo.MustAddFile("pkg/foo.txt", "foo\n")
+				repo.MustCommit("add foo")
+				repo.MustAddFile("pkg/bar.txt", "bar\nbar\n")
+				repo.MustCommit("add bar")
+
+				URL := fmt.Sprintf("http://localhost/tree-timelapse?path=%s", url.QueryEscape(path.Join(repo.Path, "pkg")))
+				req, err := http.NewRequest("GET", URL, nil)
+				if err != nil {
+					panic(err)
+				}
+
+				w := httptest.NewRecorder()
+
+				// When
+				web.TreeTimelapseHandler(w, req)
+
+				// Then
+				response := w.Result()
+				Expect(response.StatusCode).To(Equal(http.StatusOK))
+				Expect(response.Header["Content-Type"][0]).To(Equal("application/json"))
+
+				var result []struct {
+					Desc  string
+					Files []struct {
+						Path  string
+						Size  int64
+						Lines int
+					}
+					Changes []struct {
+						Status     string
+						Path       string
+						LinesDelta int
+					}
+				}
+				body, err := ioutil.ReadAll(response.Body)
+				Expect(err).To(BeNil())
+				err = json.Unmarshal(body, &result)
+				Expect(err).To(BeNil())
+
+				Expect(len(result)).To(Equal(2))
+				Expect(result[0].Desc).To(Equal("add foo"))
+				Expect(len(result[1].Files)).To(Equal(2))
+				Expect(result[1].Files[0].Path).To(Equal("pkg/bar.txt"))
+				Expect(result[1].Files[0].Lines).To(Equal(2))
+				Expect(len(result[1].Changes)).To(Equal(1))
+				Expect(result[1].Changes[0].Status).To(Equal("added"))
+				Expect(result[1].Changes[0].LinesDelta).To(Equal(2))
+			})
+		})
+	})
+
+	Describe("tree endpoint", func() {
+		It("should list a directory of a named repository at a revision", func() {
+			// Given
+			test_util.WithTemporaryGitRepo(func(repo *test_util.TemporaryGitRepo) {
+				if err := os.Mkdir(path.Join(repo.Path, "pkg"), 0777); err != nil {
+					panic(err)
+				}
+				repo.MustAddFile("pkg/foo.txt", "foo\n")
+				first := repo.MustCommit("add foo")
+				repo.MustAddFile("pkg/bar.txt", "bar\n")
+				repo.MustCommit("add bar")
+				registry, err := web.NewRepoRegistry(map[string]string{"project": repo.Path})
+				Expect(err).To(BeNil())
+				web.Repos = registry
+				defer func() { web.Repos = nil }()
+
+				URL := fmt.Sprintf("http://localhost/tree?repo=project&dir=pkg&rev=%s", first)
+				req, err := http.NewRequest("GET", URL, nil)
+				if err != nil {
+					panic(err)
+				}
+				w := httptest.NewRecorder()
+
+				// When
+				web.TreeHandler(w, req)
+
+				// Then
+				response := w.Result()
+				Expect(response.StatusCode).To(Equal(http.StatusOK))
+				var result struct {
+					Dir     string
+					Entries []struct {
+						Name       string
+						Type       string
+						Size       int64
+						LastCommit struct{ Desc string }
+					}
+				}
+				body, err := ioutil.ReadAll(response.Body)
+				Expect(err).To(BeNil())
+				Expect(json.Unmarshal(body, &result)).To(BeNil())
+				Expect(result.Dir).To(Equal("pkg"))
+				Expect(len(result.Entries)).To(Equal(1))
+				Expect(result.Entries[0].Name).To(Equal("foo.txt"))
+				Expect(result.Entries[0].Type).To(Equal("blob"))
+				Expect(result.Entries[0].Size).To(Equal(int64(4)))
+				Expect(result.Entries[0].LastCommit.Desc).To(Equal("add foo"))
+			})
+		})
+	})
+
+	Describe("commit endpoint", func() {
+		It("should return a commit's metadata and changed files", func() {
+			// Given
+			test_util.WithTemporaryGitRepo(func(repo *test_util.TemporaryGitRepo) {
+				repo.MustAddFile("foo.txt", "foo\n")
+				repo.MustCommit("add foo")
+				repo.MustAddFile("foo.txt", "foo\nbar\n")
+				hash := repo.MustCommit("add bar")
+
+				URL := fmt.Sprintf("http://localhost/commit?repo=%s&hash=%s", url.QueryEscape(repo.Path), hash)
+				req, err := http.NewRequest("GET", URL, nil)
+				if err != nil {
+					panic(err)
+				}
+
+				w := httptest.NewRecorder()
+
+				// When
+				web.CommitHandler(w, req)
+
+				// Then
+				response := w.Result()
+				Expect(response.StatusCode).To(Equal(http.StatusOK))
+				Expect(response.Header["Content-Type"][0]).To(Equal("application/json"))
+
+				var result struct {
+					Hash    string
+					Desc    string
+					Parents []string
+					Files   []struct {
+						Status  string
+						Path    string
+						Added   int
+						Deleted int
+						Hunks   []struct {
+							Lines []struct {
+								Mode      string
+								NewNumber int
+								Content   string
+							}
+						}
+					}
+				}
+				body, err := ioutil.ReadAll(response.Body)
+				Expect(err).To(BeNil())
+				err = json.Unmarshal(body, &result)
+				Expect(err).To(BeNil())
+
+				Expect(api.MustBeHash(result.Hash).Short()).To(Equal(hash))
+				Expect(result.Desc).To(Equal("add bar"))
+				Expect(len(result.Parents)).To(Equal(1))
+				Expect(len(result.Files)).To(Equal(1))
+				Expect(result.Files[0].Status).To(Equal("modified"))
+				Expect(result.Files[0].Added).To(Equal(1))
+				Expect(result.Files[0].Deleted).To(Equal(0))
+				lines := result.Files[0].Hunks[0].Lines
+				Expect(lines[len(lines)-1].Mode).To(Equal("added"))
+				Expect(lines[len(lines)-1].NewNumber).To(Equal(2))
+				Expect(lines[len(lines)-1].Content).To(Equal("bar"))
+			})
+		})
+	})
+
+	Describe("blob endpoint", func() {
+		It("should serve a file as of a revision, including byte ranges", func() {
+			// Given
+			test_util.WithTemporaryGitRepo(func(repo *test_util.TemporaryGitRepo) {
+				if err := os.Mkdir(path.Join(repo.Path, "src"), 0777); err != nil {
+					panic(err)
+				}
+				repo.MustAddFile("src/hello.txt", "hello, world\n")
+				hash := repo.MustCommit("hello")
+				repo.MustAddFile("src/hello.txt", "goodbye\n")
+				repo.MustCommit("goodbye")
+
+				filepath := path.Join(repo.Path, "src/hello.txt")
+				URL := fmt.Sprintf("http://localhost/blob?path=%s&rev=%s", url.QueryEscape(filepath), hash)
+				req, err := http.NewRequest("GET", URL, nil)
+				if err != nil {
+					panic(err)
+				}
+				rangeReq, err := http.NewRequest("GET", URL, nil)
+				if err != nil {
+					panic(err)
+				}
+				rangeReq.Header.Set("Range", "bytes=7-11")
+
+				w := httptest.NewRecorder()
+				rangeW := httptest.NewRecorder()
+
+				// When
+				web.BlobHandler(w, req)
+				web.BlobHandler(rangeW, rangeReq)
+
+				// Then
+				response := w.Result()
+				Expect(response.StatusCode).To(Equal(http.StatusOK))
+				Expect(response.Header.Get("Content-Type")).To(Equal("text/plain; charset=utf-8"))
+				Expect(response.Header.Get("X-Morlock-Size")).To(Equal("13"))
+				Expect(response.Header.Get("X-Morlock-Binary")).To(Equal("false"))
+				Expect(api.MustBeHash(response.Header.Get("X-Morlock-Commit")).Short()).To(Equal(hash))
+				body, err := ioutil.ReadAll(response.Body)
+				Expect(err).To(BeNil())
+				Expect(string(body)).To(Equal("hello, world\n"))
+
+				rangeResponse := rangeW.Result()
+				Expect(rangeResponse.StatusCode).To(Equal(http.StatusPartialContent))
+				Expect(rangeResponse.Header.Get("X-Morlock-Size")).To(Equal("13"))
+				body, err = ioutil.ReadAll(rangeResponse.Body)
+				Expect(err).To(BeNil())
+				Expect(string(body)).To(Equal("world"))
+			})
+		})
+	})
+
+	Describe("diff endpoint", func() {
+		It("should compare two revisions of a file", func() {
+			// Given
+			test_util.WithTemporaryGitRepo(func(repo *test_util.TemporaryGitRepo) {
+				if err := os.Mkdir(path.Join(repo.Path, "src"), 0777); err != nil {
+					panic(err)
+				}
+				repo.MustAddFile("src/a.txt", "one\n")
+				from := repo.MustCommit("one")
+				repo.MustAddFile("src/a.txt", "one\ntwo\n")
+				repo.MustCommit("two")
+				repo.MustAddFile("src/a.txt", "one\ntwo\nthree\n")
+				to := repo.MustCommit("three")
+
+				filepath := path.Join(repo.Path, "src/a.txt")
+				URL := fmt.Sprintf("http://localhost/diff?path=%s&from=%s&to=%s", url.QueryEscape(filepath), from, to)
+				req, err := http.NewRequest("GET", URL, nil)
+				if err != nil {
+					panic(err)
+				}
+				badReq, err := http.NewRequest("GET", URL+"&whitespace=sometimes", nil)
+				if err != nil {
+					panic(err)
+				}
+
+				w := httptest.NewRecorder()
+				badW := httptest.NewRecorder()
+
+				// When
+				web.DiffHandler(w, req)
+				web.DiffHandler(badW, badReq)
+
+				// Then
+				response := w.Result()
+				Expect(response.StatusCode).To(Equal(http.StatusOK))
+				Expect(response.Header["Content-Type"][0]).To(Equal("application/json"))
+
+				var result struct {
+					Status string
+					Path   string
+					Added  int
+					Hunks  []struct {
+						OrigStart int
+						NewStart  int
+						Lines     []struct {
+							Mode       string
+							OrigNumber int
+							NewNumber  int
+						}
+					}
+				}
+				body, err := ioutil.ReadAll(response.Body)
+				Expect(err).To(BeNil())
+				err = json.Unmarshal(body, &result)
+				Expect(err).To(BeNil())
+
+				Expect(result.Status).To(Equal("modified"))
+				Expect(result.Path).To(Equal("src/a.txt"))
+				Expect(result.Added).To(Equal(2))
+				Expect(len(result.Hunks)).To(Equal(1))
+				Expect(result.Hunks[0].Lines[0].Mode).To(Equal("unchanged"))
+				Expect(result.Hunks[0].Lines[0].OrigNumber).To(Equal(1))
+				Expect(result.Hunks[0].Lines[2].NewNumber).To(Equal(3))
+
+				Expect(badW.Result().StatusCode).To(Equal(http.StatusBadRequest))
+			})
+		})
+	})
+
+	Describe("timelapse events endpoint", func() {
+		var makeRepo = func(repo *test_util.TemporaryGitRepo) string {
+			if err := os.Mkdir(path.Join(repo.Path, "src"), 0777); err != nil {
+				panic(err)
+			}
+			repo.MustAddFile("src/lines.txt", "one\ntwo\nthree")
+			repo.MustCommit("first")
+			repo.MustAddFile("src/lines.txt", "one\nthree")
+			repo.MustCommit("second")
+			return path.Join(repo.Path, "src/lines.txt")
+		}
+
+		It("should stream progress, frames and the finished timelapse", func() {
+			test_util.WithTemporaryGitRepo(func(repo *test_util.TemporaryGitRepo) {
+				// Given
+				filepath := makeRepo(repo)
+				URL := fmt.Sprintf("http://localhost/timelapse/events?path=%s&frameInterval=0", url.QueryEscape(filepath))
+				req, err := http.NewRequest("GET", URL, nil)
+				if err != nil {
+					panic(err)
+				}
+				w := httptest.NewRecorder()
+
+				// When
+				web.TimelapseEventsHandler(w, req)
+
+				// Then
+				response := w.Result()
+				Expect(response.StatusCode).To(Equal(http.StatusOK))
+				Expect(response.Header.Get("Content-Type")).To(Equal("text/event-stream"))
+				body, err := ioutil.ReadAll(response.Body)
+				Expect(err).To(BeNil())
+
+				var events []string
+				var lastData string
+				for _, block := range strings.Split(strings.TrimSpace(string(body)), "\n\n") {
+					lines := strings.SplitN(block, "\n", 2)
+					events = append(events, strings.TrimPrefix(lines[0], "event: "))
+					lastData = strings.TrimPrefix(lines[1], "data: ")
+				}
+				Expect(events).To(Equal([]string{"progress", "frame", "progress", "done"}))
+
+				var result []struct {
+					Disposition string
+					Lines       []string
+				}
+				Expect(json.Unmarshal([]byte(lastData), &result)).To(BeNil())
+				Expect(len(result)).To(Equal(3))
+				Expect(result[1].Disposition).To(Equal("deleted"))
+				Expect(result[1].Lines).To(Equal([]string{"two"}))
+			})
+		})
+
+		It("should stop when the client disconnects", func() {
+			test_util.WithTemporaryGitRepo(func(repo *test_util.TemporaryGitRepo) {
+				// Given
+				filepath := makeRepo(repo)
+				URL := fmt.Sprintf("http://localhost/timelapse/events?path=%s", url.QueryEscape(filepath))
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				req, err := http.NewRequestWithContext(ctx, "GET", URL, nil)
+				if err != nil {
+					panic(err)
+				}
+				w := httptest.NewRecorder()
+
+				// When
+				web.TimelapseEventsHandler(w, req)
+
+				// Then
+				body, err := ioutil.ReadAll(w.Result().Body)
+				Expect(err).To(BeNil())
+				Expect(string(body)).ToNot(ContainSubstring("event: done"))
+				Expect(string(body)).ToNot(ContainSubstring("event: error"))
+			})
+		})
+	})
+
+	Describe("cache stats endpoint", func() {
+		It("should count timelapses served from the cache", func() {
+			test_util.WithTemporaryGitRepo(func(repo *test_util.TemporaryGitRepo) {
+				// Given
+				if err := os.Mkdir(path.Join(repo.Path, "src"), 0777); err != nil {
+					panic(err)
+				}
+				repo.MustAddFile("src/cached.txt", "one\ntwo\n")
+				repo.MustCommit("first")
+				cache, err := api.NewTimelapseCache(api.TimelapseCacheConfig{})
+				Expect(err).To(BeNil())
+				web.TimelapseCache = cache
+				defer func() { web.TimelapseCache = nil }()
+
+				URL := fmt.Sprintf("http://localhost/timelapse?path=%s", url.QueryEscape(path.Join(repo.Path, "src/cached.txt")))
+				for i := 0; i < 2; i++ {
+					req, err := http.NewRequest("GET", URL, nil)
+					if err != nil {
+						panic(err)
+					}
+					w := httptest.NewRecorder()
+					web.TimelapseHandler(w, req)
+					Expect(w.Result().StatusCode).To(Equal(http.StatusOK))
+				}
+
+				// When
+				req, err := http.NewRequest("GET", "http://localhost/cache/stats", nil)
+				if err != nil {
+					panic(err)
+				}
+				w := httptest.NewRecorder()
+				web.CacheStatsHandler(w, req)
+
+				// Then
+				var stats map[string]int
+				Expect(json.NewDecoder(w.Result().Body).Decode(&stats)).To(BeNil())
+				Expect(stats["entries"]).To(Equal(1))
+				Expect(stats["hits"]).To(Equal(1))
+				Expect(stats["misses"]).To(Equal(1))
 			})
 		})
 	})
@@ -0,0 +1,73 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+)
+
+type panicResponseForJSON struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+	Path  string `json:"path"`
+}
+
+// RecoverPanics keeps a panicking handler from taking its connection down
+// with it. The panic and its stack are logged, and the client gets a 500 with
+// a JSON body saying what happened. If the handler had already started its
+// response, all that can be done is to cut it off.
+//
+func RecoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &startedResponseWriter{ResponseWriter: w}
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+			log.Printf("Panic serving %s: %v\n%s", r.URL, p, debug.Stack())
+			if rw.started {
+				panic(http.ErrAbortHandler)
+			}
+
+			for header := range w.Header() {
+				delete(w.Header(), header)
+			}
+			js, _ := json.Marshal(panicResponseForJSON{fmt.Sprint(p), "panic", r.URL.Path})
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintln(w, string(js))
+		}()
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// startedResponseWriter notices when a response has started going out to
+// the client. It can still be flushed, for the handlers that stream.
+//
+type startedResponseWriter struct {
+	http.ResponseWriter
+	started bool
+}
+
+func (rw *startedResponseWriter) WriteHeader(status int) {
+	rw.started = true
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *startedResponseWriter) Write(b []byte) (int, error) {
+	rw.started = true
+	return rw.ResponseWriter.Write(b)
+}
+
+func (rw *startedResponseWriter) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		rw.started = true
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,69 @@
+package web_test
+
+import (
+	"github.com/rbwinslow/morlock/web"
+
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("panic recovery", func() {
+	var serve = func(handler http.HandlerFunc) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", "http://localhost/api/broken?x=1", nil)
+		if err != nil {
+			panic(err)
+		}
+		w := httptest.NewRecorder()
+		web.RecoverPanics(handler).ServeHTTP(w, req)
+		return w
+	}
+
+	It("should turn a panic into a JSON 500", func() {
+		// Given
+		handler := func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Next-Cursor", "abc")
+			var nothing map[string]int
+			nothing["boom"] = 1
+		}
+
+		// When
+		w := serve(handler)
+
+		// Then
+		response := w.Result()
+		Expect(response.StatusCode).To(Equal(http.StatusInternalServerError))
+		Expect(response.Header.Get("Content-Type")).To(Equal("application/json"))
+		Expect(response.Header.Get("X-Next-Cursor")).To(BeEmpty())
+		var body map[string]string
+		Expect(json.NewDecoder(response.Body).Decode(&body)).To(BeNil())
+		Expect(body["error"]).To(ContainSubstring("nil map"))
+		Expect(body["path"]).To(Equal("/api/broken"))
+	})
+
+	It("should leave handlers that don't panic alone, streaming ones included", func() {
+		w := serve(func(w http.ResponseWriter, r *http.Request) {
+			flusher, ok := w.(http.Flusher)
+			Expect(ok).To(BeTrue())
+			fmt.Fprint(w, "fine")
+			flusher.Flush()
+		})
+
+		Expect(w.Result().StatusCode).To(Equal(http.StatusOK))
+		Expect(w.Body.String()).To(Equal("fine"))
+		Expect(w.Flushed).To(BeTrue())
+	})
+
+	It("should cut off a response that had already started", func() {
+		handler := func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "partial")
+			panic("too late")
+		}
+
+		Expect(func() { serve(handler) }).To(PanicWith(http.ErrAbortHandler))
+	})
+})
@@ -0,0 +1,160 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/rbwinslow/morlock/api"
+)
+
+// RepoRegistry gives repositories short names, so that clients can ask for
+// repo=<name>&path=<path in the repository> without knowing, or learning,
+// where the repositories are on the server. The operator chose them, so named
+// repositories are served whether or not they're under the AllowedRoots.
+//
+type RepoRegistry struct {
+	repos map[string]*api.LocalGitRepo
+}
+
+// Repos is the registry the handlers look repository names up in. When it's
+// nil, no names are known.
+//
+var Repos *RepoRegistry
+
+var errUnknownRepo = errors.New("No repository by that name")
+
+var repoNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// NewRepoRegistry opens the repository at each path in paths, under the name
+// it's keyed by.
+//
+func NewRepoRegistry(paths map[string]string) (*RepoRegistry, error) {
+	rr := RepoRegistry{repos: map[string]*api.LocalGitRepo{}}
+	for name, p := range paths {
+		if !repoNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("Bad repository name \"%s\"; use letters, digits, dots, dashes and underscores", name)
+		}
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return nil, err
+		}
+		if abs, err = filepath.EvalSymlinks(abs); err != nil {
+			return nil, err
+		}
+		repo, err := api.OpenLocalGitRepo(abs, nil)
+		if err != nil {
+			return nil, fmt.Errorf("Repository \"%s\": %s", name, err)
+		}
+		rr.repos[name] = repo
+	}
+	return &rr, nil
+}
+
+// ReadRepoConfig reads a JSON object mapping repository names to paths, for
+// NewRepoRegistry. Relative paths are taken to be relative to the file.
+//
+func ReadRepoConfig(file string) (map[string]string, error) {
+	text, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	paths := map[string]string{}
+	if err := json.Unmarshal(text, &paths); err != nil {
+		return nil, fmt.Errorf("Couldn't read repositories from %s: %s", file, err)
+	}
+	for name, p := range paths {
+		if !filepath.IsAbs(p) {
+			paths[name] = filepath.Join(filepath.Dir(file), p)
+		}
+	}
+	return paths, nil
+}
+
+// Names lists the registry's repositories, in order.
+//
+func (rr *RepoRegistry) Names() []string {
+	names := []string{}
+	if rr != nil {
+		for name := range rr.repos {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// open looks up the repository called name, and resolves p, relative to its
+// top, to a path that doesn't leave it.
+//
+func (rr *RepoRegistry) open(name, p string) (*api.LocalGitRepo, string, error) {
+	var repo *api.LocalGitRepo
+	if rr != nil {
+		repo = rr.repos[name]
+	}
+	if repo == nil {
+		return nil, "", fmt.Errorf("%w: \"%s\"", errUnknownRepo, name)
+	}
+
+	resolved, err := resolvePath(filepath.Join(repo.Path, strings.TrimLeft(p, "/")))
+	if err != nil {
+		return nil, "", err
+	}
+	if !pathUnder(resolved, repo.Path) {
+		return nil, "", fmt.Errorf("%w: %s", errPathNotAllowed, p)
+	}
+	subPath, err := filepath.Rel(repo.Path, resolved)
+	if err != nil {
+		return nil, "", err
+	}
+	if subPath == "." {
+		subPath = ""
+	}
+	return repo, filepath.ToSlash(subPath), nil
+}
+
+// openRepoForRequest finds the repository and path a request is about: by
+// name from the Repos registry, when there's a repo parameter, with the path
+// parameter (pathParam) relative to it; and otherwise from the path
+// parameter alone, which must then be absolute.
+//
+func openRepoForRequest(r *http.Request, pathParam string) (*api.LocalGitRepo, string, error) {
+	if name := r.Form.Get("repo"); len(name) > 0 {
+		return Repos.open(name, r.Form.Get(pathParam))
+	}
+	return openRepoForPath(r.Form.Get(pathParam))
+}
+
+type repoForJSON struct {
+	Name          string `json:"name"`
+	DefaultBranch string `json:"defaultBranch"`
+	Head          string `json:"head"`
+}
+
+// ReposHandler lists the repositories in the registry, with each one's
+// default branch and the commit its HEAD is at (empty if it has none yet).
+//
+func ReposHandler(w http.ResponseWriter, r *http.Request) {
+	repos := []repoForJSON{}
+	for _, name := range Repos.Names() {
+		repo := Repos.repos[name]
+		entry := repoForJSON{Name: name, DefaultBranch: repo.DefaultBranch()}
+		if head, err := repo.ResolveRevision("HEAD"); err == nil {
+			entry.Head = head.String()
+		}
+		repos = append(repos, entry)
+	}
+	js, err := json.Marshal(repos)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	fmt.Fprintln(w, string(js))
+}
@@ -0,0 +1,112 @@
+package web_test
+
+import (
+	"github.com/rbwinslow/morlock/api"
+	"github.com/rbwinslow/morlock/test_util"
+	"github.com/rbwinslow/morlock/web"
+
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("repository registry", func() {
+	AfterEach(func() {
+		web.Repos = nil
+	})
+
+	It("should list named repositories with their default branch and HEAD", func() {
+		test_util.WithTemporaryGitRepo(func(repo *test_util.TemporaryGitRepo) {
+			// Given
+			repo.MustAddFile("file.txt", "a")
+			repo.MustCommit("first")
+			repo.MustRun("checkout", "-q", "-b", "trunk")
+			repo.MustAddFile("file.txt", "b")
+			head := repo.MustCommit("second")
+			registry, err := web.NewRepoRegistry(map[string]string{"project": repo.Path})
+			Expect(err).To(BeNil())
+			web.Repos = registry
+
+			// When
+			w := getFrom(web.ReposHandler, "")
+
+			// Then
+			Expect(w.Result().StatusCode).To(Equal(http.StatusOK))
+			var result []struct {
+				Name          string
+				DefaultBranch string
+				Head          string
+			}
+			Expect(json.Unmarshal(w.Body.Bytes(), &result)).To(BeNil())
+			Expect(result).To(HaveLen(1))
+			Expect(result[0].Name).To(Equal("project"))
+			Expect(result[0].DefaultBranch).To(Equal("trunk"))
+			Expect(api.MustBeHash(result[0].Head).Short()).To(Equal(head))
+			Expect(w.Body.String()).ToNot(ContainSubstring(repo.Path))
+		})
+	})
+
+	It("should serve a path relative to a named repository, but not outside it", func() {
+		test_util.WithTemporaryGitRepo(func(repo *test_util.TemporaryGitRepo) {
+			// Given
+			repo.MustAddFile("file.txt", "a")
+			hash := repo.MustCommit("first")
+			registry, err := web.NewRepoRegistry(map[string]string{"project": repo.Path})
+			Expect(err).To(BeNil())
+			web.Repos = registry
+			if err := os.Symlink("/etc", path.Join(repo.Path, "escape")); err != nil {
+				panic(err)
+			}
+
+			// When
+			history := getFrom(web.HistoryHandler, "repo=project&path=file.txt")
+			commit := getFrom(web.CommitHandler, "repo=project&hash="+hash.String())
+			tree := getFrom(web.TreeTimelapseHandler, "repo=project")
+			dotted := getFrom(web.BlobHandler, "repo=project&path=../../etc/passwd")
+			linked := getFrom(web.BlobHandler, "repo=project&path=escape/passwd")
+			unknown := getFrom(web.HistoryHandler, "repo=nope&path=file.txt")
+
+			// Then
+			Expect(history.Result().StatusCode).To(Equal(http.StatusOK))
+			Expect(history.Body.String()).To(ContainSubstring("first"))
+			Expect(commit.Result().StatusCode).To(Equal(http.StatusOK))
+			body, err := ioutil.ReadAll(tree.Result().Body)
+			Expect(err).To(BeNil())
+			Expect(tree.Result().StatusCode).To(Equal(http.StatusOK))
+			Expect(string(body)).To(ContainSubstring("file.txt"))
+			Expect(dotted.Result().StatusCode).To(Equal(http.StatusForbidden))
+			Expect(linked.Result().StatusCode).To(Equal(http.StatusForbidden))
+			Expect(errorCode(linked)).To(Equal("path_not_allowed"))
+			Expect(unknown.Result().StatusCode).To(Equal(http.StatusNotFound))
+			Expect(errorCode(unknown)).To(Equal("unknown_repo"))
+		})
+	})
+
+	It("should read names from a config file, relative to it", func() {
+		test_util.WithTemporaryGitRepo(func(repo *test_util.TemporaryGitRepo) {
+			// Given
+			config := path.Join(repo.Path, "repos.json")
+			if err := ioutil.WriteFile(config, []byte(`{"here": ".", "bad name": "."}`), 0666); err != nil {
+				panic(err)
+			}
+
+			// When
+			paths, err := web.ReadRepoConfig(config)
+			Expect(err).To(BeNil())
+			_, badName := web.NewRepoRegistry(paths)
+			delete(paths, "bad name")
+			registry, err := web.NewRepoRegistry(paths)
+
+			// Then
+			Expect(paths["here"]).To(Equal(repo.Path))
+			Expect(badName).ToNot(BeNil())
+			Expect(err).To(BeNil())
+			Expect(registry.Names()).To(Equal([]string{"here"}))
+		})
+	})
+})
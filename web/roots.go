@@ -0,0 +1,144 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rbwinslow/morlock/api"
+)
+
+// AllowedRoots are the directories, with their symlinks resolved, that the
+// server will show repositories from. A path is only served when both it and
+// the repository it's in are under one of them, so that being able to reach
+// the port doesn't mean being able to browse every repository on the host.
+// When there are none, any path is allowed. Use SetAllowedRoots to set them.
+//
+var AllowedRoots []string
+
+var (
+	errPathNotAllowed = errors.New("Path is outside the directories this server shows")
+	errRelativePath   = errors.New("Path isn't absolute")
+)
+
+// SetAllowedRoots makes roots the AllowedRoots, absolute and with their
+// symlinks resolved.
+//
+func SetAllowedRoots(roots []string) error {
+	resolved := make([]string, 0, len(roots))
+	for _, root := range roots {
+		abs, err := filepath.Abs(root)
+		if err != nil {
+			return err
+		}
+		if abs, err = filepath.EvalSymlinks(abs); err != nil {
+			return err
+		}
+		resolved = append(resolved, abs)
+	}
+	AllowedRoots = resolved
+	return nil
+}
+
+// openRepoForPath finds the repository containing the absolute path p, and
+// returns that path relative to the repository's root (empty for the root
+// itself). Symlinks are resolved before either is checked against the
+// AllowedRoots.
+//
+func openRepoForPath(p string) (*api.LocalGitRepo, string, error) {
+	resolved, err := resolveAllowedPath(p)
+	if err != nil {
+		return nil, "", err
+	}
+	repo, err := openAllowedRepo(existingAncestor(resolved))
+	if err != nil {
+		return nil, "", err
+	}
+	subPath, err := filepath.Rel(repo.Path, resolved)
+	if err != nil {
+		return nil, "", err
+	}
+	if subPath == "." {
+		subPath = ""
+	}
+	return repo, filepath.ToSlash(subPath), nil
+}
+
+// openAllowedRepo opens the repository at or above p, which has already
+// been resolved, as long as the repository is under the AllowedRoots.
+//
+func openAllowedRepo(p string) (*api.LocalGitRepo, error) {
+	repo, err := api.OpenLocalGitRepo(p, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !pathAllowed(repo.Path) {
+		return nil, fmt.Errorf("%w: %s", errPathNotAllowed, repo.Path)
+	}
+	return repo, nil
+}
+
+// resolveAllowedPath resolves the symlinks in p, which needn't exist, and
+// checks that what it really names is under the AllowedRoots.
+//
+func resolveAllowedPath(p string) (string, error) {
+	resolved, err := resolvePath(p)
+	if err != nil {
+		return "", err
+	}
+	if !pathAllowed(resolved) {
+		return "", fmt.Errorf("%w: %s", errPathNotAllowed, p)
+	}
+	return resolved, nil
+}
+
+// resolvePath cleans up the absolute path p and resolves the symlinks in as
+// much of it as exists.
+//
+func resolvePath(p string) (string, error) {
+	if !filepath.IsAbs(p) {
+		return "", fmt.Errorf("%w: \"%s\"", errRelativePath, p)
+	}
+	p = filepath.Clean(p)
+	existing := existingAncestor(p)
+	rest, err := filepath.Rel(existing, p)
+	if err != nil {
+		return "", err
+	}
+	if existing, err = filepath.EvalSymlinks(existing); err != nil {
+		return "", err
+	}
+	return filepath.Join(existing, rest), nil
+}
+
+// existingAncestor is p, or the nearest directory above it that exists. A
+// file that's been deleted still has a history, in the repository its
+// directory is in; and a file that never existed should be reported as such,
+// not as being outside any repository.
+//
+func existingAncestor(p string) string {
+	for ; p != "/"; p = filepath.Dir(p) {
+		if _, err := os.Stat(p); err == nil {
+			break
+		}
+	}
+	return p
+}
+
+func pathAllowed(p string) bool {
+	return len(AllowedRoots) == 0 || pathUnder(p, AllowedRoots...)
+}
+
+// pathUnder says whether p is one of roots, or inside one of them.
+//
+func pathUnder(p string, roots ...string) bool {
+	for _, root := range roots {
+		rel, err := filepath.Rel(root, p)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
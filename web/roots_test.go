@@ -0,0 +1,134 @@
+package web_test
+
+import (
+	"github.com/rbwinslow/morlock/test_util"
+	"github.com/rbwinslow/morlock/web"
+
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("allowed roots", func() {
+	AfterEach(func() {
+		web.AllowedRoots = nil
+	})
+
+	It("should refuse paths outside the roots, even through symlinks", func() {
+		test_util.WithTemporaryGitRepo(func(inside *test_util.TemporaryGitRepo) {
+			test_util.WithTemporaryGitRepo(func(outside *test_util.TemporaryGitRepo) {
+				// Given
+				inside.MustAddFile("file.txt", "in")
+				inside.MustCommit("inside")
+				outside.MustAddFile("secret.txt", "out")
+				outside.MustCommit("outside")
+				link := path.Join(inside.Path, "link")
+				if err := os.Symlink(outside.Path, link); err != nil {
+					panic(err)
+				}
+				Expect(web.SetAllowedRoots([]string{inside.Path})).To(BeNil())
+				query := func(p string) string {
+					return "path=" + url.QueryEscape(p)
+				}
+
+				// When
+				allowed := getFrom(web.HistoryHandler, query(path.Join(inside.Path, "file.txt")))
+				direct := getFrom(web.HistoryHandler, query(path.Join(outside.Path, "secret.txt")))
+				linked := getFrom(web.BlobHandler, query(path.Join(link, "secret.txt")))
+				dotted := getFrom(web.HistoryHandler, query(path.Join(inside.Path, "..", path.Base(outside.Path), "secret.txt")))
+				commit := getFrom(web.CommitHandler, fmt.Sprintf("repo=%s&hash=HEAD", url.QueryEscape(outside.Path)))
+				relative := getFrom(web.HistoryHandler, query("file.txt"))
+
+				// Then
+				Expect(allowed.Code).To(Equal(http.StatusOK))
+				Expect(direct.Code).To(Equal(http.StatusForbidden))
+				Expect(errorCode(direct)).To(Equal("path_not_allowed"))
+				Expect(linked.Code).To(Equal(http.StatusForbidden))
+				Expect(errorCode(linked)).To(Equal("path_not_allowed"))
+				Expect(dotted.Code).To(Equal(http.StatusForbidden))
+				Expect(commit.Code).To(Equal(http.StatusForbidden))
+				Expect(relative.Code).To(Equal(http.StatusBadRequest))
+				Expect(errorCode(relative)).To(Equal("bad_path"))
+			})
+		})
+	})
+
+	It("should refuse a path under a root when its repository isn't", func() {
+		test_util.WithTemporaryGitRepo(func(repo *test_util.TemporaryGitRepo) {
+			// Given
+			sub := path.Join(repo.Path, "sub")
+			if err := os.Mkdir(sub, 0777); err != nil {
+				panic(err)
+			}
+			repo.MustAddFile("sub/file.txt", "a")
+			repo.MustCommit("first")
+			Expect(web.SetAllowedRoots([]string{sub})).To(BeNil())
+
+			// When
+			w := getFrom(web.HistoryHandler, "path="+url.QueryEscape(path.Join(sub, "file.txt")))
+
+			// Then
+			Expect(w.Code).To(Equal(http.StatusForbidden))
+			Expect(errorCode(w)).To(Equal("path_not_allowed"))
+		})
+	})
+
+	It("should serve the repository root itself, or say why it can't", func() {
+		test_util.WithTemporaryGitRepo(func(repo *test_util.TemporaryGitRepo) {
+			// Given
+			repo.MustAddFile("file.txt", "a")
+			repo.MustCommit("first")
+			repo.MustAddFile("file.txt", "b")
+			repo.MustCommit("second")
+			Expect(web.SetAllowedRoots([]string{repo.Path})).To(BeNil())
+			registry, err := web.NewRepoRegistry(map[string]string{"project": repo.Path})
+			Expect(err).To(BeNil())
+			web.Repos = registry
+			defer func() { web.Repos = nil }()
+			handlers := []struct {
+				handler   http.HandlerFunc
+				pathParam string
+				query     string
+				status    int
+				code      string
+			}{
+				{web.HistoryHandler, "path", "", http.StatusOK, ""},
+				{web.TreeHandler, "dir", "", http.StatusOK, ""},
+				{web.TreeTimelapseHandler, "path", "", http.StatusOK, ""},
+				{web.BlobHandler, "path", "", http.StatusBadRequest, "path_is_directory"},
+				{web.DiffHandler, "path", "&from=HEAD~1", http.StatusBadRequest, "path_is_directory"},
+				{web.TimelapseHandler, "path", "", http.StatusBadRequest, "path_is_directory"},
+				{web.ExportGIFHandler, "path", "", http.StatusBadRequest, "path_is_directory"},
+				{web.ExportAsciicastHandler, "path", "", http.StatusBadRequest, "path_is_directory"},
+				{web.ExportHTMLHandler, "path", "", http.StatusBadRequest, "path_is_directory"},
+			}
+			roots := []func(pathParam string) string{
+				func(pathParam string) string { return pathParam + "=" + url.QueryEscape(repo.Path) },
+				func(pathParam string) string { return "repo=project" },
+				func(pathParam string) string { return "repo=project&" + pathParam + "=/" },
+			}
+
+			for _, rootQuery := range roots {
+				root := rootQuery("path")
+				for i, h := range handlers {
+					// When
+					w := getFrom(h.handler, rootQuery(h.pathParam)+h.query)
+
+					// Then
+					Expect(w.Code).To(Equal(h.status), "%s, handler %d", root, i)
+					Expect(errorCode(w)).To(Equal(h.code), "%s, handler %d", root, i)
+				}
+
+				// A timelapse that's streamed reports its error as an event.
+				w := getFrom(web.TimelapseEventsHandler, root)
+				Expect(w.Body.String()).To(HavePrefix("event: error\n"))
+				Expect(w.Body.String()).To(ContainSubstring(`"code":"path_is_directory"`))
+			}
+		})
+	})
+})
@@ -0,0 +1,132 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"flag"
+	"fmt"
+	"strings"
+	"github.com/rbwinslow/morlock/api"
+)
+
+// ErrBadFlags is what Serve returns when its args don't parse. The flag
+// package has already said what's wrong with them by then.
+//
+var ErrBadFlags = errors.New("Bad server flags")
+
+var (
+	// TimelapseCache is shared by every handler that builds timelapses. When
+	// it's nil, they build each one from scratch.
+	TimelapseCache *api.TimelapseCache
+
+	// TimelapseConcurrency is how many diffs each timelapse fetches from git
+	// at once; zero means one at a time.
+	TimelapseConcurrency int
+)
+
+// Serve runs the web server, configured by command-line style args (see
+// -help for them). It only returns when the server couldn't start or stopped.
+//
+func Serve(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := flags.String("addr", ":8008", "address to listen on")
+	cacheEntries := flags.Int("cache-entries", 256, "most timelapses to keep in memory (0 for no limit)")
+	cacheMB := flags.Int64("cache-mb", 64, "most megabytes of timelapses to keep in memory (0 for no limit)")
+	cacheDir := flags.String("cache-dir", "", "directory in which to keep timelapses across restarts")
+	cacheDiskMB := flags.Int64("cache-disk-mb", 512, "most megabytes of timelapses to keep in -cache-dir (0 for no limit)")
+	noCache := flags.Bool("no-cache", false, "build every timelapse from scratch")
+	var roots, namedRepos repeatedFlag
+	reposFile := flags.String("repos", "", "JSON file naming repositories, as {\"name\": \"path\", ...}")
+	flags.Var(&namedRepos, "repo", "name=path of a repository to serve by name; repeat for more")
+	flags.Var(&roots, "root", "directory whose repositories may be browsed; repeat for more (default the current directory)")
+	dev := flags.String("dev", "", "serve the front end from this web directory of a source checkout, reloading pages when it changes")
+	flags.IntVar(&TimelapseConcurrency, "timelapse-concurrency", 0, "diffs to fetch from git at once per timelapse (0 for one at a time)")
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return err
+		}
+		return fmt.Errorf("%w: %s", ErrBadFlags, err)
+	}
+
+	if len(roots) == 0 {
+		roots = repeatedFlag{"."}
+	}
+	if err := SetAllowedRoots(roots); err != nil {
+		return fmt.Errorf("Couldn't use %s as a root: %s", roots, err)
+	}
+
+	repoPaths := map[string]string{}
+	if len(*reposFile) > 0 {
+		var err error
+		if repoPaths, err = ReadRepoConfig(*reposFile); err != nil {
+			return err
+		}
+	}
+	for _, named := range namedRepos {
+		equals := strings.Index(named, "=")
+		if equals < 0 {
+			return fmt.Errorf("Bad -repo \"%s\"; expected name=path", named)
+		}
+		repoPaths[named[:equals]] = named[equals+1:]
+	}
+	var err error
+	if Repos, err = NewRepoRegistry(repoPaths); err != nil {
+		return err
+	}
+
+	if !*noCache {
+		TimelapseCache, err = api.NewTimelapseCache(api.TimelapseCacheConfig{
+			MaxEntries:   *cacheEntries,
+			MaxBytes:     *cacheMB << 20,
+			Dir:          *cacheDir,
+			MaxDiskBytes: *cacheDiskMB << 20,
+		})
+		if err != nil {
+			return fmt.Errorf("Couldn't set up the timelapse cache: %s", err)
+		}
+	}
+
+	if len(*dev) > 0 {
+		if err := UseDevAssets(*dev); err != nil {
+			return err
+		}
+	}
+
+	return http.ListenAndServe(*addr, Handler())
+}
+
+// Handler routes requests to the handlers, recovering from their panics.
+//
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", IndexHandler)
+	mux.HandleFunc("/static/", StaticHandler)
+	mux.HandleFunc("/dev/reload", DevReloadHandler)
+	mux.HandleFunc("/api/repos", ReposHandler)
+	mux.HandleFunc("/api/history", HistoryHandler)
+	mux.HandleFunc("/api/commit", CommitHandler)
+	mux.HandleFunc("/api/blob", BlobHandler)
+	mux.HandleFunc("/api/diff", DiffHandler)
+	mux.HandleFunc("/api/timelapse", TimelapseHandler)
+	mux.HandleFunc("/api/timelapse/events", TimelapseEventsHandler)
+	mux.HandleFunc("/api/cache/stats", CacheStatsHandler)
+	mux.HandleFunc("/api/tree", TreeHandler)
+	mux.HandleFunc("/api/tree-timelapse", TreeTimelapseHandler)
+	mux.HandleFunc("/api/export/gif", ExportGIFHandler)
+	mux.HandleFunc("/api/export/asciicast", ExportAsciicastHandler)
+	mux.HandleFunc("/api/export/html", ExportHTMLHandler)
+	return RecoverPanics(mux)
+}
+
+// repeatedFlag collects every use of a flag that can be given more than once.
+//
+type repeatedFlag []string
+
+func (rf *repeatedFlag) String() string {
+	return strings.Join(*rf, ",")
+}
+
+func (rf *repeatedFlag) Set(value string) error {
+	*rf = append(*rf, value)
+	return nil
+}
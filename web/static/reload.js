@@ -0,0 +1,8 @@
+// Only served in dev mode: reloads the page whenever the assets on disk change.
+(function () {
+    "use strict";
+
+    new EventSource("dev/reload").addEventListener("reload", function () {
+        location.reload();
+    });
+})();
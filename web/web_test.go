@@ -1,8 +1,11 @@
-package main_test
+package web_test
 
 import (
+	"encoding/json"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
@@ -10,3 +13,24 @@ func TestAPI(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "Morlock Web front-end")
 }
+
+// getFrom has handler answer a GET request with query, and hands back what
+// it wrote.
+//
+func getFrom(handler http.HandlerFunc, query string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest("GET", "http://localhost/api?"+query, nil)
+	if err != nil {
+		panic(err)
+	}
+	w := httptest.NewRecorder()
+	handler(w, req)
+	return w
+}
+
+// errorCode is the code of the error w answered with, if any.
+//
+func errorCode(w *httptest.ResponseRecorder) string {
+	var body struct{ Code string }
+	json.Unmarshal(w.Body.Bytes(), &body)
+	return body.Code
+}